@@ -1,49 +1,192 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
 	"time"
 
+	"home-alarm-bot/internal/config"
 	"home-alarm-bot/internal/httpapi"
+	"home-alarm-bot/internal/lifecycle"
+	"home-alarm-bot/internal/metrics"
+	"home-alarm-bot/internal/monitor"
+	"home-alarm-bot/internal/mqtt"
+	"home-alarm-bot/internal/mqttbridge"
+	"home-alarm-bot/internal/schedule"
+	"home-alarm-bot/internal/sensors"
 	"home-alarm-bot/internal/state"
 	"home-alarm-bot/internal/telegram"
+	"home-alarm-bot/internal/webhook"
 	"home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/archive"
 
 	"github.com/joho/godotenv"
 )
 
-func mustEnv(k string) string {
-	v := os.Getenv(k)
-	if v == "" {
-		log.Fatalf("missing %s", k)
-	}
-	return v
-}
-
 func main() {
 	_ = godotenv.Load()
 
-	alarmClient := alarm.New(mustEnv("SERVER_BASE_URL"))
-	tgAPI := telegram.NewAPI(mustEnv("BOT_TOKEN"))
+	// CONFIG_FILE names an optional TOML file; see config.example.toml.
+	cfgPath := os.Getenv("CONFIG_FILE")
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		log.Fatalf("config:\n%v", err)
+	}
+
+	// SIGINT and SIGTERM start an orderly shutdown; see the end of main.
+	sigCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	life := lifecycle.New(sigCtx)
+
+	panel, follow := openPanel(cfg)
+	tgAPI := telegram.NewAPI(cfg.Telegram.Token)
 	store := state.New()
-	bot   := telegram.NewBot(tgAPI, store, alarmClient)
+	bot   := telegram.NewBot(tgAPI, store, panel)
+	bot.SetAccess(cfg.ACL())
+
+	clips, err := archive.Open(filepath.Join(cfg.DataDir, "clips"),
+		cfg.Limits.ArchiveMaxMB<<20,
+		time.Duration(cfg.Limits.ArchiveMaxDays)*24*time.Hour)
+	if err != nil {
+		log.Fatal("clip archive: ", err)
+	}
+	bot.SetArchive(clips)
+
+	registry := sensors.NewRegistry(cfg.SensorList(), cfg.Sensors.Auto)
+	if hb := time.Duration(cfg.Sensors.Heartbeat); hb > 0 {
+		registry.SetDefaultHeartbeat(hb)
+	}
+	bot.SetRegistry(registry)
+
+	// keep the store in line with the panel and alert when it goes away
+	panelMonitor := monitor.New(panel, store, bot, time.Duration(cfg.Alarm.DownAfter))
+	bot.SetMonitor(panelMonitor)
+	life.Go(func(ctx context.Context) { panelMonitor.Run(time.Duration(cfg.Alarm.PollInterval), ctx.Done()) })
 
-	// start local HTTP listener in a goroutine
+	if len(cfg.API.Clients) == 0 {
+		if cfg.API.AllowUnauthenticated {
+			log.Println("warning: no API clients configured, local HTTP API accepts unauthenticated requests")
+		} else {
+			log.Println("warning: no API clients configured, local HTTP API refuses every request")
+		}
+	}
+	srv := httpapi.New(store, bot)
+	srv.SetArchive(clips)
+	srv.SetRegistry(registry)
+	if err := srv.Configure(cfg.HTTP()); err != nil {
+		log.Fatal(err)
+	}
+	srv.AddCheck("telegram", func(ctx context.Context) error {
+		_, err := tgAPI.GetMe(ctx)
+		return err
+	})
+	srv.AddCheck("alarm", func(ctx context.Context) error {
+		_, err := panel.Status(ctx)
+		return err
+	})
+	srv.AddCheck("storage", httpapi.WritableDir(cfg.DataDir))
+
+	// start local HTTP listener in a goroutine; a failure shuts the bot down
 	go func() {
-		srv := httpapi.New(store, bot)
-		if err := srv.Listen("127.0.0.1:8080"); err != nil {
-			log.Fatal(err)
+		if err := srv.Listen(cfg.Listen); err != nil {
+			life.Stop(fmt.Errorf("http: %w", err))
 		}
 	}()
+	life.OnStop("http server", srv.Shutdown)
+
+	if len(cfg.Webhooks) > 0 {
+		hooks := webhook.New(store, cfg.Webhooks)
+		srv.SetWebhooks(hooks)
+		life.OnStop("webhooks", hooks.Close)
+	}
+
+	// announce sensors and cameras whose heartbeat lapses
+	life.Go(func(ctx context.Context) { registry.Watch(30*time.Second, ctx.Done(), srv.Router().Offline) })
+
+	// arm and disarm on schedule
+	sched := schedule.New(bot)
+	sched.Set(cfg.Schedules)
+	life.Go(sched.Run)
+
+	// mirror state and events onto MQTT and take commands from there
+	var bridge *mqttbridge.Bridge
+	if cfg.MQTT.Addr != "" {
+		bridge = mqttbridge.New(mqttClient(cfg), cfg.Bridge(), store, bot)
+		// the bridge keeps publishing until its queue is drained on shutdown
+		if err := bridge.Start(context.Background()); err != nil {
+			log.Fatal("mqtt bridge: ", err)
+		}
+		// announce the alarm to Home Assistant under this discovery prefix
+		if prefix := cfg.MQTT.HADiscovery; prefix != "" {
+			if err := bridge.HomeAssistant(prefix, registry).Start(context.Background()); err != nil {
+				log.Fatal("home assistant: ", err)
+			}
+		}
+	}
+
+	// feed the panel's own events (keypad, sensors) to the bot
+	if follow {
+		idFile := streamIDFile(cfg)
+		life.Go(func(ctx context.Context) { followAlarmStream(ctx, panel, idFile, srv.Ingest) })
+	}
+	if cfg.MQTT.Addr != "" || cfg.Alarm.Driver == "mqtt" {
+		life.OnStop("mqtt", func(ctx context.Context) error {
+			var err error
+			if bridge != nil {
+				err = bridge.Close(ctx)
+			}
+			mqttClient(cfg).Close()
+			return err
+		})
+	}
+
+	life.OnStop("clip archive", func(context.Context) error { return clips.Sync() })
+	if msg := cfg.Telegram.OfflineNotice; msg != "" {
+		life.OnStop("offline notice", func(context.Context) error {
+			bot.NotifyOwners(msg)
+			return nil
+		})
+	}
+
+	// SIGHUP re-reads the config and applies what is safe to change live
+	go reloadOnHangup(cfgPath, cfg, func(next config.Config) error {
+		if err := srv.Reload(next.HTTP()); err != nil {
+			return err
+		}
+		bot.SetAccess(next.ACL())
+		sched.Set(next.Schedules)
+		return nil
+	})
+
+	metrics.NewGaugeFunc("alarm_armed", "1 while the system is armed.", func() float64 {
+		if store.Get() == state.Armed {
+			return 1
+		}
+		return 0
+	})
+	pollErrors := metrics.NewCounter("bot_poll_errors_total", "Failed getUpdates calls in the poll loop.")
 
-	// Telegram long-poll loop
+	// Telegram long-poll loop, until a signal or a failed listener
+	ctx := life.Context()
 	var offset int
-	for {
-		updates, err := tgAPI.GetUpdates(offset)
+	for ctx.Err() == nil {
+		updates, err := tgAPI.GetUpdates(ctx, offset)
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			pollErrors.Inc()
 			log.Println("getUpdates:", err)
-			time.Sleep(5 * time.Second)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
 			continue
 		}
 		for _, u := range updates {
@@ -53,4 +196,105 @@ func main() {
 			}
 		}
 	}
+
+	// a second signal kills the process without waiting for the shutdown
+	stopSignals()
+	log.Println("shutting down")
+	err = life.Shutdown(time.Duration(cfg.Limits.ShutdownTimeout))
+	if reason := life.Err(); reason != nil {
+		log.Fatal(reason)
+	}
+	if err != nil {
+		log.Fatal("shutdown incomplete")
+	}
+	log.Println("stopped")
+}
+
+// reloadOnHangup reloads the config from path on every SIGHUP and hands it
+// to apply. Invalid configs are rejected whole; settings that only take
+// effect on restart are logged.
+func reloadOnHangup(path string, cur config.Config, apply func(config.Config) error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		next, err := config.Load(path)
+		if err == nil {
+			err = apply(next)
+		}
+		if err != nil {
+			log.Printf("config reload rejected, keeping the running config:\n%v", err)
+			continue
+		}
+		for _, name := range cur.NeedsRestart(next) {
+			log.Printf("config reload: %s changed, restart to apply it", name)
+		}
+		cur = next
+		log.Println("config reloaded")
+	}
+}
+
+// openPanel builds the alarm backend chosen by alarm.driver (http, mqtt or
+// sim) and reports whether its event stream should be followed.
+func openPanel(cfg config.Config) (alarm.Panel, bool) {
+	switch cfg.Alarm.Driver {
+	case "http":
+		c := alarm.New(cfg.Alarm.BaseURL)
+		if err := c.Configure(cfg.AlarmConfig()); err != nil {
+			log.Fatal(err)
+		}
+		return c, cfg.Alarm.Stream != ""
+
+	case "mqtt":
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		p, err := alarm.NewMQTTPanel(ctx, mqttClient(cfg), cfg.Alarm.MQTTPrefix)
+		if err != nil {
+			log.Fatal("alarm mqtt: ", err)
+		}
+		return p, true
+
+	default: // "sim"; config.Validate has ruled out anything else
+		log.Println("warning: alarm driver sim, no real alarm panel is connected")
+		return alarm.NewSimulator(cfg.Alarm.SimPIN, cfg.Alarm.SimZones), true
+	}
+}
+
+var (
+	mqttOnce sync.Once
+	mqttConn *mqtt.Client
+)
+
+// mqttClient connects to mqtt.addr once and is shared by everything that
+// speaks MQTT. Its will marks the bridge offline.
+func mqttClient(cfg config.Config) *mqtt.Client {
+	mqttOnce.Do(func() { mqttConn = mqtt.Connect(cfg.MQTTOptions()) })
+	return mqttConn
+}
+
+// streamIDFile is where the last event ID from the panel's stream is kept,
+// or "" for drivers whose IDs do not outlive the process: the simulator
+// counts from 1 again on every start, and the mqtt driver has no replay.
+func streamIDFile(cfg config.Config) string {
+	if cfg.Alarm.Driver != "http" {
+		return ""
+	}
+	return filepath.Join(cfg.DataDir, "alarm-stream.id")
+}
+
+// followAlarmStream feeds the panel's events to ingest until ctx is done.
+// With an idFile the last event ID is kept there so a restart resumes where
+// it stopped.
+func followAlarmStream(ctx context.Context, p alarm.Panel, idFile string, ingest func(alarm.Event)) {
+	var last []byte
+	if idFile != "" {
+		last, _ = os.ReadFile(idFile)
+	}
+	_ = p.Subscribe(ctx, string(last), func(ev alarm.Event) {
+		ingest(ev)
+		if idFile != "" && ev.ID != "" {
+			if err := os.WriteFile(idFile, []byte(ev.ID), 0o600); err != nil {
+				log.Println("alarm stream:", err)
+			}
+		}
+	})
 }
@@ -1,44 +1,49 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
+
+	"home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/config"
 )
 
 /* ----------------------------------------------------------------------
-   Tests for mustEnv ------------------------------------------------------ */
-
-// TestMustEnvValue verifies that mustEnv returns the correct value when the
-// environment variable is present.
-func TestMustEnvValue(t *testing.T) {
-    const key, val = "TEST_ENV_VALUE", "hello-world"
-
-    t.Setenv(key, val)
-    if got := mustEnv(key); got != val {
-        t.Fatalf("mustEnv(%q) = %q, want %q", key, got, val)
-    }
-}
+   Tests for startup config ----------------------------------------------- */
 
-// TestMustEnvMissing checks that mustEnv terminates the process (log.Fatalf →
-// os.Exit(1)) when the variable is missing. We fork a helper process to observe
-// the exit status without killing the test runner itself.
-func TestMustEnvMissing(t *testing.T) {
+// TestMainBadConfig checks that main terminates the process (log.Fatalf →
+// os.Exit(1)) when the config is invalid, here because BOT_TOKEN is missing.
+// We fork a helper process to observe the exit status without killing the
+// test runner itself.
+func TestMainBadConfig(t *testing.T) {
     // When this env var is set, we are running inside the helper subprocess.
     if os.Getenv("GO_WANT_HELPER_PROCESS") == "1" {
-        mustEnv("SOME_UNSET_ENV")
-        return // unreachable — mustEnv should have exited.
+        main()
+        return // unreachable — main should have exited.
     }
 
-    cmd := exec.Command(os.Args[0], "-test.run=TestMustEnvMissing")
-    cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1")
+    cmd := exec.Command(os.Args[0], "-test.run=TestMainBadConfig")
+    cmd.Dir = t.TempDir() // no .env to pick a token up from
+    var env []string
+    for _, kv := range os.Environ() {
+        if !strings.HasPrefix(kv, "BOT_TOKEN=") && !strings.HasPrefix(kv, "CONFIG_FILE=") {
+            env = append(env, kv)
+        }
+    }
+    cmd.Env = append(env, "GO_WANT_HELPER_PROCESS=1")
 
-    err := cmd.Run()
+    out, err := cmd.CombinedOutput()
     if err == nil {
         t.Fatalf("expected process to exit with a non‑zero status")
     }
@@ -51,6 +56,9 @@ func TestMustEnvMissing(t *testing.T) {
     } else {
         t.Fatalf("unexpected error type: %v", err)
     }
+    if !strings.Contains(string(out), "telegram.token") {
+        t.Fatalf("output does not name the missing token:\n%s", out)
+    }
 }
 
 /* ----------------------------------------------------------------------
@@ -73,6 +81,7 @@ func TestMainFunction(t *testing.T) {
     // Provide the env vars that main() expects.
     t.Setenv("SERVER_BASE_URL", "http://alarm.local")
     t.Setenv("BOT_TOKEN", "TESTTOKEN")
+    t.Setenv("DATA_DIR", t.TempDir())
 
     // Replace the global default transport so every outbound request is served
     // by our stub (both Telegram and alarm client inherit it via http.Client{}).
@@ -110,3 +119,128 @@ func TestMainFunction(t *testing.T) {
     time.Sleep(100 * time.Millisecond)
     <-done // ensure the goroutine terminated via our panic
 }
+
+/* ----------------------------------------------------------------------
+   Graceful shutdown ------------------------------------------------------ */
+
+// TestMainSIGTERM runs main() in a helper process, sends it SIGTERM once it
+// is polling Telegram and checks that it shuts down in order, tells the
+// admin chat and exits cleanly.
+func TestMainSIGTERM(t *testing.T) {
+    if os.Getenv("GO_WANT_HELPER_PROCESS") == "sigterm" {
+        var polls atomic.Int32
+        http.DefaultTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+            switch {
+            case strings.Contains(r.URL.Path, "getUpdates") && polls.Add(1) == 1:
+                // chat 42 writes first, so it is subscribed
+                return &http.Response{
+                    StatusCode: http.StatusOK,
+                    Header:     make(http.Header),
+                    Body: io.NopCloser(strings.NewReader(
+                        `{"ok":true,"result":[{"update_id":1,"message":{"message_id":1,"chat":{"id":42},"text":"/status"}}]}`)),
+                }, nil
+            case strings.Contains(r.URL.Path, "getUpdates"):
+                fmt.Fprintln(os.Stderr, "polling")
+                select {
+                case <-r.Context().Done():
+                    return nil, r.Context().Err()
+                case <-time.After(50 * time.Millisecond):
+                }
+            case strings.Contains(r.URL.Path, "sendMessage"):
+                body, _ := io.ReadAll(r.Body)
+                fmt.Fprintln(os.Stderr, "sendMessage", string(body))
+            }
+            return &http.Response{
+                StatusCode: http.StatusOK,
+                Header:     make(http.Header),
+                Body:       io.NopCloser(strings.NewReader(`{"ok":true,"result":[]}`)),
+            }, nil
+        })
+        main()
+        return
+    }
+
+    cmd := exec.Command(os.Args[0], "-test.run=TestMainSIGTERM")
+    cmd.Dir = t.TempDir()
+    cmd.Env = append(os.Environ(),
+        "GO_WANT_HELPER_PROCESS=sigterm",
+        "CONFIG_FILE=",
+        "BOT_TOKEN=TESTTOKEN",
+        "ALARM_DRIVER=sim",
+        "LISTEN_ADDR=127.0.0.1:0",
+        "DATA_DIR="+t.TempDir(),
+        "TELEGRAM_CHATS=42:admin",
+        "OFFLINE_NOTICE=bot going offline",
+    )
+    stderr, err := cmd.StderrPipe()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := cmd.Start(); err != nil {
+        t.Fatal(err)
+    }
+
+    // Signal once the poll loop runs, then collect the rest of the log.
+    var out strings.Builder
+    sc := bufio.NewScanner(stderr)
+    for sc.Scan() {
+        out.WriteString(sc.Text() + "\n")
+        if sc.Text() == "polling" {
+            _ = cmd.Process.Signal(syscall.SIGTERM)
+            break
+        }
+    }
+    for sc.Scan() {
+        out.WriteString(sc.Text() + "\n")
+    }
+
+    if err := cmd.Wait(); err != nil {
+        t.Fatalf("exit: %v\n%s", err, out.String())
+    }
+    log := out.String()
+    for _, want := range []string{"shutting down", "shutdown: http server done", "shutdown: clip archive done", "chat_id=42&text=bot+going+offline", "stopped"} {
+        if !strings.Contains(log, want) {
+            t.Errorf("log lacks %q:\n%s", want, log)
+        }
+    }
+    if strings.Index(log, "shutdown: http server") > strings.Index(log, "shutdown: offline notice") {
+        t.Errorf("offline notice sent before the HTTP server stopped:\n%s", log)
+    }
+}
+
+/* ----------------------------------------------------------------------
+   Alarm stream ------------------------------------------------------------ */
+
+// TestFollowAlarmStreamSimRestart checks that an ID saved by an earlier run
+// does not hide the simulator's events, whose IDs start at 1 again.
+func TestFollowAlarmStreamSimRestart(t *testing.T) {
+    cfg := config.Default()
+    cfg.DataDir = t.TempDir()
+    if err := os.WriteFile(filepath.Join(cfg.DataDir, "alarm-stream.id"), []byte("7"), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    cfg.Alarm.Driver = "http"
+    if got := streamIDFile(cfg); got != filepath.Join(cfg.DataDir, "alarm-stream.id") {
+        t.Fatalf("http driver: streamIDFile = %q", got)
+    }
+    cfg.Alarm.Driver = "sim"
+    idFile := streamIDFile(cfg)
+    if idFile != "" {
+        t.Fatalf("sim driver: streamIDFile = %q", idFile)
+    }
+
+    sim := alarm.NewSimulator("1234", nil)
+    sim.Inject(alarm.Event{Type: "armed"})
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+    defer cancel()
+    got := make(chan alarm.Event, 1)
+    go followAlarmStream(ctx, sim, idFile, func(ev alarm.Event) { got <- ev })
+    select {
+    case ev := <-got:
+        if ev.ID != "1" {
+            t.Fatalf("event ID = %q", ev.ID)
+        }
+    case <-ctx.Done():
+        t.Fatal("event 1 skipped")
+    }
+}
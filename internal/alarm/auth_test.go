@@ -0,0 +1,132 @@
+package alarm
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClient_SignsRequests(t *testing.T) {
+	const secret = "s3cret"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			t.Errorf("auth header = %q", r.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(secret))
+		fmt.Fprintf(mac, "%s\n%s\n%s\n%s", r.Header.Get("X-Timestamp"), r.Method, r.URL.RequestURI(), body)
+		if r.Header.Get("X-Client") != "bot" || r.Header.Get("X-Signature") != hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("%s %s: bad signature headers %v", r.Method, r.URL, r.Header)
+		}
+		w.Write([]byte("ARMED"))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	cfg := DefaultConfig()
+	cfg.AuthHeader, cfg.ClientName, cfg.Secret = "Authorization: Bearer abc", "bot", secret
+	if err := c.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := c.Arm(ctx, ArmHome, []string{"garage"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ChangePIN(ctx, "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.AuthHeader = "no colon"
+	if err := c.Configure(cfg); err == nil {
+		t.Fatal("malformed auth header accepted")
+	}
+}
+
+// writePEM stores der as a PEM block of the given type in dir/name.
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestClient_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	// A self-signed client certificate the server trusts.
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "bot"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "bot" {
+			t.Error("no client certificate")
+		}
+		w.Write([]byte("DISARMED"))
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCert)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.Retries = 0
+	cfg.CAFile = writePEM(t, dir, "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+
+	// Trusting the server is not enough without a client certificate.
+	c := New(srv.URL)
+	if err := c.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Status(context.Background()); err == nil {
+		t.Fatal("server accepted a client without a certificate")
+	}
+
+	cfg.CertFile = writePEM(t, dir, "client.pem", "CERTIFICATE", der)
+	cfg.KeyFile = writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER)
+	if err := c.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := c.Status(context.Background()); err != nil || st != "DISARMED" {
+		t.Fatalf("Status() = %q, %v", st, err)
+	}
+	if tr := c.http.Transport.(*http.Transport); tr.TLSHandshakeTimeout == 0 || tr.IdleConnTimeout == 0 || tr.DialContext == nil {
+		t.Fatal("TLS transport lost the default timeouts")
+	}
+
+	cfg.KeyFile = ""
+	if err := c.Configure(cfg); err == nil {
+		t.Fatal("certificate without key accepted")
+	}
+}
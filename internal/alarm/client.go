@@ -1,50 +1,157 @@
 package alarm
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
+
+	"home-alarm-bot/internal/metrics"
 )
 
+// Client drives a panel through the alarm server's HTTP API.
 type Client struct {
     base string
     http *http.Client
+    tls  *tls.Config // nil for the system defaults
+    cfg  Config
+    cb   *breaker
 }
 
-func New(base string) *Client {
-    return &Client{base: strings.TrimRight(base, "/"), http: &http.Client{}}
+var _ Panel = (*Client)(nil)
+
+var (
+    requestLatency = metrics.NewHistogram("alarm_request_duration_seconds",
+        "Alarm server request latency per attempt, by path.", metrics.DefBuckets, "path")
+    requestErrors = metrics.NewCounter("alarm_request_errors_total",
+        "Failed alarm server requests per attempt, by path; calls refused by the open circuit count too.", "path")
+)
+
+// Config bounds how long the client waits for the alarm server and how
+// hard it tries.
+type Config struct {
+    // Timeout caps a single request, including reading the response.
+    Timeout time.Duration
+    // Retries is how many times an idempotent call (Status, Zones) is repeated
+    // after a network error or 5xx, with jittered exponential backoff
+    // starting at RetryDelay.
+    Retries    int
+    RetryDelay time.Duration
+    // After FailureThreshold consecutive failed calls the circuit opens and
+    // every call fails with ErrUnavailable for Cooldown; then one call is let
+    // through to probe the server.
+    FailureThreshold int
+    Cooldown         time.Duration
+
+    // TLS: CAFile is a PEM bundle trusted instead of the system roots;
+    // CertFile and KeyFile are a client certificate for mutual TLS.
+    CAFile   string
+    CertFile string
+    KeyFile  string
+
+    // AuthHeader is sent with every request, e.g. "Authorization: Bearer x".
+    AuthHeader string
+    // With Secret set every request is signed; see sign.
+    ClientName string
+    Secret     string
+
+    // Stream is how Subscribe reaches the event stream; SSE if empty.
+    Stream StreamMode
 }
 
-/* state-changing commands use GET */
+// DefaultConfig returns the limits used by New.
+func DefaultConfig() Config {
+    return Config{
+        Timeout:          5 * time.Second,
+        Retries:          2,
+        RetryDelay:       200 * time.Millisecond,
+        FailureThreshold: 5,
+        Cooldown:         30 * time.Second,
+    }
+}
 
-func (c *Client) Arm() error    { return c.simpleGet("/arm") }
-func (c *Client) Disarm() error { return c.simpleGet("/disarm") }
+// ErrUnavailable is returned without contacting the server while the circuit
+// breaker is open.
+var ErrUnavailable = errors.New("alarm server unavailable")
 
-func (c *Client) simpleGet(path string) error {
-    res, err := c.http.Get(c.base + path)
+// New returns a Client using DefaultConfig. Its http.Client has no overall
+// timeout, which would cut off Subscribe; requests are bounded through their
+// contexts instead.
+func New(base string) *Client {
+    c := &Client{base: strings.TrimRight(base, "/")}
+    _ = c.Configure(DefaultConfig())
+    return c
+}
+
+// Configure replaces the client's Config and resets the circuit breaker. It
+// fails if the certificates cannot be loaded or AuthHeader is malformed.
+func (c *Client) Configure(cfg Config) error {
+    tc, err := loadTLS(cfg)
     if err != nil {
         return err
     }
-    if res.StatusCode != http.StatusOK {
-        return fmt.Errorf("alarm returned %s", res.Status)
+    if cfg.AuthHeader != "" {
+        if _, _, ok := strings.Cut(cfg.AuthHeader, ":"); !ok {
+            return errors.New(`alarm auth header: want "Name: value"`)
+        }
+    }
+    if tc != nil {
+        // start from the default transport to keep its dial, handshake
+        // and idle timeouts; tests may have swapped it for a stub
+        t, ok := http.DefaultTransport.(*http.Transport)
+        if ok {
+            t = t.Clone()
+        } else {
+            t = &http.Transport{Proxy: http.ProxyFromEnvironment}
+        }
+        t.TLSClientConfig = tc
+        c.http = &http.Client{Transport: t}
+    } else {
+        c.http = &http.Client{}
     }
+    c.tls, c.cfg = tc, cfg
+    c.cb = &breaker{threshold: cfg.FailureThreshold, cooldown: cfg.Cooldown}
     return nil
 }
 
-/* status endpoint */
+/* state-changing commands use GET; they are not retried because a request
+   that timed out may still have reached the panel */
 
-func (c *Client) Status() (string, error) {
-    res, err := c.http.Get(c.base + "/status")
-    if err != nil {
-        return "", err
+// Arm arms the panel as /arm, with ?mode=home|night for modes other than
+// away and ?bypass=garage,porch for excluded zones.
+func (c *Client) Arm(ctx context.Context, mode ArmMode, bypass []string) error {
+    q := url.Values{}
+    if mode != "" && mode != ArmAway {
+        q.Set("mode", string(mode))
     }
-    defer res.Body.Close()
+    if len(bypass) > 0 {
+        q.Set("bypass", strings.Join(bypass, ","))
+    }
+    path := "/arm"
+    if len(q) > 0 {
+        path += "?" + q.Encode()
+    }
+    return c.simpleGet(ctx, path)
+}
+func (c *Client) Disarm(ctx context.Context) error { return c.simpleGet(ctx, "/disarm") }
 
-    // read the whole payload once
-    data, err := io.ReadAll(res.Body)
+func (c *Client) simpleGet(ctx context.Context, path string) error {
+    _, err := c.do(ctx, http.MethodGet, path, nil, false)
+    return err
+}
+
+/* status endpoint */
+
+func (c *Client) Status(ctx context.Context) (string, error) {
+    data, err := c.do(ctx, http.MethodGet, "/status", nil, true)
     if err != nil {
         return "", err
     }
@@ -61,14 +168,165 @@ func (c *Client) Status() (string, error) {
     return strings.ToUpper(strings.TrimSpace(string(data))), nil
 }
 
-func (c *Client) ChangePIN(pin string) error {
-    u := fmt.Sprintf("%s/change_pin?pin=%s", c.base, url.QueryEscape(pin))
-    res, err := c.http.Get(u)
+// Zones reads /zones, a JSON array of zone names.
+func (c *Client) Zones(ctx context.Context) ([]string, error) {
+    data, err := c.do(ctx, http.MethodGet, "/zones", nil, true)
     if err != nil {
-        return err
+        return nil, err
+    }
+    var zones []string
+    if err := json.Unmarshal(data, &zones); err != nil {
+        return nil, fmt.Errorf("alarm /zones: %w", err)
+    }
+    return zones, nil
+}
+
+// ChangePIN POSTs {"pin":"1234"} to /change_pin, keeping the PIN out of
+// URLs and access logs.
+func (c *Client) ChangePIN(ctx context.Context, pin string) error {
+    body, _ := json.Marshal(struct {
+        PIN string `json:"pin"`
+    }{pin})
+    _, err := c.do(ctx, http.MethodPost, "/change_pin", body, false)
+    return err
+}
+
+// statusError is a non-200 answer. Only 5xx counts against the server.
+type statusError struct {
+    status string
+    code   int
+}
+
+func (e *statusError) Error() string { return "alarm returned " + e.status }
+
+// do sends method to path and returns the body of a 200 response. Idempotent calls are
+// retried on network errors and 5xx; the outcome feeds the circuit breaker.
+// Per-attempt timeouts count as failures, cancellation by ctx does not.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, idempotent bool) ([]byte, error) {
+    if !c.cb.allow(time.Now()) {
+        requestErrors.Inc(metricPath(path))
+        return nil, ErrUnavailable
+    }
+    attempts := 1
+    if idempotent {
+        attempts += c.cfg.Retries
+    }
+
+    var data []byte
+    var err error
+    for i := 0; i < attempts; i++ {
+        if i > 0 {
+            select {
+            case <-ctx.Done():
+                return nil, ctx.Err()
+            case <-time.After(jitter(c.cfg.RetryDelay << (i - 1))):
+            }
+        }
+        start := time.Now()
+        data, err = c.send(ctx, method, path, body)
+        requestLatency.Since(start, metricPath(path))
+        if err != nil {
+            requestErrors.Inc(metricPath(path))
+        }
+        if !retryable(err) || ctx.Err() != nil {
+            break
+        }
+    }
+    if ctx.Err() == nil { // the caller giving up says nothing about the server
+        c.cb.record(time.Now(), !retryable(err))
+    }
+    return data, err
+}
+
+// metricPath drops the query from path so it makes a bounded label.
+func metricPath(path string) string {
+    p, _, _ := strings.Cut(path, "?")
+    return p
+}
+
+// send performs one request bounded by the configured Timeout.
+func (c *Client) send(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+    if c.cfg.Timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+        defer cancel()
+    }
+    req, err := c.newRequest(ctx, method, path, body)
+    if err != nil {
+        return nil, err
+    }
+    res, err := c.http.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer res.Body.Close()
+    data, err := io.ReadAll(res.Body)
+    if err != nil {
+        return nil, err
     }
     if res.StatusCode != http.StatusOK {
-        return fmt.Errorf("alarm returned %s", res.Status)
+        return nil, &statusError{res.Status, res.StatusCode}
     }
-    return nil
-}
\ No newline at end of file
+    return data, nil
+}
+
+// retryable reports whether err says the server is unhealthy (as opposed to
+// rejecting the request).
+func retryable(err error) bool {
+    var se *statusError
+    if errors.As(err, &se) {
+        return se.code >= 500
+    }
+    return err != nil
+}
+
+// jitter spreads d over [d/2, 3d/2) so retries from many callers do not line up.
+func jitter(d time.Duration) time.Duration {
+    if d <= 0 {
+        return 0
+    }
+    return d/2 + rand.N(d)
+}
+
+/* ----------------------------------------------------------------------
+   Circuit breaker */
+
+type breaker struct {
+    threshold int
+    cooldown  time.Duration
+
+    mu        sync.Mutex
+    failures  int
+    openUntil time.Time
+}
+
+// allow reports whether a call may go ahead. Once the cooldown has passed a
+// single probe is let through; the breaker re-opens if it fails.
+func (b *breaker) allow(now time.Time) bool {
+    if b.threshold <= 0 {
+        return true
+    }
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.failures < b.threshold {
+        return true
+    }
+    if now.Before(b.openUntil) {
+        return false
+    }
+    b.openUntil = now.Add(b.cooldown) // half-open: hold others back during the probe
+    return true
+}
+
+func (b *breaker) record(now time.Time, ok bool) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if ok {
+        b.failures = 0
+        return
+    }
+    b.failures++
+    if b.failures >= b.threshold {
+        b.openUntil = now.Add(b.cooldown)
+    }
+}
@@ -1,10 +1,15 @@
 package alarm
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type roundTripperFunc func(*http.Request) (*http.Response, error)
@@ -40,7 +45,7 @@ func TestStatus_JsonAndPlain(t *testing.T) {
             defer srv.Close()
 
             c := New(srv.URL) // default http.Client is fine
-            got, err := c.Status()
+            got, err := c.Status(context.Background())
             if err != nil {
                 t.Fatalf("Status() error = %v", err)
             }
@@ -61,7 +66,7 @@ func TestStatus_InvalidJSONFallback(t *testing.T) {
     defer srv.Close()
 
     c := New(srv.URL)
-    got, err := c.Status()
+    got, err := c.Status(context.Background())
     if err != nil {
         t.Fatalf("Status() error = %v", err)
     }
@@ -85,10 +90,10 @@ func TestArmAndDisarm_OK(t *testing.T) {
     defer srv.Close()
 
     c := New(srv.URL)
-    if err := c.Arm(); err != nil {
+    if err := c.Arm(context.Background(), ArmAway, nil); err != nil {
         t.Fatalf("Arm() error = %v", err)
     }
-    if err := c.Disarm(); err != nil {
+    if err := c.Disarm(context.Background()); err != nil {
         t.Fatalf("Disarm() error = %v", err)
     }
 }
@@ -96,23 +101,25 @@ func TestArmAndDisarm_OK(t *testing.T) {
 /* ----------------------------------------------------------------------
 ChangePIN ---------------------------------------------------------------- */
 
-func TestChangePIN_SuccessAndEscaping(t *testing.T) {
-    const pin = " 42&%$! " // contains characters that must be percent‑escaped
+func TestChangePIN_PostsBody(t *testing.T) {
+    const pin = " 42&%$! " // must survive the round trip untouched
 
     srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        if r.URL.Path != "/change_pin" {
-            t.Fatalf("unexpected path: %s", r.URL.Path)
+        if r.Method != http.MethodPost || r.URL.Path != "/change_pin" || r.URL.RawQuery != "" {
+            t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+        }
+        var body struct {
+            PIN string `json:"pin"`
         }
-        // query is automatically unescaped by r.URL.Query()
-        if got := r.URL.Query().Get("pin"); got != pin {
-            t.Fatalf("pin not round‑tripped: got %q, want %q", got, pin)
+        if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.PIN != pin {
+            t.Errorf("pin not round‑tripped: got %q (%v), want %q", body.PIN, err, pin)
         }
         w.WriteHeader(http.StatusOK)
     }))
     defer srv.Close()
 
     c := New(srv.URL)
-    if err := c.ChangePIN(pin); err != nil {
+    if err := c.ChangePIN(context.Background(), pin); err != nil {
         t.Fatalf("ChangePIN() error = %v", err)
     }
 }
@@ -124,7 +131,7 @@ func TestChangePIN_ErrorFromServer(t *testing.T) {
     defer srv.Close()
 
     c := New(srv.URL)
-    if err := c.ChangePIN("1234"); err == nil {
+    if err := c.ChangePIN(context.Background(), "1234"); err == nil {
         t.Fatalf("expected error on 500 response")
     }
 }
@@ -139,7 +146,7 @@ func TestSimpleGet_Non200(t *testing.T) {
     defer srv.Close()
 
     c := New(srv.URL)
-    if err := c.Arm(); err == nil {
+    if err := c.Arm(context.Background(), ArmAway, nil); err == nil {
         t.Fatalf("expected error when alarm returns non‑200")
     }
 }
@@ -152,7 +159,118 @@ func TestSimpleGet_ClientError(t *testing.T) {
         return nil, fmt.Errorf("network kaboom")
     })}
 
-    if err := c.Arm(); err == nil {
+    if err := c.Arm(context.Background(), ArmAway, nil); err == nil {
         t.Fatalf("expected error from underlying http.Client")
     }
-}
\ No newline at end of file
+}
+func TestArm_ModeAndBypass(t *testing.T) {
+    var got []string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/arm" {
+            t.Fatalf("unexpected path: %s", r.URL.Path)
+        }
+        got = append(got, r.URL.RawQuery)
+        w.WriteHeader(http.StatusOK)
+    }))
+    defer srv.Close()
+
+    c := New(srv.URL)
+    ctx := context.Background()
+    if err := c.Arm(ctx, ArmAway, []string{"garage", "porch"}); err != nil {
+        t.Fatalf("Arm() error = %v", err)
+    }
+    if err := c.Arm(ctx, ArmNight, nil); err != nil {
+        t.Fatalf("Arm() error = %v", err)
+    }
+    if want := []string{"bypass=garage%2Cporch", "mode=night"}; fmt.Sprint(got) != fmt.Sprint(want) {
+        t.Fatalf("queries = %q, want %q", got, want)
+    }
+}
+
+/* ----------------------------------------------------------------------
+Timeouts, retries and the circuit breaker -------------------------------- */
+
+func fastConfig() Config {
+    return Config{Timeout: 50 * time.Millisecond, Retries: 2, RetryDelay: time.Millisecond,
+        FailureThreshold: 2, Cooldown: 50 * time.Millisecond}
+}
+
+func TestStatus_RetriesOn5xx(t *testing.T) {
+    var calls int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if atomic.AddInt32(&calls, 1) < 3 {
+            w.WriteHeader(http.StatusBadGateway)
+            return
+        }
+        w.Write([]byte("ARMED"))
+    }))
+    defer srv.Close()
+
+    c := New(srv.URL)
+    c.Configure(fastConfig())
+    if st, err := c.Status(context.Background()); err != nil || st != "ARMED" {
+        t.Fatalf("Status() = %q, %v", st, err)
+    }
+    if calls != 3 {
+        t.Fatalf("calls = %d, want 3", calls)
+    }
+
+    // Commands are attempted once, and 4xx is never retried.
+    calls = 0
+    srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&calls, 1)
+        w.WriteHeader(http.StatusServiceUnavailable)
+    })
+    if err := c.Arm(context.Background(), ArmAway, nil); err == nil || calls != 1 {
+        t.Fatalf("Arm() = %v after %d calls, want one failed call", err, calls)
+    }
+}
+
+func TestClient_TimeoutAndBreaker(t *testing.T) {
+    var calls int32
+    hang := make(chan struct{})
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&calls, 1)
+        select {
+        case <-hang:
+            w.Write([]byte("DISARMED"))
+        case <-r.Context().Done():
+        }
+    }))
+    defer srv.Close()
+    defer close(hang)
+
+    c := New(srv.URL)
+    cfg := fastConfig()
+    cfg.Retries = 0
+    c.Configure(cfg)
+
+    start := time.Now()
+    for i := 0; i < 2; i++ {
+        if _, err := c.Status(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+            t.Fatalf("call %d: err = %v, want deadline exceeded", i, err)
+        }
+    }
+    if d := time.Since(start); d > time.Second {
+        t.Fatalf("timed out calls took %s", d)
+    }
+
+    // The breaker is now open: fail fast without touching the server.
+    before := atomic.LoadInt32(&calls)
+    if err := c.Disarm(context.Background()); !errors.Is(err, ErrUnavailable) || err.Error() != "alarm server unavailable" {
+        t.Fatalf("open breaker err = %v", err)
+    }
+    if atomic.LoadInt32(&calls) != before {
+        t.Fatal("open breaker still contacted the server")
+    }
+
+    // After the cooldown one probe goes through and closes it again.
+    time.Sleep(cfg.Cooldown)
+    srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ARMED")) })
+    if st, err := c.Status(context.Background()); err != nil || st != "ARMED" {
+        t.Fatalf("probe = %q, %v", st, err)
+    }
+    if err := c.Arm(context.Background(), ArmAway, nil); err != nil {
+        t.Fatalf("closed breaker: %v", err)
+    }
+}
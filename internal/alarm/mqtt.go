@@ -0,0 +1,192 @@
+package alarm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"home-alarm-bot/internal/mqtt"
+)
+
+// MQTTPanel drives a panel that speaks MQTT under a topic prefix:
+//
+//	<prefix>/state         retained "ARMED" or "DISARMED", or {"state":...}
+//	<prefix>/zones         retained JSON array of zone names
+//	<prefix>/availability  retained "online" or "offline" (the panel's will)
+//	<prefix>/events        JSON Event objects
+//	<prefix>/command       written by the bot: {"action":"arm","mode":"home",
+//	                       "bypass":["garage"]}, {"action":"disarm"} or
+//	                       {"action":"change_pin","pin":"1234"}
+//
+// Commands are published at QoS 1, so success means the broker took them;
+// the panel confirms by updating its state topic.
+type MQTTPanel struct {
+	c      *mqtt.Client
+	prefix string
+
+	mu      sync.Mutex
+	state   string
+	zones   []string
+	offline bool
+}
+
+var _ Panel = (*MQTTPanel)(nil)
+
+// NewMQTTPanel follows the panel under prefix (e.g. "alarm/panel") on c.
+func NewMQTTPanel(ctx context.Context, c *mqtt.Client, prefix string) (*MQTTPanel, error) {
+	p := &MQTTPanel{c: c, prefix: strings.TrimRight(prefix, "/")}
+	if err := c.Subscribe(ctx, p.prefix+"/state", 1, p.onState); err != nil {
+		return nil, err
+	}
+	if err := c.Subscribe(ctx, p.prefix+"/zones", 1, p.onZones); err != nil {
+		return nil, err
+	}
+	if err := c.Subscribe(ctx, p.prefix+"/availability", 1, p.onAvailability); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *MQTTPanel) onState(m mqtt.Message) {
+	st := strings.TrimSpace(string(m.Payload))
+	var r struct {
+		State string `json:"state"`
+	}
+	if json.Unmarshal(m.Payload, &r) == nil && r.State != "" {
+		st = r.State
+	}
+	p.mu.Lock()
+	p.state = strings.ToUpper(st)
+	p.mu.Unlock()
+}
+
+func (p *MQTTPanel) onZones(m mqtt.Message) {
+	var zones []string
+	if json.Unmarshal(m.Payload, &zones) != nil {
+		return
+	}
+	p.mu.Lock()
+	p.zones = zones
+	p.mu.Unlock()
+}
+
+func (p *MQTTPanel) onAvailability(m mqtt.Message) {
+	p.mu.Lock()
+	p.offline = strings.TrimSpace(string(m.Payload)) == "offline"
+	p.mu.Unlock()
+}
+
+// command is the JSON published to <prefix>/command.
+type command struct {
+	Action string   `json:"action"`
+	Mode   ArmMode  `json:"mode,omitempty"`
+	Bypass []string `json:"bypass,omitempty"`
+	PIN    string   `json:"pin,omitempty"`
+}
+
+func (p *MQTTPanel) send(ctx context.Context, cmd command) error {
+	if err := p.available(); err != nil {
+		return err
+	}
+	payload, _ := json.Marshal(cmd)
+	err := p.c.Publish(ctx, mqtt.Message{Topic: p.prefix + "/command", Payload: payload, QoS: 1})
+	if errors.Is(err, mqtt.ErrNotConnected) {
+		return ErrUnavailable
+	}
+	return err
+}
+
+func (p *MQTTPanel) available() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.offline || !p.c.Connected() {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+func (p *MQTTPanel) Arm(ctx context.Context, mode ArmMode, bypass []string) error {
+	if mode == "" {
+		mode = ArmAway
+	}
+	return p.send(ctx, command{Action: "arm", Mode: mode, Bypass: bypass})
+}
+
+func (p *MQTTPanel) Disarm(ctx context.Context) error {
+	return p.send(ctx, command{Action: "disarm"})
+}
+
+func (p *MQTTPanel) ChangePIN(ctx context.Context, pin string) error {
+	return p.send(ctx, command{Action: "change_pin", PIN: pin})
+}
+
+// Status returns the last retained state, or ErrUnavailable while the panel
+// is offline or has not reported yet.
+func (p *MQTTPanel) Status(ctx context.Context) (string, error) {
+	if err := p.available(); err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state == "" {
+		return "", ErrUnavailable
+	}
+	return p.state, nil
+}
+
+func (p *MQTTPanel) Zones(ctx context.Context) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.zones...), nil
+}
+
+// eventQueue bounds the events waiting for Subscribe's handler. Further ones
+// are dropped rather than stall the client, which delivers state, zones and
+// every other subscription from a single goroutine.
+const eventQueue = 64
+
+// unsubscribeTimeout bounds the UNSUBSCRIBE sent once Subscribe's ctx ends.
+const unsubscribeTimeout = 5 * time.Second
+
+// Subscribe delivers <prefix>/events until ctx is done. MQTT has no replay,
+// so lastID is only used to drop an event seen just before a restart.
+func (p *MQTTPanel) Subscribe(ctx context.Context, lastID string, handle func(Event)) error {
+	topic := p.prefix + "/events"
+	events := make(chan Event, eventQueue)
+	err := p.c.Subscribe(ctx, topic, 1, func(m mqtt.Message) {
+		var ev Event
+		if json.Unmarshal(m.Payload, &ev) != nil {
+			return
+		}
+		select {
+		case events <- ev:
+		default:
+			log.Printf("alarm mqtt: event queue full, dropping %s event %s", ev.Type, ev.ID)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		uctx, cancel := context.WithTimeout(context.Background(), unsubscribeTimeout)
+		defer cancel()
+		if err := p.c.Unsubscribe(uctx, topic); err != nil {
+			log.Printf("alarm mqtt: unsubscribe %s: %v", topic, err)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev := <-events:
+			if ev.ID != "" && ev.ID == lastID {
+				continue
+			}
+			handle(ev)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package alarm
+
+import (
+	"context"
+	"fmt"
+)
+
+// Panel is an alarm backend. *Client (HTTP), *MQTTPanel and *Simulator
+// implement it.
+type Panel interface {
+	// Arm arms in the given mode with zones excluded.
+	Arm(ctx context.Context, mode ArmMode, bypass []string) error
+	Disarm(ctx context.Context) error
+	// Status reports "ARMED" or "DISARMED".
+	Status(ctx context.Context) (string, error)
+	ChangePIN(ctx context.Context, pin string) error
+	// Zones lists the zones the panel knows.
+	Zones(ctx context.Context) ([]string, error)
+	// Subscribe calls handle for every event after lastID until ctx is
+	// done, and returns ctx.Err().
+	Subscribe(ctx context.Context, lastID string, handle func(Event)) error
+}
+
+// ArmMode is how the panel is armed.
+type ArmMode string
+
+const (
+	// ArmAway arms every zone; it is the default.
+	ArmAway ArmMode = "away"
+	// ArmHome leaves interior zones off while someone is home.
+	ArmHome ArmMode = "home"
+	// ArmNight arms the perimeter and the zones nobody uses at night.
+	ArmNight ArmMode = "night"
+)
+
+// ParseArmMode accepts "away", "home" or "night"; empty means ArmAway.
+func ParseArmMode(s string) (ArmMode, error) {
+	switch m := ArmMode(s); m {
+	case "":
+		return ArmAway, nil
+	case ArmAway, ArmHome, ArmNight:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown arm mode %q (want away, home or night)", s)
+	}
+}
@@ -0,0 +1,155 @@
+package alarm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"home-alarm-bot/internal/mqtt"
+	"home-alarm-bot/internal/mqtt/mqtttest"
+	"home-alarm-bot/internal/testutil"
+)
+
+func TestParseArmMode(t *testing.T) {
+	if m, err := ParseArmMode(""); err != nil || m != ArmAway {
+		t.Fatalf(`ParseArmMode("") = %q, %v`, m, err)
+	}
+	if m, err := ParseArmMode("night"); err != nil || m != ArmNight {
+		t.Fatalf(`ParseArmMode("night") = %q, %v`, m, err)
+	}
+	if _, err := ParseArmMode("vacation"); err == nil {
+		t.Fatal("unknown mode accepted")
+	}
+}
+
+func TestClient_Zones(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["garage","porch"]`))
+	}))
+	defer srv.Close()
+	zones, err := New(srv.URL).Zones(context.Background())
+	if err != nil || len(zones) != 2 || zones[1] != "porch" {
+		t.Fatalf("Zones() = %v, %v", zones, err)
+	}
+}
+
+func TestSimulator(t *testing.T) {
+	ctx := context.Background()
+	s := NewSimulator("1234", []string{"garage"})
+	if err := s.Arm(ctx, ArmHome, []string{"attic"}); err == nil {
+		t.Fatal("bypassing an unknown zone succeeded")
+	}
+	_ = s.Arm(ctx, ArmHome, []string{"garage"})
+	if st, _ := s.Status(ctx); st != "ARMED" || s.Mode() != ArmHome {
+		t.Fatalf("after Arm: %s %s", st, s.Mode())
+	}
+	if err := s.ChangePIN(ctx, "12"); err == nil || !s.CheckPIN("1234") {
+		t.Fatal("short PIN accepted")
+	}
+
+	s.Inject(Event{Type: "alarm"})
+	s.Inject(Event{Type: "disarmed"})
+	if st, _ := s.Status(ctx); st != "DISARMED" {
+		t.Fatalf("injected disarm left state %s", st)
+	}
+
+	// Resuming after event 1 replays only event 2, then follows live ones.
+	sub, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	var got []string
+	go func() { time.Sleep(10 * time.Millisecond); s.Inject(Event{Type: "armed"}) }()
+	_ = s.Subscribe(sub, "1", func(ev Event) {
+		got = append(got, ev.ID+ev.Type)
+		if len(got) == 2 {
+			cancel()
+		}
+	})
+	if len(got) != 2 || got[0] != "2disarmed" || got[1] != "3armed" {
+		t.Fatalf("events = %v", got)
+	}
+}
+
+func TestMQTTPanel(t *testing.T) {
+	b := mqtttest.NewBroker()
+	addr, err := b.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := mqtt.Connect(mqtt.Options{Addr: addr, ClientID: "bot"})
+	defer c.Close()
+	if err := c.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewMQTTPanel(ctx, c, "alarm/panel/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Status(ctx); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Status before any report = %v", err)
+	}
+
+	commands := make(chan string, 1)
+	panel := mqtt.Connect(mqtt.Options{Addr: addr, ClientID: "panel"})
+	defer panel.Close()
+	_ = panel.WaitConnected(ctx)
+	_ = panel.Subscribe(ctx, "alarm/panel/command", 1, func(m mqtt.Message) { commands <- string(m.Payload) })
+	_ = panel.Publish(ctx, mqtt.Message{Topic: "alarm/panel/state", Payload: []byte(`{"state":"armed"}`), QoS: 1, Retain: true})
+	_ = panel.Publish(ctx, mqtt.Message{Topic: "alarm/panel/zones", Payload: []byte(`["garage"]`), QoS: 1, Retain: true})
+
+	testutil.WaitFor(t, "armed state", func() bool { st, _ := p.Status(ctx); return st == "ARMED" })
+	// the zones are published after the state and may still be on the way
+	testutil.WaitFor(t, "zones", func() bool { z, _ := p.Zones(ctx); return len(z) == 1 && z[0] == "garage" })
+
+	if err := p.Arm(ctx, ArmHome, []string{"garage"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-commands; got != `{"action":"arm","mode":"home","bypass":["garage"]}` {
+		t.Fatalf("command = %s", got)
+	}
+
+	events := make(chan Event, 1)
+	sub, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- p.Subscribe(sub, "", func(ev Event) { events <- ev }) }()
+	testutil.WaitFor(t, "event 9", func() bool {
+		_ = panel.Publish(ctx, mqtt.Message{Topic: "alarm/panel/events", Payload: []byte(`{"id":"9","type":"alarm"}`)})
+		select {
+		case ev := <-events:
+			return ev.ID == "9" && ev.Type == "alarm"
+		case <-time.After(20 * time.Millisecond):
+			return false
+		}
+	})
+	stop()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Subscribe = %v after cancel", err)
+	}
+
+	// A handler that never returns must not hold up the state topic, which
+	// shares the client's delivery goroutine.
+	release := make(chan struct{})
+	sub, stop = context.WithCancel(ctx)
+	go func() { done <- p.Subscribe(sub, "", func(Event) { <-release }) }()
+	testutil.WaitFor(t, "state past a stuck handler", func() bool {
+		for range eventQueue + 2 {
+			_ = panel.Publish(ctx, mqtt.Message{Topic: "alarm/panel/events", Payload: []byte(`{"type":"alarm"}`)})
+		}
+		_ = panel.Publish(ctx, mqtt.Message{Topic: "alarm/panel/state", Payload: []byte("DISARMED"), QoS: 1, Retain: true})
+		st, _ := p.Status(ctx)
+		return st == "DISARMED"
+	})
+	stop()
+	close(release)
+	<-done
+
+	_ = panel.Publish(ctx, mqtt.Message{Topic: "alarm/panel/availability", Payload: []byte("offline"), QoS: 1, Retain: true})
+	testutil.WaitFor(t, "panel offline", func() bool { return errors.Is(p.Disarm(ctx), ErrUnavailable) })
+}
+
@@ -0,0 +1,146 @@
+package alarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Simulator is an in-process panel for demos and tests. Commands from the
+// bot change its state silently; Inject plays the part of the keypad and
+// sensors and is what Subscribe reports.
+type Simulator struct {
+	mu     sync.Mutex
+	state  string
+	mode   ArmMode
+	pin    string
+	zones  []string
+	events []Event
+	wake   chan struct{} // closed and replaced when an event is added
+}
+
+var _ Panel = (*Simulator)(nil)
+
+// simHistory bounds the events kept for resuming subscribers.
+const simHistory = 100
+
+// NewSimulator returns a disarmed panel with the given PIN and zones.
+func NewSimulator(pin string, zones []string) *Simulator {
+	return &Simulator{state: "DISARMED", pin: pin, zones: zones, wake: make(chan struct{})}
+}
+
+func (s *Simulator) Arm(ctx context.Context, mode ArmMode, bypass []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, z := range bypass {
+		if !slices.Contains(s.zones, z) {
+			return fmt.Errorf("unknown zone %q", z)
+		}
+	}
+	if mode == "" {
+		mode = ArmAway
+	}
+	s.state, s.mode = "ARMED", mode
+	return nil
+}
+
+func (s *Simulator) Disarm(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state, s.mode = "DISARMED", ""
+	return nil
+}
+
+func (s *Simulator) Status(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state, nil
+}
+
+// Mode is the current arm mode, empty while disarmed.
+func (s *Simulator) Mode() ArmMode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mode
+}
+
+func (s *Simulator) ChangePIN(ctx context.Context, pin string) error {
+	if len(pin) < 4 {
+		return errors.New("PIN must have at least 4 digits")
+	}
+	if _, err := strconv.Atoi(pin); err != nil {
+		return errors.New("PIN must be numeric")
+	}
+	s.mu.Lock()
+	s.pin = pin
+	s.mu.Unlock()
+	return nil
+}
+
+// CheckPIN reports whether pin is the current PIN.
+func (s *Simulator) CheckPIN(pin string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return pin == s.pin
+}
+
+func (s *Simulator) Zones(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.zones), nil
+}
+
+// Inject adds an event as if the panel raised it; "armed" and "disarmed"
+// also change the state. The event's ID is assigned and returned.
+func (s *Simulator) Inject(ev Event) Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch ev.Type {
+	case "armed":
+		s.state, s.mode = "ARMED", ArmAway
+	case "disarmed", "success":
+		s.state, s.mode = "DISARMED", ""
+	}
+	next := 1
+	if n := len(s.events); n > 0 {
+		next, _ = strconv.Atoi(s.events[n-1].ID)
+		next++
+	}
+	ev.ID = strconv.Itoa(next)
+	s.events = append(s.events, ev)
+	if len(s.events) > simHistory {
+		s.events = s.events[len(s.events)-simHistory:]
+	}
+	close(s.wake)
+	s.wake = make(chan struct{})
+	return ev
+}
+
+// Subscribe replays events after lastID, then follows new ones.
+func (s *Simulator) Subscribe(ctx context.Context, lastID string, handle func(Event)) error {
+	after, _ := strconv.Atoi(lastID)
+	for {
+		s.mu.Lock()
+		var pending []Event
+		for _, ev := range s.events {
+			if id, _ := strconv.Atoi(ev.ID); id > after {
+				pending = append(pending, ev)
+			}
+		}
+		wake := s.wake
+		s.mu.Unlock()
+
+		for _, ev := range pending {
+			handle(ev)
+			after, _ = strconv.Atoi(ev.ID)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package alarm
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one message pushed by the alarm server, e.g. Type "alarm",
+// "armed", "disarmed", "success" or "sensor". Data is the raw payload.
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// StreamMode selects how Subscribe connects.
+type StreamMode string
+
+const (
+	// SSE reads text/event-stream from GET /events.
+	SSE StreamMode = "sse"
+	// WebSocket reads JSON Event text frames from /events/ws.
+	WebSocket StreamMode = "websocket"
+)
+
+// Backoff bounds for reconnecting a dropped stream; variables so tests can
+// shorten them.
+var (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// Subscribe follows the alarm server's event stream, over Config.Stream, and
+// calls handle for every event until ctx is done. Dropped connections are
+// retried with backoff, resuming after the last event seen (starting from
+// lastID, which may be empty). It returns ctx.Err().
+func (c *Client) Subscribe(ctx context.Context, lastID string, handle func(Event)) error {
+	mode := c.cfg.Stream
+	if mode == "" {
+		mode = SSE
+	}
+	base := minBackoff
+	backoff := base
+	for {
+		var err error
+		var got bool
+		switch mode {
+		case WebSocket:
+			lastID, got, err = c.subscribeWS(ctx, lastID, handle)
+		default:
+			lastID, got, err = c.subscribeSSE(ctx, lastID, handle, &base)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if got {
+			backoff = base
+		}
+		log.Printf("alarm stream (%s): %v; reconnecting in %s", mode, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// subscribeSSE reads one SSE connection. It reports the last event ID seen
+// and whether any event arrived. A "retry:" field replaces the base delay
+// before reconnecting.
+func (c *Client) subscribeSSE(ctx context.Context, lastID string, handle func(Event), retry *time.Duration) (string, bool, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/events", nil)
+	if err != nil {
+		return lastID, false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return lastID, false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return lastID, false, fmt.Errorf("alarm returned %s", res.Status)
+	}
+
+	got := false
+	var ev Event
+	var data []string
+	sc := bufio.NewScanner(res.Body)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" { // dispatch
+			if len(data) > 0 {
+				ev.Data = json.RawMessage(strings.Join(data, "\n"))
+				if ev.Type == "" {
+					ev.Type = "message"
+				}
+				if ev.ID != "" {
+					lastID = ev.ID
+				}
+				handle(ev)
+				got = true
+			}
+			ev, data = Event{}, nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") { // comment / keep-alive
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			ev.ID = value
+		case "event":
+			ev.Type = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+				*retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return lastID, got, err
+	}
+	return lastID, got, io.ErrUnexpectedEOF
+}
+
+// subscribeWS reads one WebSocket connection to /events/ws?last_event_id=…
+// Each text frame carries one JSON Event.
+func (c *Client) subscribeWS(ctx context.Context, lastID string, handle func(Event)) (string, bool, error) {
+	u, err := url.Parse(c.base + "/events/ws")
+	if err != nil {
+		return lastID, false, err
+	}
+	if lastID != "" {
+		u.RawQuery = url.Values{"last_event_id": {lastID}}.Encode()
+	}
+	h := http.Header{}
+	c.authorize(h, http.MethodGet, u.RequestURI(), nil, time.Now())
+	conn, br, err := dialWebSocket(ctx, u, c.tls, h)
+	if err != nil {
+		return lastID, false, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	got := false
+	for {
+		op, payload, err := readFrame(br)
+		if err != nil {
+			return lastID, got, err
+		}
+		switch op {
+		case opText:
+			var ev Event
+			if err := json.Unmarshal(payload, &ev); err != nil {
+				log.Printf("alarm stream: bad frame: %v", err)
+				continue
+			}
+			if ev.ID != "" {
+				lastID = ev.ID
+			}
+			handle(ev)
+			got = true
+		case opPing:
+			if err := writeFrame(conn, opPong, payload); err != nil {
+				return lastID, got, err
+			}
+		case opClose:
+			_ = writeFrame(conn, opClose, nil)
+			return lastID, got, errors.New("server closed stream")
+		}
+	}
+}
+
+/* ----------------------------------------------------------------------
+   Minimal RFC 6455 client: enough to read a server's event stream. */
+
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// dialWebSocket performs the opening handshake over http(s)/ws(s) URL u,
+// sending header with it. tc may be nil for the default TLS settings.
+func dialWebSocket(ctx context.Context, u *url.URL, tc *tls.Config, header http.Header) (net.Conn, *bufio.Reader, error) {
+	secure := u.Scheme == "https" || u.Scheme == "wss"
+	host := u.Host
+	if u.Port() == "" {
+		if secure {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, nil, err
+	}
+	if secure {
+		cfg := &tls.Config{}
+		if tc != nil {
+			cfg = tc.Clone()
+		}
+		cfg.ServerName = u.Hostname()
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		conn = tlsConn
+	}
+
+	raw := make([]byte, 16)
+	_, _ = rand.Read(raw)
+	key := base64.StdEncoding.EncodeToString(raw)
+	req := &http.Request{Method: http.MethodGet, URL: u, Host: u.Host, Header: http.Header{}}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, nil, fmt.Errorf("alarm returned %s", res.Status)
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	if res.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		conn.Close()
+		return nil, nil, errors.New("websocket handshake: bad Sec-WebSocket-Accept")
+	}
+	return conn, br, nil
+}
+
+// readFrame reads one complete (possibly fragmented) message.
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	var op byte
+	var msg []byte
+	for {
+		var h [2]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return 0, nil, err
+		}
+		fin, frameOp := h[0]&0x80 != 0, h[0]&0x0F
+		n := uint64(h[1] & 0x7F)
+		switch n {
+		case 126:
+			var b [2]byte
+			if _, err := io.ReadFull(r, b[:]); err != nil {
+				return 0, nil, err
+			}
+			n = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			if _, err := io.ReadFull(r, b[:]); err != nil {
+				return 0, nil, err
+			}
+			n = binary.BigEndian.Uint64(b[:])
+		}
+		if n > 1<<20 {
+			return 0, nil, errors.New("websocket frame too large")
+		}
+		var mask [4]byte
+		masked := h[1]&0x80 != 0
+		if masked {
+			if _, err := io.ReadFull(r, mask[:]); err != nil {
+				return 0, nil, err
+			}
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return 0, nil, err
+		}
+		if masked {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+		if frameOp >= 0x8 { // control frames are never fragmented
+			return frameOp, payload, nil
+		}
+		if frameOp != 0 {
+			op = frameOp
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return op, msg, nil
+		}
+	}
+}
+
+// writeFrame sends one masked frame, as clients must.
+func writeFrame(w io.Writer, op byte, payload []byte) error {
+	hdr := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		hdr = append(hdr, 0x80|byte(n))
+	case n <= 0xFFFF:
+		hdr = append(hdr, 0x80|126, byte(n>>8), byte(n))
+	default:
+		hdr = append(hdr, 0x80|127)
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	var mask [4]byte
+	_, _ = rand.Read(mask[:])
+	hdr = append(hdr, mask[:]...)
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+	_, err := w.Write(append(hdr, masked...))
+	return err
+}
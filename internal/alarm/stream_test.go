@@ -0,0 +1,134 @@
+package alarm
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// collect returns a handler that stores events and cancels ctx after n.
+func collect(n int, cancel context.CancelFunc) (func(Event), *[]Event) {
+	var got []Event
+	return func(ev Event) {
+		got = append(got, ev)
+		if len(got) == n {
+			cancel()
+		}
+	}, &got
+}
+
+func TestSubscribe_SSEResumes(t *testing.T) {
+	minBackoff = 10 * time.Millisecond
+	defer func() { minBackoff = time.Second }()
+
+	var conns int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" || r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("unexpected request %s %q", r.URL.Path, r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch atomic.AddInt32(&conns, 1) {
+		case 1:
+			if id := r.Header.Get("Last-Event-ID"); id != "" {
+				t.Errorf("first connection sent Last-Event-ID %q", id)
+			}
+			fmt.Fprint(w, "retry: 5\n: keep-alive\n\nid: 1\nevent: alarm\ndata: {}\n\n")
+			fmt.Fprint(w, "id: 2\nevent: sensor\ndata: {\"type\":\"motion\",\ndata: \"sensor_id\":\"hall\"}\n\n")
+		default:
+			if id := r.Header.Get("Last-Event-ID"); id != "2" {
+				t.Errorf("Last-Event-ID = %q, want 2", id)
+			}
+			fmt.Fprint(w, "id: 3\nevent: armed\ndata: {}\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	handle, got := collect(3, cancel)
+	if err := New(srv.URL).Subscribe(ctx, "", handle); err != context.Canceled {
+		t.Fatalf("Subscribe returned %v", err)
+	}
+
+	want := []struct{ id, typ string }{{"1", "alarm"}, {"2", "sensor"}, {"3", "armed"}}
+	if len(*got) != len(want) {
+		t.Fatalf("got %d events, want %d", len(*got), len(want))
+	}
+	for i, w := range want {
+		if ev := (*got)[i]; ev.ID != w.id || ev.Type != w.typ {
+			t.Errorf("event %d = %s/%s, want %s/%s", i, ev.ID, ev.Type, w.id, w.typ)
+		}
+	}
+	if d := string((*got)[1].Data); d != "{\"type\":\"motion\",\n\"sensor_id\":\"hall\"}" {
+		t.Errorf("multi-line data = %q", d)
+	}
+}
+
+func TestSubscribe_WebSocketResumes(t *testing.T) {
+	minBackoff = 10 * time.Millisecond
+	defer func() { minBackoff = time.Second }()
+
+	var conns int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events/ws" || r.Header.Get("Upgrade") != "websocket" {
+			t.Errorf("unexpected request %s", r.URL)
+			return
+		}
+		n := atomic.AddInt32(&conns, 1)
+		if want := map[int32]string{1: "", 2: "7"}[n]; r.URL.Query().Get("last_event_id") != want {
+			t.Errorf("connection %d: last_event_id = %q, want %q", n, r.URL.Query().Get("last_event_id"), want)
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + wsGUID))
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+			"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+
+		// Server frames are unmasked.
+		frame := func(op byte, p string) { rw.Write(append([]byte{0x80 | op, byte(len(p))}, p...)) }
+		if n == 1 {
+			frame(opText, `{"id":"7","type":"alarm"}`)
+			frame(opPing, "hi")
+			rw.Flush()
+			op, payload, err := readFrame(bufio.NewReader(rw))
+			if err != nil || op != opPong || string(payload) != "hi" {
+				t.Errorf("pong = %x %q %v", op, payload, err)
+			}
+			frame(opClose, "")
+			rw.Flush()
+			return
+		}
+		frame(opText, `{"id":"8","type":"disarmed","data":{"actor":"keypad"}}`)
+		rw.Flush()
+		_, _, _ = readFrame(bufio.NewReader(rw)) // wait for the client to go
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	handle, got := collect(2, cancel)
+	c := New(srv.URL)
+	cfg := DefaultConfig()
+	cfg.Stream = WebSocket
+	_ = c.Configure(cfg)
+	if err := c.Subscribe(ctx, "", handle); err != context.Canceled {
+		t.Fatalf("Subscribe returned %v", err)
+	}
+	if len(*got) != 2 || (*got)[0].ID != "7" || (*got)[1].Type != "disarmed" || string((*got)[1].Data) != `{"actor":"keypad"}` {
+		t.Fatalf("events = %+v", *got)
+	}
+}
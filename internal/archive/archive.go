@@ -0,0 +1,209 @@
+package archive
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clip is one archived upload as recorded in the index.
+type Clip struct {
+	ID      string            `json:"id"`
+	Time    time.Time         `json:"time"`
+	Name    string            `json:"name"`
+	Size    int64             `json:"size"`
+	Video   bool              `json:"video"` // playable inline, otherwise sent as a document
+	Caption string            `json:"caption"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	// Token lets a link fetch this one clip without other credentials.
+	Token string `json:"token,omitempty"`
+}
+
+// ErrNotFound is returned for clip IDs that are not in the archive.
+var ErrNotFound = errors.New("clip not found")
+
+// ErrTooLarge is returned by Save for a clip bigger than the whole archive
+// may hold; it would be pruned at once.
+var ErrTooLarge = errors.New("clip larger than the archive limit")
+
+// Archive stores clips on disk under dir with a JSON index, and drops the
+// oldest ones once they exceed maxAge or the total passes maxBytes. A zero
+// limit disables that rule.
+type Archive struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu    sync.Mutex
+	clips []Clip // oldest first
+}
+
+const indexFile = "index.json"
+
+// Open loads (or creates) the archive in dir and applies retention once.
+func Open(dir string, maxBytes int64, maxAge time.Duration) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	a := &Archive{dir: dir, maxBytes: maxBytes, maxAge: maxAge}
+
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &a.clips); err != nil {
+			return nil, err
+		}
+		sort.Slice(a.clips, func(i, j int) bool { return a.clips[i].Time.Before(a.clips[j].Time) })
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a, a.pruneLocked()
+}
+
+// Save copies r into the archive and records c in the index. ID, Time and
+// Size are filled in and the completed Clip is returned. A clip over the size
+// limit is not kept and ErrTooLarge is returned.
+func (a *Archive) Save(r io.Reader, c Clip) (Clip, error) {
+	raw := make([]byte, 8+16)
+	if _, err := rand.Read(raw); err != nil {
+		return c, err
+	}
+	raw, c.Token = raw[:8], hex.EncodeToString(raw[8:])
+	if c.Time.IsZero() {
+		c.Time = time.Now()
+	}
+	c.ID = c.Time.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(raw)
+	c.Name = filepath.Base(c.Name)
+
+	path := a.path(c.ID)
+	f, err := os.Create(path)
+	if err != nil {
+		return c, err
+	}
+	src := r
+	if a.maxBytes > 0 {
+		src = io.LimitReader(r, a.maxBytes+1)
+	}
+	c.Size, err = io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && a.maxBytes > 0 && c.Size > a.maxBytes {
+		err = ErrTooLarge
+	}
+	if err != nil {
+		os.Remove(path)
+		return c, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.clips = append(a.clips, c)
+	return c, a.pruneLocked()
+}
+
+// Recent returns up to n clips, newest first.
+func (a *Archive) Recent(n int) []Clip {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n <= 0 || n > len(a.clips) {
+		n = len(a.clips)
+	}
+	out := make([]Clip, 0, n)
+	for i := len(a.clips) - 1; len(out) < n; i-- {
+		out = append(out, a.clips[i])
+	}
+	return out
+}
+
+// Open returns the clip with the given ID and its file, which the caller
+// must close.
+func (a *Archive) Open(id string) (Clip, *os.File, error) {
+	a.mu.Lock()
+	var c Clip
+	found := false
+	for _, cl := range a.clips {
+		if cl.ID == id {
+			c, found = cl, true
+			break
+		}
+	}
+	a.mu.Unlock()
+	if !found {
+		return c, nil, ErrNotFound
+	}
+	f, err := os.Open(a.path(id))
+	return c, f, err
+}
+
+// Sync rewrites the index and flushes it and the clips directory to stable
+// storage, so nothing saved is lost if the host goes down after the bot.
+func (a *Archive) Sync() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.writeIndexLocked(); err != nil {
+		return err
+	}
+	for _, name := range []string{filepath.Join(a.dir, indexFile), a.dir} {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = f.Sync()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Archive) path(id string) string { return filepath.Join(a.dir, id+".clip") }
+
+// pruneLocked applies the age and size limits and rewrites the index.
+func (a *Archive) pruneLocked() error {
+	var total int64
+	for _, c := range a.clips {
+		total += c.Size
+	}
+	cutoff := time.Now().Add(-a.maxAge)
+	drop := 0
+	for drop < len(a.clips) {
+		c := a.clips[drop]
+		tooOld := a.maxAge > 0 && c.Time.Before(cutoff)
+		tooBig := a.maxBytes > 0 && total > a.maxBytes
+		if !tooOld && !tooBig {
+			break
+		}
+		os.Remove(a.path(c.ID))
+		total -= c.Size
+		drop++
+	}
+	a.clips = append([]Clip(nil), a.clips[drop:]...)
+	return a.writeIndexLocked()
+}
+
+func (a *Archive) writeIndexLocked() error {
+	data, err := json.MarshalIndent(a.clips, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(a.dir, indexFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(a.dir, indexFile))
+}
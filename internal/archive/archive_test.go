@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchive_SaveRecentOpen(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	first, err := a.Save(strings.NewReader("one"), Clip{Name: "a.mp4", Video: true, Fields: map[string]string{"camera": "porch"}})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	second, _ := a.Save(strings.NewReader("two!"), Clip{Name: "../b.mp4"})
+
+	recent := a.Recent(10)
+	if len(recent) != 2 || recent[0].ID != second.ID || recent[1].ID != first.ID {
+		t.Fatalf("Recent order wrong: %+v", recent)
+	}
+	if second.Name != "b.mp4" || second.Size != 4 {
+		t.Fatalf("unexpected clip: %+v", second)
+	}
+
+	c, f, err := a.Open(first.ID)
+	if err != nil {
+		t.Fatalf("Open clip: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "one" || c.Fields["camera"] != "porch" {
+		t.Fatalf("got %q %+v", data, c)
+	}
+
+	// Index survives a sync and reopen.
+	if err := a.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	b, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if got := b.Recent(0); len(got) != 2 {
+		t.Fatalf("reopened archive has %d clips, want 2", len(got))
+	}
+
+	if _, _, err := b.Open("nope"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open unknown = %v, want ErrNotFound", err)
+	}
+}
+
+func TestArchive_Retention(t *testing.T) {
+	dir := t.TempDir()
+	a, _ := Open(dir, 10, time.Hour)
+
+	old, _ := a.Save(strings.NewReader("xx"), Clip{Time: time.Now().Add(-2 * time.Hour)})
+	if len(a.Recent(0)) != 0 {
+		t.Fatalf("clip older than maxAge should be pruned")
+	}
+	if _, err := os.Stat(a.path(old.ID)); !os.IsNotExist(err) {
+		t.Fatalf("pruned clip file still on disk: %v", err)
+	}
+
+	if _, err := a.Save(strings.NewReader("12345678901"), Clip{}); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Save over the size limit = %v, want ErrTooLarge", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 { // the index only
+		t.Fatalf("oversized clip left on disk: %v", entries)
+	}
+
+	a.Save(strings.NewReader("123456"), Clip{})
+	last, _ := a.Save(strings.NewReader("789012"), Clip{})
+	got := a.Recent(0)
+	if len(got) != 1 || got[0].ID != last.ID {
+		t.Fatalf("size limit should keep only the newest clip, got %+v", got)
+	}
+}
@@ -0,0 +1,608 @@
+// Package config loads the bot's settings from an optional TOML file,
+// applies environment overrides and validates the result.
+//
+// Every setting can come from the file or from the environment variable
+// named next to it; the environment wins. See config.example.toml at the
+// repository root for a commented file.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/httpapi"
+	"home-alarm-bot/internal/mqtt"
+	"home-alarm-bot/internal/mqttbridge"
+	"home-alarm-bot/internal/rules"
+	"home-alarm-bot/internal/schedule"
+	"home-alarm-bot/internal/sensors"
+	"home-alarm-bot/internal/telegram"
+	"home-alarm-bot/internal/webhook"
+)
+
+// Config is everything the bot can be told at startup.
+type Config struct {
+	Listen    string `json:"listen"`     // LISTEN_ADDR
+	DataDir   string `json:"data_dir"`   // DATA_DIR
+	PublicURL string `json:"public_url"` // PUBLIC_BASE_URL
+
+	Telegram Telegram           `json:"telegram"`
+	Alarm    Alarm              `json:"alarm"`
+	API      API                `json:"api"`
+	MQTT     MQTT               `json:"mqtt"`
+	Sensors  Sensors            `json:"sensors"`
+	Webhooks []webhook.Endpoint `json:"webhooks"` // WEBHOOKS
+
+	Rules     []rules.Rule     `json:"rules"`
+	Schedules []schedule.Entry `json:"schedules"`
+	Templates Templates        `json:"templates"`
+	Limits    Limits           `json:"limits"`
+}
+
+type Telegram struct {
+	Token string `json:"token"` // BOT_TOKEN
+	// Chats is the allowlist; without it every chat is an admin.
+	Chats []Chat `json:"chats"` // TELEGRAM_CHATS="id:role,…"
+	// OfflineNotice, if set, is sent to the admin chats on shutdown.
+	OfflineNotice string `json:"offline_notice"` // OFFLINE_NOTICE
+}
+
+// Chat gives one Telegram chat a role.
+type Chat struct {
+	ID   int64         `json:"id"`
+	Role telegram.Role `json:"role"`
+}
+
+type Alarm struct {
+	Driver       string   `json:"driver"`        // ALARM_DRIVER: http, mqtt or sim
+	BaseURL      string   `json:"base_url"`      // SERVER_BASE_URL
+	Timeout      Duration `json:"timeout"`       // ALARM_TIMEOUT
+	CAFile       string   `json:"ca_file"`       // ALARM_CA_FILE
+	CertFile     string   `json:"cert_file"`     // ALARM_CERT_FILE
+	KeyFile      string   `json:"key_file"`      // ALARM_KEY_FILE
+	AuthHeader   string   `json:"auth_header"`   // ALARM_AUTH_HEADER
+	Client       string   `json:"client"`        // ALARM_CLIENT
+	Secret       string   `json:"secret"`        // ALARM_SECRET
+	Stream       string   `json:"stream"`        // ALARM_STREAM: sse or websocket
+	PollInterval Duration `json:"poll_interval"` // ALARM_POLL_INTERVAL
+	DownAfter    Duration `json:"down_after"`    // ALARM_DOWN_AFTER
+	MQTTPrefix   string   `json:"mqtt_prefix"`   // ALARM_MQTT_PREFIX
+	SimPIN       string   `json:"sim_pin"`       // ALARM_SIM_PIN
+	SimZones     []string `json:"sim_zones"`     // ALARM_SIM_ZONES
+}
+
+type API struct {
+	Clients []httpapi.Client `json:"clients"`  // API_CLIENTS
+	UIUsers []httpapi.UIUser `json:"ui_users"` // UI_USERS
+	// AllowUnauthenticated opens the API to anyone while no clients are
+	// configured; otherwise it refuses every request.
+	AllowUnauthenticated bool `json:"allow_unauthenticated"` // API_ALLOW_UNAUTHENTICATED
+}
+
+type MQTT struct {
+	Addr        string `json:"addr"`         // MQTT_ADDR; empty disables the bridge
+	ClientID    string `json:"client_id"`    // MQTT_CLIENT_ID
+	Username    string `json:"username"`     // MQTT_USERNAME
+	Password    string `json:"password"`     // MQTT_PASSWORD
+	Prefix      string `json:"prefix"`       // MQTT_PREFIX
+	HADiscovery string `json:"ha_discovery"` // MQTT_HA_DISCOVERY
+	// CommandSecrets lists the secrets actors sign commands with.
+	CommandSecrets Secrets `json:"command_secrets"` // MQTT_COMMAND_SECRETS="actor:secret,…"
+	// HACodes lists the codes actors type in Home Assistant.
+	HACodes Secrets `json:"ha_codes"` // MQTT_HA_CODES="actor:code,…"
+}
+
+type Sensors struct {
+	Devices   []Sensor `json:"devices"`   // SENSORS="id:zone:heartbeat,…"
+	Auto      bool     `json:"auto"`      // SENSORS_AUTO
+	Heartbeat Duration `json:"heartbeat"` // SENSOR_HEARTBEAT
+}
+
+// Sensor is a configured device; see sensors.Sensor.
+type Sensor struct {
+	ID        string   `json:"id"`
+	Zone      string   `json:"zone"`
+	Heartbeat Duration `json:"heartbeat"`
+}
+
+type Templates struct {
+	Caption string `json:"caption"` // CAPTION_TEMPLATE
+}
+
+type Limits struct {
+	MaxUploadMB    int64    `json:"max_upload_mb"`    // MAX_UPLOAD_MB
+	TelegramMaxMB  int64    `json:"telegram_max_mb"`  // TELEGRAM_MAX_MB
+	DownloadTTL    Duration `json:"download_ttl"`     // DOWNLOAD_TTL
+	ArchiveMaxMB   int64    `json:"archive_max_mb"`   // ARCHIVE_MAX_MB
+	ArchiveMaxDays int64    `json:"archive_max_days"` // ARCHIVE_MAX_DAYS
+	ReplayWindow   Duration `json:"replay_window"`    // REPLAY_WINDOW
+	SessionTTL     Duration `json:"session_ttl"`      // SESSION_TTL
+	// ShutdownTimeout bounds the whole shutdown, queues drained included.
+	ShutdownTimeout Duration `json:"shutdown_timeout"` // SHUTDOWN_TIMEOUT
+}
+
+// Duration is a time.Duration written as a string such as "30s" or "12h".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("want a duration such as \"30s\", got %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Secret is one actor's secret or code.
+type Secret struct {
+	Actor  string
+	Secret string
+}
+
+// Secrets is written as a table of actor = "secret" in the file and as
+// "actor:secret,…" in the environment. It is a list rather than a map so
+// that Validate sees, and reports, an actor or a secret given twice.
+type Secrets []Secret
+
+func (s *Secrets) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return fmt.Errorf("want a table of actor = \"secret\", got %s", b)
+	}
+	*s = nil
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		actor, _ := key.(string)
+		var secret string
+		if err := dec.Decode(&secret); err != nil {
+			return fmt.Errorf("%s: want a string", actor)
+		}
+		*s = append(*s, Secret{Actor: actor, Secret: secret})
+	}
+	return nil
+}
+
+// parseSecrets reads "actor:secret,…", keeping the order.
+func parseSecrets(spec string) (Secrets, error) {
+	var out Secrets
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		actor, secret, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("%q: want actor:secret", entry)
+		}
+		out = append(out, Secret{Actor: actor, Secret: secret})
+	}
+	return out, nil
+}
+
+// parseChats reads "chat_id:role,…", keeping the order; the roles are
+// checked by Validate.
+func parseChats(spec string) ([]Chat, error) {
+	var out []Chat
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		id, role, ok := strings.Cut(entry, ":")
+		chat, err := strconv.ParseInt(id, 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("%q: want chat_id:role", entry)
+		}
+		out = append(out, Chat{ID: chat, Role: telegram.Role(role)})
+	}
+	return out, nil
+}
+
+// Default returns the settings used for anything not configured.
+func Default() Config {
+	api := httpapi.DefaultConfig()
+	return Config{
+		Listen:  "127.0.0.1:8080",
+		DataDir: "data",
+		Alarm: Alarm{
+			Driver:       "http",
+			Timeout:      Duration(alarm.DefaultConfig().Timeout),
+			PollInterval: Duration(30 * time.Second),
+			DownAfter:    Duration(2 * time.Minute),
+			MQTTPrefix:   "alarm/panel",
+			SimPIN:       "1234",
+		},
+		MQTT:    MQTT{ClientID: "home-alarm-bot"},
+		Sensors: Sensors{Auto: true},
+		Limits: Limits{
+			MaxUploadMB:    api.MaxUpload >> 20,
+			TelegramMaxMB:  api.TelegramMax >> 20,
+			DownloadTTL:    Duration(api.DownloadTTL),
+			ArchiveMaxMB:   2048,
+			ArchiveMaxDays: 14,
+			ReplayWindow:   Duration(api.ReplayWindow),
+			SessionTTL:     Duration(api.SessionTTL),
+
+			ShutdownTimeout: Duration(15 * time.Second),
+		},
+	}
+}
+
+// Load reads the TOML file at path, if path is not empty, over Default,
+// applies the environment overrides and validates the result. Every problem
+// found is reported, joined into one error.
+func Load(path string) (Config, error) {
+	c := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return c, err
+		}
+		if err := decode(string(data), &c); err != nil {
+			return c, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	err := errors.Join(c.applyEnv(os.LookupEnv), c.Validate())
+	return c, err
+}
+
+// decode parses TOML into c, rejecting keys c has no field for.
+func decode(data string, c *Config) error {
+	tree, err := parseTOML(data)
+	if err != nil {
+		return err
+	}
+	// Go through JSON so the struct tags and Duration apply.
+	raw, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// applyEnv overrides c with every variable lookup finds.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	str := func(k string, dst *string) {
+		if v, ok := lookup(k); ok && v != "" {
+			*dst = v
+		}
+	}
+	parse := func(k string, f func(string) error) {
+		if v, ok := lookup(k); ok && v != "" {
+			if err := f(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", k, err))
+			}
+		}
+	}
+	dur := func(k string, dst *Duration) {
+		parse(k, func(v string) error {
+			d, err := time.ParseDuration(v)
+			*dst = Duration(d)
+			return err
+		})
+	}
+	num := func(k string, dst *int64) {
+		parse(k, func(v string) (err error) {
+			*dst, err = strconv.ParseInt(v, 10, 64)
+			return err
+		})
+	}
+
+	str("LISTEN_ADDR", &c.Listen)
+	str("DATA_DIR", &c.DataDir)
+	str("PUBLIC_BASE_URL", &c.PublicURL)
+
+	str("BOT_TOKEN", &c.Telegram.Token)
+	str("OFFLINE_NOTICE", &c.Telegram.OfflineNotice)
+	parse("TELEGRAM_CHATS", func(v string) (err error) {
+		c.Telegram.Chats, err = parseChats(v)
+		return err
+	})
+
+	a := &c.Alarm
+	str("ALARM_DRIVER", &a.Driver)
+	str("SERVER_BASE_URL", &a.BaseURL)
+	dur("ALARM_TIMEOUT", &a.Timeout)
+	str("ALARM_CA_FILE", &a.CAFile)
+	str("ALARM_CERT_FILE", &a.CertFile)
+	str("ALARM_KEY_FILE", &a.KeyFile)
+	str("ALARM_AUTH_HEADER", &a.AuthHeader)
+	str("ALARM_CLIENT", &a.Client)
+	str("ALARM_SECRET", &a.Secret)
+	str("ALARM_STREAM", &a.Stream)
+	dur("ALARM_POLL_INTERVAL", &a.PollInterval)
+	dur("ALARM_DOWN_AFTER", &a.DownAfter)
+	str("ALARM_MQTT_PREFIX", &a.MQTTPrefix)
+	str("ALARM_SIM_PIN", &a.SimPIN)
+	parse("ALARM_SIM_ZONES", func(v string) error {
+		a.SimZones = strings.Split(v, ",")
+		return nil
+	})
+
+	parse("API_CLIENTS", func(v string) (err error) {
+		c.API.Clients, err = httpapi.ParseClients(v)
+		return err
+	})
+	parse("UI_USERS", func(v string) (err error) {
+		c.API.UIUsers, err = httpapi.ParseUIUsers(v)
+		return err
+	})
+	parse("API_ALLOW_UNAUTHENTICATED", func(v string) (err error) {
+		c.API.AllowUnauthenticated, err = strconv.ParseBool(v)
+		return err
+	})
+
+	m := &c.MQTT
+	str("MQTT_ADDR", &m.Addr)
+	str("MQTT_CLIENT_ID", &m.ClientID)
+	str("MQTT_USERNAME", &m.Username)
+	str("MQTT_PASSWORD", &m.Password)
+	str("MQTT_PREFIX", &m.Prefix)
+	str("MQTT_HA_DISCOVERY", &m.HADiscovery)
+	parse("MQTT_COMMAND_SECRETS", func(v string) (err error) {
+		m.CommandSecrets, err = parseSecrets(v)
+		return err
+	})
+	parse("MQTT_HA_CODES", func(v string) (err error) {
+		m.HACodes, err = parseSecrets(v)
+		return err
+	})
+
+	parse("SENSORS", func(v string) error {
+		list, err := sensors.ParseSpec(v)
+		c.Sensors.Devices = nil
+		for _, s := range list {
+			c.Sensors.Devices = append(c.Sensors.Devices, Sensor{ID: s.ID, Zone: s.Zone, Heartbeat: Duration(s.Heartbeat)})
+		}
+		return err
+	})
+	parse("SENSORS_AUTO", func(v string) (err error) {
+		c.Sensors.Auto, err = strconv.ParseBool(v)
+		return err
+	})
+	dur("SENSOR_HEARTBEAT", &c.Sensors.Heartbeat)
+
+	parse("WEBHOOKS", func(v string) (err error) {
+		c.Webhooks, err = webhook.ParseEndpoints(v)
+		return err
+	})
+
+	str("CAPTION_TEMPLATE", &c.Templates.Caption)
+
+	l := &c.Limits
+	num("MAX_UPLOAD_MB", &l.MaxUploadMB)
+	num("TELEGRAM_MAX_MB", &l.TelegramMaxMB)
+	dur("DOWNLOAD_TTL", &l.DownloadTTL)
+	num("ARCHIVE_MAX_MB", &l.ArchiveMaxMB)
+	num("ARCHIVE_MAX_DAYS", &l.ArchiveMaxDays)
+	dur("REPLAY_WINDOW", &l.ReplayWindow)
+	dur("SESSION_TTL", &l.SessionTTL)
+	dur("SHUTDOWN_TIMEOUT", &l.ShutdownTimeout)
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every problem with c, one per line.
+func (c Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		add("listen %q: want host:port", c.Listen)
+	}
+	if c.DataDir == "" {
+		add("data_dir: must not be empty")
+	}
+	if c.Telegram.Token == "" {
+		add("telegram.token (BOT_TOKEN): missing")
+	}
+	seen := map[int64]bool{}
+	for _, ch := range c.Telegram.Chats {
+		if _, err := telegram.ParseRole(string(ch.Role)); err != nil {
+			add("telegram.chats %d: %v", ch.ID, err)
+		}
+		if seen[ch.ID] {
+			add("telegram.chats %d: listed twice", ch.ID)
+		}
+		seen[ch.ID] = true
+	}
+
+	a := c.Alarm
+	switch a.Driver {
+	case "http":
+		if a.BaseURL == "" {
+			add("alarm.base_url (SERVER_BASE_URL): missing for the http driver")
+		} else if u, err := url.Parse(a.BaseURL); err != nil || u.Host == "" {
+			add("alarm.base_url %q: want http(s)://host", a.BaseURL)
+		} else if err := alarm.New(a.BaseURL).Configure(c.AlarmConfig()); err != nil {
+			add("alarm: %v", err)
+		}
+		switch alarm.StreamMode(a.Stream) {
+		case "", alarm.SSE, alarm.WebSocket:
+		default:
+			add("alarm.stream %q: want sse or websocket", a.Stream)
+		}
+	case "mqtt":
+		if c.MQTT.Addr == "" {
+			add("mqtt.addr (MQTT_ADDR): missing for the mqtt alarm driver")
+		}
+	case "sim":
+	default:
+		add("alarm.driver %q: want http, mqtt or sim", a.Driver)
+	}
+	if a.Timeout <= 0 || a.PollInterval <= 0 || a.DownAfter <= 0 {
+		add("alarm: timeout, poll_interval and down_after must be positive")
+	}
+
+	if c.MQTT.Password != "" && c.MQTT.Username == "" {
+		add("mqtt.password (MQTT_PASSWORD): needs mqtt.username, MQTT allows no password alone")
+	}
+	// Two actors with one secret could act as each other, and an HA code
+	// shared by two would be credited to either.
+	secrets := func(name string, list Secrets) {
+		actors, owner := map[string]bool{}, map[string]string{}
+		for _, s := range list {
+			switch {
+			case s.Actor == "" || s.Secret == "":
+				add("%s: empty actor or secret", name)
+			case actors[s.Actor]:
+				add("%s %s: listed twice", name, s.Actor)
+			case owner[s.Secret] != "":
+				add("%s %s: same secret as %s", name, s.Actor, owner[s.Secret])
+			default:
+				owner[s.Secret] = s.Actor
+			}
+			actors[s.Actor] = true
+		}
+	}
+	secrets("mqtt.command_secrets", c.MQTT.CommandSecrets)
+	secrets("mqtt.ha_codes", c.MQTT.HACodes)
+	if c.MQTT.HADiscovery != "" && c.MQTT.Addr == "" {
+		add("mqtt.ha_discovery needs mqtt.addr")
+	}
+
+	for _, s := range c.Sensors.Devices {
+		if s.ID == "" {
+			add("sensors.devices: empty id")
+		}
+	}
+	for _, ep := range c.Webhooks {
+		if u, err := url.Parse(ep.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			add("webhooks %q: want an http(s) URL", ep.URL)
+		}
+	}
+	for _, e := range c.Schedules {
+		if err := e.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	l := c.Limits
+	if l.ArchiveMaxMB < 0 || l.ArchiveMaxDays < 0 {
+		add("limits: archive limits must not be negative")
+	}
+	if l.ShutdownTimeout <= 0 {
+		add("limits.shutdown_timeout: must be positive")
+	}
+	if err := c.HTTP().Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// HTTP returns the local API settings.
+func (c Config) HTTP() httpapi.Config {
+	h := httpapi.DefaultConfig()
+	h.MaxUpload = c.Limits.MaxUploadMB << 20
+	h.TelegramMax = c.Limits.TelegramMaxMB << 20
+	h.PublicURL = c.PublicURL
+	h.DownloadTTL = time.Duration(c.Limits.DownloadTTL)
+	h.CaptionTemplate = c.Templates.Caption
+	h.Clients = c.API.Clients
+	h.AllowUnauthenticated = c.API.AllowUnauthenticated
+	h.ReplayWindow = time.Duration(c.Limits.ReplayWindow)
+	h.Rules = c.Rules
+	h.UIUsers = c.API.UIUsers
+	h.SessionTTL = time.Duration(c.Limits.SessionTTL)
+	return h
+}
+
+// AlarmConfig returns the HTTP alarm client settings.
+func (c Config) AlarmConfig() alarm.Config {
+	a := alarm.DefaultConfig()
+	a.Timeout = time.Duration(c.Alarm.Timeout)
+	a.CAFile, a.CertFile, a.KeyFile = c.Alarm.CAFile, c.Alarm.CertFile, c.Alarm.KeyFile
+	a.AuthHeader = c.Alarm.AuthHeader
+	a.ClientName, a.Secret = c.Alarm.Client, c.Alarm.Secret
+	a.Stream = alarm.StreamMode(c.Alarm.Stream)
+	return a
+}
+
+// ACL returns the Telegram allowlist for telegram.Bot.SetAccess.
+func (c Config) ACL() map[int64]telegram.Role {
+	acl := make(map[int64]telegram.Role, len(c.Telegram.Chats))
+	for _, ch := range c.Telegram.Chats {
+		acl[ch.ID] = ch.Role
+	}
+	return acl
+}
+
+// Bridge returns the MQTT bridge settings.
+func (c Config) Bridge() mqttbridge.Config {
+	secrets := make(map[string]string, len(c.MQTT.CommandSecrets))
+	for _, s := range c.MQTT.CommandSecrets {
+		secrets[s.Actor] = s.Secret
+	}
+	codes := make(map[string]string, len(c.MQTT.HACodes))
+	for _, s := range c.MQTT.HACodes {
+		codes[s.Secret] = s.Actor
+	}
+	return mqttbridge.Config{Prefix: c.MQTT.Prefix, Secrets: secrets,
+		Window: time.Duration(c.Limits.ReplayWindow), HACodes: codes}
+}
+
+// MQTTOptions returns the broker connection settings; the will marks the
+// bridge offline.
+func (c Config) MQTTOptions() mqtt.Options {
+	return mqtt.Options{
+		Addr:     c.MQTT.Addr,
+		ClientID: c.MQTT.ClientID,
+		Username: c.MQTT.Username,
+		Password: c.MQTT.Password,
+		Will:     c.Bridge().Will(),
+	}
+}
+
+// SensorList returns the configured sensors for sensors.NewRegistry.
+func (c Config) SensorList() []sensors.Sensor {
+	out := make([]sensors.Sensor, 0, len(c.Sensors.Devices))
+	for _, s := range c.Sensors.Devices {
+		out = append(out, sensors.Sensor{ID: s.ID, Zone: s.Zone, Heartbeat: time.Duration(s.Heartbeat)})
+	}
+	return out
+}
+
+// NeedsRestart lists the settings that differ between c and next but are
+// not applied on reload. Reload applies the Telegram allowlist, rules,
+// schedules, templates, the public URL and the upload limits.
+func (c Config) NeedsRestart(next Config) []string {
+	a, b := c.withoutReloadable(), next.withoutReloadable()
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	var out []string
+	for i := range va.NumField() {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			name, _, _ := strings.Cut(va.Type().Field(i).Tag.Get("json"), ",")
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func (c Config) withoutReloadable() Config {
+	c.PublicURL = ""
+	c.Telegram.Chats = nil
+	c.Rules, c.Schedules, c.Templates = nil, nil, Templates{}
+	c.Limits.MaxUploadMB, c.Limits.TelegramMaxMB = 0, 0
+	return c
+}
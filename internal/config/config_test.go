@@ -0,0 +1,210 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"home-alarm-bot/internal/schedule"
+	"home-alarm-bot/internal/telegram"
+)
+
+// clearEnv blanks the whole environment for the test so the host's
+// settings cannot leak in; the config treats empty variables as unset.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		k, _, _ := strings.Cut(kv, "=")
+		t.Setenv(k, "")
+	}
+}
+
+func writeConfig(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bot.toml")
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadExample(t *testing.T) {
+	clearEnv(t)
+	c, err := Load("../../config.example.toml")
+	if err != nil {
+		t.Fatalf("config.example.toml: %v", err)
+	}
+	if c.ACL()[11111111] != telegram.Admin || len(c.Schedules) != 2 || len(c.HTTP().Clients) != 2 {
+		t.Fatalf("loaded %+v", c)
+	}
+	if c.HTTP().MaxUpload != 100<<20 || time.Duration(c.Sensors.Devices[0].Heartbeat) != 10*time.Minute {
+		t.Fatalf("limits or durations not applied: %+v", c)
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+listen = "127.0.0.1:9000"
+[telegram]
+token = "from-file"
+[alarm]
+base_url = "http://panel.lan"
+`)
+	t.Setenv("BOT_TOKEN", "from-env")
+	t.Setenv("TELEGRAM_CHATS", "42:operator")
+	t.Setenv("ALARM_POLL_INTERVAL", "1m")
+	t.Setenv("MQTT_COMMAND_SECRETS", "alice:k1")
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Telegram.Token != "from-env" || c.Listen != "127.0.0.1:9000" {
+		t.Fatalf("token %q listen %q", c.Telegram.Token, c.Listen)
+	}
+	if c.ACL()[42] != telegram.Operator || time.Duration(c.Alarm.PollInterval) != time.Minute || c.Bridge().Secrets["alice"] != "k1" {
+		t.Fatalf("env overrides not applied: %+v", c)
+	}
+}
+
+func TestLoadEnvOnly(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("BOT_TOKEN", "tok")
+	t.Setenv("SERVER_BASE_URL", "http://panel.lan")
+	c, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Listen != "127.0.0.1:8080" || c.DataDir != "data" || !c.Sensors.Auto {
+		t.Fatalf("defaults not applied: %+v", c)
+	}
+	if c.HTTP().AllowUnauthenticated {
+		t.Fatal("API open by default")
+	}
+	t.Setenv("API_ALLOW_UNAUTHENTICATED", "true")
+	if c, err = Load(""); err != nil || !c.HTTP().AllowUnauthenticated {
+		t.Fatalf("API_ALLOW_UNAUTHENTICATED not applied: %v", err)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+listen = "nowhere"
+[telegram]
+[[telegram.chats]]
+id = 1
+role = "owner"
+[[telegram.chats]]
+id = 2
+role = "viewer"
+[[telegram.chats]]
+id = 2
+role = "admin"
+[alarm]
+driver = "carrier-pigeon"
+[[schedules]]
+at = "25:00"
+action = "arm"
+[templates]
+caption = "{{.Nope"
+`)
+	t.Setenv("MAX_UPLOAD_MB", "lots")
+	t.Setenv("MQTT_PASSWORD", "pw")
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, want := range []string{
+		"MAX_UPLOAD_MB", "listen", "telegram.token", "unknown role", "listed twice", "alarm.driver", "mqtt.password", "schedule", "caption template",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadEnvListsReportDuplicates(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("BOT_TOKEN", "tok")
+	t.Setenv("SERVER_BASE_URL", "http://panel.lan")
+	t.Setenv("TELEGRAM_CHATS", "1:admin,1:viewer")
+	t.Setenv("MQTT_COMMAND_SECRETS", "alice:k1,bob:k1")
+	t.Setenv("MQTT_HA_CODES", "alice:1234,alice:5678")
+	_, err := Load("")
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, want := range []string{
+		"telegram.chats 1: listed twice", "mqtt.command_secrets bob: same secret as alice", "mqtt.ha_codes alice: listed twice",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+
+	for _, bad := range []string{"12345", "abc:admin"} {
+		t.Setenv("TELEGRAM_CHATS", bad)
+		if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "want chat_id:role") {
+			t.Errorf("TELEGRAM_CHATS=%q: err = %v", bad, err)
+		}
+	}
+	t.Setenv("TELEGRAM_CHATS", "")
+	t.Setenv("MQTT_COMMAND_SECRETS", "nocolon")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "want actor:secret") {
+		t.Errorf("MQTT_COMMAND_SECRETS=nocolon: err = %v", err)
+	}
+}
+
+func TestLoadSecretsTable(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+[telegram]
+token = "tok"
+[alarm]
+base_url = "http://panel.lan"
+[mqtt.command_secrets]
+alice = "k1"
+bob = "k2"
+[mqtt.ha_codes]
+alice = "1234"
+`)
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := c.Bridge()
+	if b.Secrets["alice"] != "k1" || b.Secrets["bob"] != "k2" || b.HACodes["1234"] != "alice" {
+		t.Fatalf("bridge config %+v", b)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "[telegram]\ntoken = \"x\"\ntokn = \"typo\"\n")
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), `unknown field "tokn"`) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestNeedsRestart(t *testing.T) {
+	a := Default()
+	b := a
+	b.Telegram.Chats = []Chat{{ID: 1, Role: telegram.Admin}}
+	b.Schedules = []schedule.Entry{{At: "23:00", Action: "arm"}}
+	b.Templates.Caption = "{{.Zone}}"
+	b.Limits.MaxUploadMB = 1
+	if got := a.NeedsRestart(b); len(got) != 0 {
+		t.Fatalf("reloadable changes reported: %v", got)
+	}
+	b.Listen = "0.0.0.0:80"
+	b.Limits.ArchiveMaxMB = 1
+	got := a.NeedsRestart(b)
+	if strings.Join(got, ",") != "listen,limits" {
+		t.Fatalf("NeedsRestart = %v", got)
+	}
+}
@@ -0,0 +1,351 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML reads the part of TOML that config.example.toml uses: comments,
+// [tables] and [[arrays of tables]] with dotted names, key = value with bare
+// keys, basic "…" strings, decimal integers, booleans and arrays (which may
+// span lines). Anything else TOML allows — multi-line and literal strings,
+// inline tables, dotted or quoted keys, floats, dates — is rejected with an
+// error naming it rather than half-parsed. Keys may not be defined twice.
+//
+// The bot has no dependencies beyond godotenv and speaks MQTT and SSE with
+// its own small implementations; a TOML or YAML library would be larger
+// than this file and pull in more than the config needs. JSON, which the
+// standard library reads, has no comments, and a config file people edit by
+// hand next to secrets wants them. The result is decoded as JSON, so the
+// field types, Duration and the unknown-key check come from encoding/json
+// either way; swapping in a library would only replace this function.
+func parseTOML(data string) (map[string]any, error) {
+	p := &tomlParser{s: data, line: 1}
+	root := map[string]any{}
+	cur := root
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return root, nil
+		}
+		var err error
+		if p.peek() == '[' {
+			cur, err = p.header(root)
+		} else {
+			err = p.keyValue(cur)
+		}
+		if err == nil {
+			err = p.endOfLine()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.line, err)
+		}
+	}
+}
+
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) eof() bool  { return p.pos >= len(p.s) }
+func (p *tomlParser) peek() byte { return p.s[p.pos] }
+
+func (p *tomlParser) next() byte {
+	c := p.s[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *tomlParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.s[p.pos:], prefix) {
+		for range len(prefix) {
+			p.next()
+		}
+		return true
+	}
+	return false
+}
+
+// skipSpace skips spaces and tabs on the current line.
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments.
+func (p *tomlParser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n':
+			p.next()
+		case '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	if !p.eof() && p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.pos++
+		}
+	}
+	p.consume("\r")
+	if p.eof() || p.consume("\n") {
+		return nil
+	}
+	return fmt.Errorf("unexpected %q after value", p.peek())
+}
+
+// header handles [table] and [[array]] lines and returns the table that
+// the following keys go into.
+func (p *tomlParser) header(root map[string]any) (map[string]any, error) {
+	p.next()
+	array := p.consume("[")
+	var path []string
+	for {
+		p.skipSpace()
+		k, err := p.bareKey()
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, k)
+		p.skipSpace()
+		if !p.consume(".") {
+			break
+		}
+	}
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !p.consume(closing) {
+		return nil, fmt.Errorf("table %s: missing %s", strings.Join(path, "."), closing)
+	}
+
+	t := root
+	for i, k := range path {
+		last := i == len(path)-1
+		switch v := t[k].(type) {
+		case nil:
+			if last && array {
+				nt := map[string]any{}
+				t[k] = []any{nt}
+				return nt, nil
+			}
+			nt := map[string]any{}
+			t[k], t = nt, nt
+		case map[string]any:
+			if last && array {
+				return nil, fmt.Errorf("%s is a table, not an array of tables", strings.Join(path, "."))
+			}
+			t = v
+		case []any:
+			nt, ok := v[len(v)-1].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a table", strings.Join(path[:i+1], "."))
+			}
+			if last && array {
+				nt = map[string]any{}
+				t[k] = append(v, nt)
+				return nt, nil
+			}
+			if last {
+				return nil, fmt.Errorf("%s is an array of tables", strings.Join(path, "."))
+			}
+			t = nt
+		default:
+			return nil, fmt.Errorf("%s is already a value", strings.Join(path[:i+1], "."))
+		}
+	}
+	return t, nil
+}
+
+// keyValue parses key = value into t.
+func (p *tomlParser) keyValue(t map[string]any) error {
+	k, err := p.bareKey()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if !p.eof() && p.peek() == '.' {
+		return fmt.Errorf("key %s.…: dotted keys are not supported, use a [table]", k)
+	}
+	if !p.consume("=") {
+		return fmt.Errorf("key %s: missing =", k)
+	}
+	p.skipSpace()
+	v, err := p.value()
+	if err != nil {
+		return fmt.Errorf("key %s: %w", k, err)
+	}
+	if _, dup := t[k]; dup {
+		return fmt.Errorf("key %s defined twice", k)
+	}
+	t[k] = v
+	return nil
+}
+
+// bareKey parses a key or table name part of letters, digits, _ and -.
+func (p *tomlParser) bareKey() (string, error) {
+	if p.eof() {
+		return "", fmt.Errorf("missing key")
+	}
+	if c := p.peek(); c == '"' || c == '\'' {
+		return "", fmt.Errorf("quoted keys are not supported")
+	}
+	start := p.pos
+	for !p.eof() && isBare(p.peek()) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", fmt.Errorf("unexpected %q, want a key", p.peek())
+	}
+	return p.s[start:p.pos], nil
+}
+
+func isBare(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (p *tomlParser) value() (any, error) {
+	if p.eof() {
+		return nil, fmt.Errorf("missing value")
+	}
+	switch c := p.peek(); {
+	case strings.HasPrefix(p.s[p.pos:], `"""`) || strings.HasPrefix(p.s[p.pos:], `'''`):
+		return nil, fmt.Errorf(`multi-line strings are not supported, use "…" with \n`)
+	case c == '\'':
+		return nil, fmt.Errorf(`literal strings are not supported, use "…"`)
+	case c == '"':
+		return p.str()
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return nil, fmt.Errorf("inline tables are not supported, use a [table] or [[array]]")
+	case p.consume("true"):
+		return true, nil
+	case p.consume("false"):
+		return false, nil
+	default:
+		return p.integer()
+	}
+}
+
+func (p *tomlParser) array() ([]any, error) {
+	p.next()
+	out := []any{}
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if p.consume("]") {
+			return out, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+		p.skipBlank()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if !p.consume(",") {
+			p.skipBlank()
+			if !p.consume("]") {
+				return nil, fmt.Errorf("array: want , or ]")
+			}
+			return out, nil
+		}
+	}
+}
+
+// integer parses a decimal integer with an optional sign.
+func (p *tomlParser) integer() (any, error) {
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n#,]", rune(p.peek())) {
+		p.pos++
+	}
+	raw := p.s[start:p.pos]
+	if raw == "" {
+		return nil, fmt.Errorf("unexpected %q, want a value", p.peek())
+	}
+	digits := strings.TrimLeft(raw, "+-")
+	if len(raw)-len(digits) <= 1 && digits != "" && strings.Trim(digits, "0123456789") == "" {
+		if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("bad value %q (strings must be quoted; only decimal integers are supported)", raw)
+}
+
+// str parses a basic "…" string on one line.
+func (p *tomlParser) str() (string, error) {
+	p.next()
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", fmt.Errorf("unterminated string")
+		}
+		switch c := p.next(); c {
+		case '"':
+			return sb.String(), nil
+		case '\n':
+			return "", fmt.Errorf("newline in string")
+		case '\\':
+			if err := p.escape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+func (p *tomlParser) escape(sb *strings.Builder) error {
+	if p.eof() {
+		return fmt.Errorf("unterminated string")
+	}
+	switch c := p.next(); c {
+	case 'n':
+		sb.WriteByte('\n')
+	case 't':
+		sb.WriteByte('\t')
+	case 'r':
+		sb.WriteByte('\r')
+	case '"', '\\':
+		sb.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.s) {
+			return fmt.Errorf("short \\%c escape", c)
+		}
+		r, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return fmt.Errorf("bad \\%c escape", c)
+		}
+		p.pos += n
+		sb.WriteRune(rune(r))
+	default:
+		return fmt.Errorf("unknown escape \\%c", c)
+	}
+	return nil
+}
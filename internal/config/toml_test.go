@@ -0,0 +1,106 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	got, err := parseTOML(`
+# comment
+title = "home" # trailing comment
+path = "C:\\path\tend \u00e9"
+n = 1000
+neg = -5
+on = true
+list = [
+  "a", # first
+  "b",
+]
+
+[server]
+addr = "127.0.0.1:8080"
+
+[server.tls]
+cert = "c.pem"
+
+[[server.clients]]
+name = "cam"
+
+[[chats]]
+id = 1
+
+[[chats]]
+id = 2
+role = "viewer"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"title": "home",
+		"path":  "C:\\path\tend é",
+		"n":     int64(1000),
+		"neg":   int64(-5),
+		"on":    true,
+		"list":  []any{"a", "b"},
+		"server": map[string]any{
+			"addr":    "127.0.0.1:8080",
+			"tls":     map[string]any{"cert": "c.pem"},
+			"clients": []any{map[string]any{"name": "cam"}},
+		},
+		"chats": []any{
+			map[string]any{"id": int64(1)},
+			map[string]any{"id": int64(2), "role": "viewer"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got  %#v\nwant %#v", got, want)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	cases := map[string]string{
+		"a = 1\na = 2":      "line 2: key a defined twice",
+		"a = hello":         "line 1: key a: bad value \"hello\"",
+		"a = \"open":        "unterminated string",
+		"a = [1, 2":         "unterminated array",
+		"[t\na = 1":         "missing ]",
+		"a = 1 b = 2":       "unexpected 'b' after value",
+		"a = 1\n[a]":        "a is already a value",
+		"a = \"\\q\"":       "unknown escape",
+		"[[t]]\nx = 1\n[t]": "t is an array of tables",
+	}
+	for in, want := range cases {
+		_, err := parseTOML(in)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseTOML(%q) = %v, want error containing %q", in, err, want)
+		}
+	}
+}
+
+// TestParseTOMLRejects checks that TOML the parser does not implement is
+// refused by name rather than misread.
+func TestParseTOMLRejects(t *testing.T) {
+	cases := map[string]string{
+		"a = \"\"\"\nx\"\"\"":      "multi-line strings are not supported",
+		"a = '''\nx'''":            "multi-line strings are not supported",
+		"a = 'x'":                  "literal strings are not supported",
+		"a = { b = 1 }":            "inline tables are not supported",
+		"a = [{ b = 1 }]":          "inline tables are not supported",
+		"a.b = 1":                  "dotted keys are not supported",
+		"\"a\" = 1":                "quoted keys are not supported",
+		"[\"a\"]":                  "quoted keys are not supported",
+		"a = 0.5":                  "bad value \"0.5\"",
+		"a = 1_000":                "bad value \"1_000\"",
+		"a = 0x10":                 "bad value \"0x10\"",
+		"a = 1979-05-27T07:32:00Z": "bad value",
+	}
+	for in, want := range cases {
+		_, err := parseTOML(in)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseTOML(%q) = %v, want error containing %q", in, err, want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"home-alarm-bot/internal/state"
+)
+
+// Client is a caller allowed to use the local API. A client authenticates
+// with a bearer token, an HMAC signature, or either if both are set.
+//
+// Signed requests carry three headers:
+//
+//	X-Client:    the client Name
+//	X-Timestamp: Unix seconds
+//	X-Signature: hex HMAC-SHA256 over "<timestamp>\n<METHOD>\n<request URI>\n<body>"
+//
+// The request URI is the path with its query, e.g. "/clips?limit=5", so the
+// query cannot be changed without breaking the signature.
+//
+// The timestamp must be within the replay window, and each signature is
+// accepted once.
+type Client struct {
+	Name   string
+	Token  string
+	Secret string
+}
+
+// ParseClients reads a comma-separated list of name:kind:value entries, where
+// kind is "token" or "hmac". Entries for the same name are merged, e.g.
+// "camera:token:abc,panel:hmac:s3cret".
+func ParseClients(spec string) ([]Client, error) {
+	var out []Client
+	idx := map[string]int{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("client %q: want name:token:value or name:hmac:value", entry)
+		}
+		i, ok := idx[parts[0]]
+		if !ok {
+			i = len(out)
+			idx[parts[0]] = i
+			out = append(out, Client{Name: parts[0]})
+		}
+		switch parts[1] {
+		case "token":
+			out[i].Token = parts[2]
+		case "hmac":
+			out[i].Secret = parts[2]
+		default:
+			return nil, fmt.Errorf("client %q: unknown kind %q", parts[0], parts[1])
+		}
+	}
+	return out, nil
+}
+
+type clientKey struct{}
+
+// ClientName returns the authenticated client of r, or "" when auth is off.
+func ClientName(r *http.Request) string {
+	name, _ := r.Context().Value(clientKey{}).(string)
+	return name
+}
+
+// authenticator checks requests against the configured clients.
+type authenticator struct {
+	clients map[string]Client
+	window  time.Duration
+
+	mu       sync.Mutex
+	seen     map[string]time.Time // signature → expiry, for replay protection
+	reported map[string]time.Time // remote host → last Telegram report
+}
+
+// reportEvery limits how often unauthorized attempts from one host are
+// reported to Telegram; every attempt is still logged.
+const reportEvery = 5 * time.Minute
+
+func newAuthenticator(clients []Client, window time.Duration) *authenticator {
+	a := &authenticator{
+		clients:  make(map[string]Client),
+		window:   window,
+		seen:     make(map[string]time.Time),
+		reported: make(map[string]time.Time),
+	}
+	for _, c := range clients {
+		a.clients[c.Name] = c
+	}
+	return a
+}
+
+func (a *authenticator) enabled() bool { return len(a.clients) > 0 }
+
+var errUnauthorized = errors.New("missing credentials")
+
+// check authenticates r and returns the client name. For signed requests the
+// body is read in full and r.Body replaced so handlers can still read it.
+func (a *authenticator) check(r *http.Request, maxBody int64) (string, error) {
+	if tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, c := range a.clients {
+			if c.Token != "" && subtle.ConstantTimeCompare([]byte(c.Token), []byte(tok)) == 1 {
+				return c.Name, nil
+			}
+		}
+		return "", errors.New("unknown bearer token")
+	}
+
+	name := r.Header.Get("X-Client")
+	if name == "" {
+		return "", errUnauthorized
+	}
+	c, ok := a.clients[name]
+	if !ok || c.Secret == "" {
+		return "", fmt.Errorf("unknown client %q", name)
+	}
+
+	ts := r.Header.Get("X-Timestamp")
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", errors.New("bad timestamp")
+	}
+	if d := time.Since(time.Unix(secs, 0)); d > a.window || d < -a.window {
+		return "", errors.New("timestamp outside replay window")
+	}
+	sig, err := hex.DecodeString(r.Header.Get("X-Signature"))
+	if err != nil || len(sig) == 0 {
+		return "", errors.New("bad signature encoding")
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", ts, r.Method, r.URL.RequestURI())
+	body, err := spoolBody(r.Body, mac, maxBody)
+	if err != nil {
+		return "", err
+	}
+	r.Body = body
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return "", errors.New("signature mismatch")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for k, exp := range a.seen {
+		if now.After(exp) {
+			delete(a.seen, k)
+		}
+	}
+	key := string(sig)
+	if _, dup := a.seen[key]; dup {
+		return "", errors.New("replayed request")
+	}
+	a.seen[key] = now.Add(2 * a.window)
+	return c.Name, nil
+}
+
+// shouldReport reports whether an attempt from host should reach Telegram.
+func (a *authenticator) shouldReport(host string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if last, ok := a.reported[host]; ok && time.Since(last) < reportEvery {
+		return false
+	}
+	a.reported[host] = time.Now()
+	return true
+}
+
+// spoolBody copies body into w (the signature hash) and returns a replacement
+// body for the handler. Up to videoMemBuffer bytes stay in memory; larger
+// bodies go to a temp file that is removed on Close.
+func spoolBody(body io.ReadCloser, w io.Writer, limit int64) (io.ReadCloser, error) {
+	defer body.Close()
+
+	var head bytes.Buffer
+	n, err := io.Copy(io.MultiWriter(w, &head), io.LimitReader(body, videoMemBuffer))
+	if err != nil {
+		return nil, err
+	}
+	if n < videoMemBuffer {
+		return io.NopCloser(&head), nil
+	}
+
+	f, err := os.CreateTemp("", "home-alarm-bot-body-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(head.Bytes()); err == nil {
+		_, err = io.Copy(io.MultiWriter(w, f), io.LimitReader(body, limit))
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return tempBody{f}, nil
+}
+
+// tempBody deletes its backing file when closed.
+type tempBody struct{ *os.File }
+
+func (t tempBody) Close() error {
+	err := t.File.Close()
+	os.Remove(t.Name())
+	return err
+}
+
+// protect wraps h so it only runs for authenticated clients. Failures are
+// logged, recorded in the history and reported to Telegram.
+func (s *Server) protect(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg, _ := s.config()
+		if !s.auth.enabled() {
+			if cfg.AllowUnauthenticated {
+				h(w, r)
+				return
+			}
+			log.Printf("httpapi: refused %s %s: no API clients configured", r.Method, r.URL.Path)
+			writeError(w, http.StatusUnauthorized, "no API clients configured")
+			return
+		}
+		name, err := s.auth.check(r, cfg.MaxUpload)
+		if err != nil {
+			s.unauthorized(r, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="home-alarm-bot"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, name)))
+	}
+}
+
+func (s *Server) unauthorized(r *http.Request, reason error) {
+	host := remoteHost(r)
+	log.Printf("httpapi: unauthorized %s %s from %s: %v", r.Method, r.URL.Path, host, reason)
+	s.store.Record(state.Event{Kind: "auth", Text: "unauthorized local API request",
+		Fields: map[string]string{"method": r.Method, "path": r.URL.Path, "remote": host, "reason": reason.Error()}})
+	if s.auth.shouldReport(host) {
+		s.bot.Broadcast(fmt.Sprintf("⚠️ Unauthorized local API request: %s %s from %s (%v)",
+			r.Method, r.URL.Path, host, reason))
+	}
+}
@@ -0,0 +1,122 @@
+package httpapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"home-alarm-bot/internal/state"
+)
+
+func TestParseClients(t *testing.T) {
+	got, err := ParseClients("cam:token:abc, panel:hmac:s3cret,cam:hmac:k")
+	if err != nil {
+		t.Fatalf("ParseClients: %v", err)
+	}
+	if len(got) != 2 || got[0] != (Client{"cam", "abc", "k"}) || got[1] != (Client{"panel", "", "s3cret"}) {
+		t.Fatalf("unexpected clients: %+v", got)
+	}
+	for _, bad := range []string{"cam", "cam:token:", "cam:password:x"} {
+		if _, err := ParseClients(bad); err == nil {
+			t.Errorf("ParseClients(%q): expected error", bad)
+		}
+	}
+}
+
+func signedRequest(t *testing.T, method, url, path, body, secret string, ts time.Time) *http.Request {
+	t.Helper()
+	req, _ := http.NewRequest(method, url+path, strings.NewReader(body))
+	stamp := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", stamp, method, path, body)
+	req.Header.Set("X-Client", "panel")
+	req.Header.Set("X-Timestamp", stamp)
+	req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestAuth(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Clients = []Client{{Name: "cam", Token: "tok"}, {Name: "panel", Secret: "s3cret"}}
+	base, st := startConfiguredServer(t, cfg)
+
+	do := func(req *http.Request) int {
+		t.Helper()
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// No credentials → 401 and an auth event in the history.
+	req, _ := http.NewRequest(http.MethodPost, base+"/arm", nil)
+	if code := do(req); code != http.StatusUnauthorized {
+		t.Fatalf("anonymous /arm = %d, want 401", code)
+	}
+	if st.Get() != state.Disarmed {
+		t.Fatalf("anonymous request changed state")
+	}
+	if h := st.History(1); len(h) != 1 || h[0].Kind != "auth" || h[0].Fields["path"] != "/arm" {
+		t.Fatalf("unauthorized attempt not recorded: %+v", h)
+	}
+
+	// Bearer token.
+	req, _ = http.NewRequest(http.MethodPost, base+"/arm", nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	if code := do(req); code != http.StatusOK || st.Get() != state.Armed {
+		t.Fatalf("bearer /arm = %d, state %s", code, st.Get())
+	}
+	if h := st.History(1); len(h) != 1 || h[0].Fields["actor"] != "cam" {
+		t.Fatalf("body-less /arm not attributed to its client: %+v", h)
+	}
+	req.Header.Set("Authorization", "Bearer wrong")
+	if code := do(req); code != http.StatusUnauthorized {
+		t.Fatalf("wrong bearer = %d, want 401", code)
+	}
+
+	// HMAC signature, accepted once.
+	now := time.Now()
+	if code := do(signedRequest(t, http.MethodPost, base, "/disarm", "", "s3cret", now)); code != http.StatusOK {
+		t.Fatalf("signed /disarm = %d, want 200", code)
+	}
+	if code := do(signedRequest(t, http.MethodPost, base, "/disarm", "", "s3cret", now)); code != http.StatusUnauthorized {
+		t.Fatalf("replayed /disarm = %d, want 401", code)
+	}
+	if code := do(signedRequest(t, http.MethodPost, base, "/disarm", "", "wrong", now.Add(time.Second))); code != http.StatusUnauthorized {
+		t.Fatalf("bad-key /disarm = %d, want 401", code)
+	}
+	if code := do(signedRequest(t, http.MethodPost, base, "/disarm", "", "s3cret", now.Add(-time.Hour))); code != http.StatusUnauthorized {
+		t.Fatalf("stale /disarm = %d, want 401", code)
+	}
+
+	// The query is signed too.
+	if code := do(signedRequest(t, http.MethodGet, base, "/webhooks?limit=1", "", "s3cret", now)); code != http.StatusOK {
+		t.Fatalf("signed /webhooks?limit=1 = %d, want 200", code)
+	}
+	req = signedRequest(t, http.MethodGet, base, "/webhooks?limit=1", "", "s3cret", now.Add(time.Second))
+	req.URL.RawQuery = "limit=50"
+	if code := do(req); code != http.StatusUnauthorized {
+		t.Fatalf("signed request with altered query = %d, want 401", code)
+	}
+}
+
+func TestAuth_NoClientsFailsClosed(t *testing.T) {
+	base, st := startConfiguredServer(t, DefaultConfig())
+
+	res, err := http.Post(base+"/arm", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized || st.Get() != state.Disarmed {
+		t.Fatalf("/arm without clients = %d, state %s; want 401 and no change", res.StatusCode, st.Get())
+	}
+}
@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// DefaultCaptionTemplate renders the caption of a /video clip. It is executed
+// with a clipMeta; every field may be empty.
+const DefaultCaptionTemplate = `🚨 Possible break-in detected{{with .Camera}} on {{.}}{{end}}{{with .Zone}} ({{.}}){{end}}` +
+	`{{with .EventType}}
+Event: {{.}}{{end}}{{if .Confidence}} · {{percent .Confidence}}{{end}}` +
+	`{{if not .Time.IsZero}}
+🕒 {{.Time.Format "2006-01-02 15:04:05"}}{{end}}`
+
+// clipMeta is the optional camera metadata sent alongside a /video upload.
+type clipMeta struct {
+	Camera     string
+	Zone       string
+	EventType  string
+	Confidence float64 // 0..1, zero when not reported
+	Time       time.Time
+}
+
+var eventTypeRe = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// parseClipMeta reads and validates the metadata form fields: camera, zone,
+// event_type, confidence (0..1) and event_time (RFC 3339 or Unix seconds).
+func parseClipMeta(form url.Values) (clipMeta, error) {
+	var m clipMeta
+	var err error
+
+	if m.Camera, err = label(form, "camera"); err != nil {
+		return m, err
+	}
+	if m.Zone, err = label(form, "zone"); err != nil {
+		return m, err
+	}
+
+	if v := strings.ToLower(strings.TrimSpace(form.Get("event_type"))); v != "" {
+		if !eventTypeRe.MatchString(v) {
+			return m, fmt.Errorf("event_type %q: use up to 32 of a-z, 0-9 and _", v)
+		}
+		m.EventType = v
+	}
+
+	if v := strings.TrimSpace(form.Get("confidence")); v != "" {
+		c, err := strconv.ParseFloat(v, 64)
+		if err != nil || c < 0 || c > 1 {
+			return m, fmt.Errorf("confidence %q: want a number between 0 and 1", v)
+		}
+		m.Confidence = c
+	}
+
+	if v := strings.TrimSpace(form.Get("event_time")); v != "" {
+		if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+			m.Time = time.Unix(secs, 0)
+		} else if m.Time, err = time.Parse(time.RFC3339, v); err != nil {
+			return m, fmt.Errorf("event_time %q: want RFC 3339 or Unix seconds", v)
+		}
+	}
+	return m, nil
+}
+
+// label reads a short human-readable form field.
+func label(form url.Values, key string) (string, error) {
+	v := strings.TrimSpace(form.Get(key))
+	if len(v) > 64 {
+		return "", fmt.Errorf("%s: longer than 64 bytes", key)
+	}
+	if strings.IndexFunc(v, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("%s: contains control characters", key)
+	}
+	return v, nil
+}
+
+// fields flattens m for the state history; empty values are omitted.
+func (m clipMeta) fields() map[string]string {
+	f := make(map[string]string)
+	set := func(k, v string) {
+		if v != "" {
+			f[k] = v
+		}
+	}
+	set("camera", m.Camera)
+	set("zone", m.Zone)
+	set("event_type", m.EventType)
+	if m.Confidence > 0 {
+		f["confidence"] = strconv.FormatFloat(m.Confidence, 'f', -1, 64)
+	}
+	if !m.Time.IsZero() {
+		f["event_time"] = m.Time.Format(time.RFC3339)
+	}
+	return f
+}
+
+func parseCaptionTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultCaptionTemplate
+	}
+	return template.New("caption").Funcs(template.FuncMap{
+		"percent": func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+	}).Parse(text)
+}
@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseClipMeta(t *testing.T) {
+	form := url.Values{
+		"camera":     {"Porch"},
+		"zone":       {"front"},
+		"event_type": {"Person"},
+		"confidence": {"0.87"},
+		"event_time": {"2024-05-01T12:30:00Z"},
+	}
+	m, err := parseClipMeta(form)
+	if err != nil {
+		t.Fatalf("parseClipMeta: %v", err)
+	}
+	if m.Camera != "Porch" || m.Zone != "front" || m.EventType != "person" || m.Confidence != 0.87 {
+		t.Fatalf("unexpected meta: %+v", m)
+	}
+	if f := m.fields(); f["event_time"] != "2024-05-01T12:30:00Z" || f["camera"] != "Porch" {
+		t.Fatalf("unexpected fields: %v", f)
+	}
+
+	tmpl, err := parseCaptionTemplate("")
+	if err != nil {
+		t.Fatalf("default template: %v", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, m); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	for _, want := range []string{"on Porch (front)", "Event: person", "87%", "2024-05-01 12:30:00"} {
+		if !strings.Contains(sb.String(), want) {
+			t.Fatalf("caption %q missing %q", sb.String(), want)
+		}
+	}
+
+	sb.Reset()
+	tmpl.Execute(&sb, clipMeta{})
+	if sb.String() != "🚨 Possible break-in detected" {
+		t.Fatalf("empty-meta caption = %q", sb.String())
+	}
+}
+
+func TestParseClipMeta_Invalid(t *testing.T) {
+	cases := map[string]url.Values{
+		"confidence range": {"confidence": {"1.5"}},
+		"confidence nan":   {"confidence": {"high"}},
+		"event_time":       {"event_time": {"yesterday"}},
+		"event_type":       {"event_type": {"glass break!"}},
+		"camera control":   {"camera": {"cam\x00"}},
+		"zone too long":    {"zone": {strings.Repeat("z", 65)}},
+	}
+	for name, form := range cases {
+		if _, err := parseClipMeta(form); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
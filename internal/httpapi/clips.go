@@ -0,0 +1,68 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"home-alarm-bot/internal/archive"
+)
+
+// handleClips lists archived clips as JSON, newest first. ?limit=N caps the
+// list (default 50).
+func (s *Server) handleClips(w http.ResponseWriter, r *http.Request) {
+	if s.clips == nil {
+		writeError(w, http.StatusNotFound, "clip archive disabled")
+		return
+	}
+	limit := 50
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	writeJSON(w, s.clips.Recent(limit))
+}
+
+// handleClip serves the archived clip /clips/<id> as a download. The caller
+// either authenticates as an API client or presents the clip's own ?token=,
+// which is what links sent to Telegram carry.
+func (s *Server) handleClip(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/clips/")
+	if token := r.URL.Query().Get("token"); token != "" {
+		s.serveClip(w, r, id, token)
+		return
+	}
+	s.protect(func(w http.ResponseWriter, r *http.Request) { s.serveClip(w, r, id, "") })(w, r)
+}
+
+// clipLink is the path of a link that fetches c without credentials.
+func clipLink(c archive.Clip) string {
+	return "/clips/" + c.ID + "?token=" + c.Token
+}
+
+// serveClip sends clip id, provided token matches it if not empty. A wrong
+// token looks the same as an unknown clip.
+func (s *Server) serveClip(w http.ResponseWriter, r *http.Request, id, token string) {
+	if s.clips == nil {
+		writeError(w, http.StatusNotFound, "clip not found")
+		return
+	}
+	c, f, err := s.clips.Open(id)
+	if err == nil && token != "" && !sameToken(c.Token, token) {
+		f.Close()
+		err = archive.ErrNotFound
+	}
+	if errors.Is(err, archive.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "clip not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", c.Name))
+	http.ServeContent(w, r, c.Name, c.Time, f)
+}
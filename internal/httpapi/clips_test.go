@@ -0,0 +1,145 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"home-alarm-bot/internal/archive"
+)
+
+func TestClips_ArchiveListDownload(t *testing.T) {
+	a, err := archive.Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("archive.Open: %v", err)
+	}
+	base, st := startConfiguredServer(t, openConfig(), func(s *Server) { s.SetArchive(a) })
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("camera", "yard")
+	fw, _ := mw.CreateFormFile("file", "yard.mp4")
+	fw.Write([]byte("clip-bytes"))
+	mw.Close()
+
+	res, err := http.Post(base+"/video", mw.FormDataContentType(), body)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("/video: err=%v status=%d", err, res.StatusCode)
+	}
+
+	res, err = http.Get(base + "/clips")
+	if err != nil {
+		t.Fatalf("/clips: %v", err)
+	}
+	var clips []archive.Clip
+	if err := json.NewDecoder(res.Body).Decode(&clips); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	res.Body.Close()
+	if len(clips) != 1 || clips[0].Fields["camera"] != "yard" {
+		t.Fatalf("clips = %+v", clips)
+	}
+	if h := st.History(1); h[0].Fields["clip"] != clips[0].ID {
+		t.Fatalf("history does not reference clip: %+v", h[0])
+	}
+
+	res, err = http.Get(base + "/clips/" + clips[0].ID)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	data, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(data) != "clip-bytes" {
+		t.Fatalf("downloaded %q", data)
+	}
+
+	res, _ = http.Get(base + "/clips/unknown")
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown clip status = %d, want 404", res.StatusCode)
+	}
+}
+
+func TestClips_DownloadNeedsAuthOrToken(t *testing.T) {
+	a, err := archive.Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("archive.Open: %v", err)
+	}
+	clip, _ := a.Save(strings.NewReader("clip-bytes"), archive.Clip{Name: "yard.mp4"})
+	cfg := openConfig()
+	cfg.Clients = []Client{{Name: "cam", Token: "tok"}}
+	base, _ := startConfiguredServer(t, cfg, func(s *Server) { s.SetArchive(a) })
+
+	get := func(path, bearer string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, base+path, nil)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := get("/clips/"+clip.ID, ""); code != http.StatusUnauthorized {
+		t.Fatalf("anonymous clip download = %d, want 401", code)
+	}
+	if code := get("/clips/"+clip.ID, "tok"); code != http.StatusOK {
+		t.Fatalf("client clip download = %d, want 200", code)
+	}
+	if code := get(clipLink(clip), ""); code != http.StatusOK {
+		t.Fatalf("tokened link = %d, want 200", code)
+	}
+	if code := get("/clips/"+clip.ID+"?token=guess", ""); code != http.StatusNotFound {
+		t.Fatalf("wrong token = %d, want 404", code)
+	}
+}
+
+func TestClips_TooLargeForArchive(t *testing.T) {
+	a, err := archive.Open(t.TempDir(), 4, 0)
+	if err != nil {
+		t.Fatalf("archive.Open: %v", err)
+	}
+	base, st := startConfiguredServer(t, openConfig(), func(s *Server) { s.SetArchive(a) })
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "yard.mp4")
+	fw.Write([]byte("clip-bytes"))
+	mw.Close()
+
+	res, err := http.Post(base+"/video", mw.FormDataContentType(), body)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("/video: err=%v status=%d", err, res.StatusCode)
+	}
+	if clips := a.Recent(0); len(clips) != 0 {
+		t.Fatalf("oversized clip archived: %+v", clips)
+	}
+	if h := st.History(1); h[0].Fields["clip"] != "" {
+		t.Fatalf("history links a clip that was not kept: %+v", h[0])
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	base, _ := startTestServer(t)
+
+	res, err := http.Get(base + "/metrics")
+	if err != nil {
+		t.Fatalf("/metrics: %v", err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	if ct := res.Header.Get("Content-Type"); !bytes.HasPrefix([]byte(ct), []byte("text/plain")) {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	for _, name := range []string{"# TYPE telegram_api_requests_total counter", "# TYPE alarm_request_duration_seconds histogram"} {
+		if !bytes.Contains(b, []byte(name)) {
+			t.Errorf("/metrics lacks %q:\n%s", name, b)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package httpapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// downloads keeps clips that are too large for Telegram on disk for a while
+// and serves them under /download/<token>.
+type downloads struct {
+	dir string
+
+	mu    sync.Mutex
+	ttl   time.Duration
+	files map[string]download
+}
+
+type download struct {
+	path    string
+	name    string
+	expires time.Time
+}
+
+// sweepEvery is how often expired and orphaned downloads are removed.
+const sweepEvery = 10 * time.Minute
+
+// newDownloads serves files kept in dir for ttl. Files left in dir by an
+// earlier run, whose tokens died with it, are removed once they are older
+// than ttl.
+func newDownloads(dir string, ttl time.Duration) *downloads {
+	d := &downloads{dir: dir, ttl: ttl, files: make(map[string]download)}
+	d.sweep()
+	return d
+}
+
+// setTTL changes how long files saved from now on are kept, and the age at
+// which the sweep removes orphans. Downloads already handed out keep their
+// expiry.
+func (d *downloads) setTTL(ttl time.Duration) {
+	d.mu.Lock()
+	d.ttl = ttl
+	d.mu.Unlock()
+}
+
+// save copies r to disk and returns the token it can be fetched with.
+func (d *downloads) save(r io.Reader, name string) (string, error) {
+	d.expire()
+
+	if err := os.MkdirAll(d.dir, 0o700); err != nil {
+		return "", err
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+
+	path := filepath.Join(d.dir, token)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	d.mu.Lock()
+	d.files[token] = download{path: path, name: filepath.Base(name), expires: time.Now().Add(d.ttl)}
+	d.mu.Unlock()
+	return token, nil
+}
+
+// expire deletes downloads whose TTL has passed.
+func (d *downloads) expire() {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for token, f := range d.files {
+		if now.After(f.expires) {
+			os.Remove(f.path)
+			delete(d.files, token)
+		}
+	}
+}
+
+// sweep expires downloads and removes files in dir that no token refers to
+// and that are older than the TTL. The age check spares a file that save is
+// still writing.
+func (d *downloads) sweep() {
+	d.expire()
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cutoff := time.Now().Add(-d.ttl)
+	for _, e := range entries {
+		if _, ok := d.files[e.Name()]; ok || e.IsDir() {
+			continue
+		}
+		if info, err := e.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(d.dir, e.Name()))
+		}
+	}
+}
+
+// run sweeps every interval until stop is closed.
+func (d *downloads) run(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			d.sweep()
+		}
+	}
+}
+
+func (d *downloads) serve(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/download/")
+
+	d.mu.Lock()
+	f, ok := d.files[token]
+	d.mu.Unlock()
+	if !ok || time.Now().After(f.expires) {
+		writeError(w, http.StatusNotFound, "download not found")
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", f.name))
+	http.ServeFile(w, r, f.path)
+}
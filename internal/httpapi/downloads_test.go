@@ -0,0 +1,119 @@
+package httpapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/state"
+	"home-alarm-bot/internal/telegram"
+	"home-alarm-bot/internal/testutil"
+)
+
+func TestDownloads_SaveServeExpire(t *testing.T) {
+	d := newDownloads(t.TempDir(), time.Hour)
+
+	token, err := d.save(strings.NewReader("clip"), "big.mp4")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	d.serve(rec, httptest.NewRequest(http.MethodGet, "/download/"+token, nil))
+	body, _ := io.ReadAll(rec.Body)
+	if rec.Code != http.StatusOK || string(body) != "clip" {
+		t.Fatalf("serve: status %d body %q", rec.Code, body)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "big.mp4") {
+		t.Fatalf("Content-Disposition = %q", cd)
+	}
+
+	d.mu.Lock()
+	f := d.files[token]
+	f.expires = time.Now().Add(-time.Second)
+	d.files[token] = f
+	d.mu.Unlock()
+
+	rec = httptest.NewRecorder()
+	d.serve(rec, httptest.NewRequest(http.MethodGet, "/download/"+token, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expired download status = %d, want 404", rec.Code)
+	}
+}
+
+func TestDownloads_SweepOrphans(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"orphan", "fresh"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if name == "orphan" {
+			os.Chtimes(path, old, old)
+		}
+	}
+
+	// Files from an earlier run are swept on start once past the TTL.
+	d := newDownloads(dir, time.Hour)
+	if _, err := os.Stat(filepath.Join(dir, "orphan")); !os.IsNotExist(err) {
+		t.Fatalf("orphan survived startup: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fresh")); err != nil {
+		t.Fatalf("fresh file removed: %v", err)
+	}
+
+	// A live download is kept by the timer sweep even once it is old.
+	token, _ := d.save(strings.NewReader("clip"), "big.mp4")
+	os.Chtimes(filepath.Join(dir, token), old, old)
+	os.Chtimes(filepath.Join(dir, "fresh"), old, old)
+	stop := make(chan struct{})
+	go d.run(5*time.Millisecond, stop)
+	defer close(stop)
+	testutil.WaitFor(t, "the timer sweep to remove the orphan", func() bool {
+		_, err := os.Stat(filepath.Join(dir, "fresh"))
+		return os.IsNotExist(err)
+	})
+	if _, err := os.Stat(filepath.Join(dir, token)); err != nil {
+		t.Fatalf("live download swept: %v", err)
+	}
+}
+
+// Configure only changes the TTL: tokens already handed out stay valid and
+// the directory is not swept again.
+func TestServer_ConfigureKeepsDownloads(t *testing.T) {
+	st := state.New()
+	s := New(st, telegram.NewBot(telegram.NewAPI("TESTTOKEN"), st, alarm.New("http://dummy")))
+	dl := newDownloads(t.TempDir(), time.Hour)
+	s.dl = dl
+	token, err := dl.save(strings.NewReader("clip"), "big.mp4")
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	cfg := openConfig()
+	cfg.DownloadTTL = 2 * time.Hour
+	if err := s.Configure(cfg); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	if s.dl != dl {
+		t.Fatal("Configure replaced the downloads")
+	}
+	rec := httptest.NewRecorder()
+	s.dl.serve(rec, httptest.NewRequest(http.MethodGet, "/download/"+token, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("download after Configure: status %d", rec.Code)
+	}
+	dl.mu.Lock()
+	ttl := dl.ttl
+	dl.mu.Unlock()
+	if ttl != 2*time.Hour {
+		t.Fatalf("ttl = %s, want 2h", ttl)
+	}
+}
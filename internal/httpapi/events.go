@@ -0,0 +1,42 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"home-alarm-bot/internal/sensors"
+)
+
+// handleEvents ingests one sensor event as JSON, e.g.
+//
+//	{"type":"glass_break","sensor_id":"kitchen-1","zone":"kitchen"}
+//
+// and routes it through the rules engine. The response names the action
+// taken: {"action":"incident"}.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	var ev sensors.Event
+	if err := decodeJSON(r, maxCommandBody, &ev); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if err := ev.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	action, err := s.route.Route(ev)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, struct {
+		Action string `json:"action"`
+	}{string(action)})
+}
+
+// handleSensors lists the sensor registry as JSON.
+func (s *Server) handleSensors(w http.ResponseWriter, r *http.Request) {
+	if s.reg == nil {
+		writeJSON(w, []sensors.Sensor{})
+		return
+	}
+	writeJSON(w, s.reg.List())
+}
@@ -0,0 +1,119 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"home-alarm-bot/internal/rules"
+	"home-alarm-bot/internal/sensors"
+	"home-alarm-bot/internal/state"
+)
+
+func TestEventsEndpoint(t *testing.T) {
+	base, st := startTestServer(t)
+
+	post := func(body string) (int, string) {
+		t.Helper()
+		res, err := http.Post(base+"/events", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("/events: %v", err)
+		}
+		defer res.Body.Close()
+		var out struct {
+			Action string `json:"action"`
+		}
+		json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out.Action
+	}
+
+	if code, action := post(`{"type":"glass_break","sensor_id":"k1","zone":"kitchen"}`); code != 200 || action != "incident" {
+		t.Fatalf("glass break: %d %q", code, action)
+	}
+	if code, action := post(`{"type":"motion","sensor_id":"m1"}`); code != 200 || action != "log" {
+		t.Fatalf("disarmed motion: %d %q", code, action)
+	}
+	st.Set(state.Armed)
+	if code, action := post(`{"type":"motion","sensor_id":"m1"}`); code != 200 || action != "incident" {
+		t.Fatalf("armed motion: %d %q", code, action)
+	}
+
+	if code, _ := post(`{"type":"earthquake","sensor_id":"x"}`); code != http.StatusBadRequest {
+		t.Fatalf("unknown type status = %d, want 400", code)
+	}
+	if h := st.History(0); len(h) != 3 || h[0].Kind != "incident" || h[0].Fields["zone"] != "kitchen" {
+		t.Fatalf("history = %+v", h)
+	}
+}
+
+func TestEventsEndpoint_RegistryAndBypass(t *testing.T) {
+	reg := sensors.NewRegistry([]sensors.Sensor{{ID: "g1", Zone: "garage"}}, false)
+	base, _ := startConfiguredServer(t, openConfig(), func(s *Server) { s.SetRegistry(reg) })
+
+	res, _ := http.Post(base+"/events", "application/json", strings.NewReader(`{"type":"motion","sensor_id":"ghost"}`))
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("unknown sensor status = %d, want 422", res.StatusCode)
+	}
+
+	reg.SetBypass([]string{"garage"})
+	res, _ = http.Post(base+"/events", "application/json", strings.NewReader(`{"type":"glass_break","sensor_id":"g1","battery":55}`))
+	var out struct {
+		Action string `json:"action"`
+	}
+	json.NewDecoder(res.Body).Decode(&out)
+	if out.Action != "log" {
+		t.Fatalf("bypassed zone action = %q, want log", out.Action)
+	}
+
+	res, _ = http.Get(base + "/sensors")
+	var list []sensors.Sensor
+	json.NewDecoder(res.Body).Decode(&list)
+	if len(list) != 1 || list[0].Battery != 55 || list[0].State != sensors.GlassBreak {
+		t.Fatalf("/sensors = %+v", list)
+	}
+
+	// Disarming clears the bypass.
+	http.Post(base+"/disarm", "application/json", nil)
+	if reg.Bypassed("garage") {
+		t.Fatal("bypass survived /disarm")
+	}
+}
+
+func TestReloadRules(t *testing.T) {
+	var srv *Server
+	base, _ := startConfiguredServer(t, openConfig(), func(s *Server) { srv = s })
+	action := func() string {
+		res, err := http.Post(base+"/events", "application/json", strings.NewReader(`{"type":"motion","sensor_id":"m1"}`))
+		if err != nil {
+			t.Fatalf("/events: %v", err)
+		}
+		defer res.Body.Close()
+		var out struct {
+			Action string `json:"action"`
+		}
+		json.NewDecoder(res.Body).Decode(&out)
+		return out.Action
+	}
+
+	cfg := openConfig()
+	cfg.Rules = []rules.Rule{{Action: "explode"}}
+	if err := srv.Reload(cfg); err == nil {
+		t.Fatal("Reload accepted an unknown action")
+	}
+	if got := action(); got != "log" {
+		t.Fatalf("after rejected reload motion = %q, want log", got)
+	}
+
+	cfg.Rules = []rules.Rule{{Types: []sensors.Type{sensors.Motion}, Action: rules.Broadcast}}
+	cfg.MaxUpload = 1 << 10
+	if err := srv.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := action(); got != "broadcast" {
+		t.Fatalf("after reload motion = %q, want broadcast", got)
+	}
+	if c, _ := srv.config(); c.MaxUpload != 1<<10 {
+		t.Fatalf("MaxUpload = %d after reload", c.MaxUpload)
+	}
+}
@@ -0,0 +1,137 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Check is one readiness probe. It returns nil when the dependency it looks
+// at is usable and should give up when ctx is done.
+type Check func(ctx context.Context) error
+
+// checkTimeout bounds a whole /readyz run; a variable so tests can shorten it.
+var checkTimeout = 5 * time.Second
+
+// readyEvery is how long a /readyz answer is reused, so probes cannot drive
+// calls to Telegram and the alarm server faster than that.
+const readyEvery = 5 * time.Second
+
+// readiness is the last /readyz answer.
+type readiness struct {
+	mu      sync.Mutex // held while the checks run, so probes share one run
+	at      time.Time
+	results map[string]CheckResult
+}
+
+// AddCheck makes /readyz run c under name, e.g. "telegram" or "storage".
+// Call it before Listen.
+func (s *Server) AddCheck(name string, c Check) {
+	if s.checks == nil {
+		s.checks = make(map[string]Check)
+	}
+	s.checks[name] = c
+}
+
+// WritableDir returns a Check that creates and removes a file in dir.
+func WritableDir(dir string) Check {
+	return func(context.Context) error {
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return err
+		}
+		name := f.Name()
+		_, err = f.Write([]byte("ok"))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if rerr := os.Remove(name); err == nil {
+			err = rerr
+		}
+		return err
+	}
+}
+
+// CheckResult is the outcome of one readiness check. Error is only ever
+// "timeout" or "unavailable": /readyz is unauthenticated and the errors
+// themselves can carry secrets, such as the bot token in a Telegram URL, so
+// they are logged instead.
+type CheckResult struct {
+	OK       bool    `json:"ok"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_ms"`
+}
+
+// handleHealthz answers as long as the process serves HTTP at all.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, struct {
+		Status string `json:"status"`
+		Uptime string `json:"uptime"`
+	}{"ok", time.Since(s.started).Round(time.Second).String()})
+}
+
+// handleReadyz answers 200 when every check passes, 503 otherwise, with the
+// result of each:
+//
+//	{"status": "fail", "checks": {"telegram": {"ok": true, "duration_ms": 80.2},
+//	  "alarm": {"ok": false, "error": "unavailable", "duration_ms": 0.1}}}
+//
+// The checks run concurrently, at most once per readyEvery.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	s.ready.mu.Lock()
+	if time.Since(s.ready.at) >= readyEvery {
+		s.ready.results, s.ready.at = s.runChecks(), time.Now()
+	}
+	results := s.ready.results
+	s.ready.mu.Unlock()
+
+	status, code := "ok", http.StatusOK
+	for _, res := range results {
+		if !res.OK {
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Status string                 `json:"status"`
+		Checks map[string]CheckResult `json:"checks"`
+	}{status, results})
+}
+
+// runChecks runs every check concurrently within checkTimeout.
+func (s *Server) runChecks() map[string]CheckResult {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	results := make(map[string]CheckResult, len(s.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, c := range s.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := c(ctx)
+			res := CheckResult{OK: err == nil, Duration: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				log.Printf("readyz: %s: %v", name, err)
+				res.Error = "unavailable"
+				if errors.Is(err, context.DeadlineExceeded) {
+					res.Error = "timeout"
+				}
+			}
+			mu.Lock()
+			results[name] = res
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
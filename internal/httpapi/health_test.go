@@ -0,0 +1,88 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthz(t *testing.T) {
+	base, _ := startTestServer(t)
+	res, err := http.Get(base + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("/healthz = %d", res.StatusCode)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	old := checkTimeout
+	checkTimeout = 50 * time.Millisecond
+	defer func() { checkTimeout = old }()
+
+	var alarmCalls atomic.Int32
+	base, _ := startConfiguredServer(t, openConfig(), func(s *Server) {
+		s.AddCheck("storage", WritableDir(t.TempDir()))
+		s.AddCheck("alarm", func(context.Context) error {
+			alarmCalls.Add(1)
+			return errors.New(`Get "https://api.telegram.org/bot123:SECRET/getMe": connection refused`)
+		})
+		s.AddCheck("telegram", func(ctx context.Context) error {
+			<-ctx.Done() // hangs until the deadline
+			return ctx.Err()
+		})
+	})
+
+	type body struct {
+		Status string                 `json:"status"`
+		Checks map[string]CheckResult `json:"checks"`
+	}
+	get := func() (int, body, string) {
+		res, err := http.Get(base + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		raw, _ := io.ReadAll(res.Body)
+		var b body
+		json.Unmarshal(raw, &b)
+		return res.StatusCode, b, string(raw)
+	}
+
+	code, b, raw := get()
+	if code != http.StatusServiceUnavailable || b.Status != "fail" {
+		t.Fatalf("/readyz = %d %+v", code, b)
+	}
+	if !b.Checks["storage"].OK || b.Checks["alarm"].Error != "unavailable" || b.Checks["telegram"].Error != "timeout" {
+		t.Fatalf("checks = %+v", b.Checks)
+	}
+	if strings.Contains(raw, "SECRET") {
+		t.Fatalf("/readyz leaks the error: %s", raw)
+	}
+
+	// A second probe right away reuses the answer.
+	if code, _, _ := get(); code != http.StatusServiceUnavailable || alarmCalls.Load() != 1 {
+		t.Fatalf("second /readyz = %d after %d alarm checks", code, alarmCalls.Load())
+	}
+}
+
+func TestReadyzAllPass(t *testing.T) {
+	base, _ := startConfiguredServer(t, openConfig(), func(s *Server) {
+		s.AddCheck("storage", WritableDir(t.TempDir()))
+	})
+	res, err := http.Get(base + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("/readyz = %d", res.StatusCode)
+	}
+}
@@ -1,76 +1,498 @@
 package httpapi
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	"home-alarm-bot/internal/archive"
+	"home-alarm-bot/internal/metrics"
+	"home-alarm-bot/internal/rules"
+	"home-alarm-bot/internal/sensors"
 	"home-alarm-bot/internal/state"
 	"home-alarm-bot/internal/telegram"
+	"home-alarm-bot/internal/webhook"
 )
 
 type Server struct {
-	store *state.Store
-	bot   *telegram.Bot
+	store  *state.Store
+	bot    *telegram.Bot
+	dl     *downloads
+	clips  *archive.Archive
+	auth   *authenticator
+	route  *rules.Router
+	rules  *rules.Engine
+	reg    *sensors.Registry
+	hooks  *webhook.Dispatcher
+	events *hub
+	ui     *sessions
+	logins *loginLimiter
+	checks map[string]Check
+	ready  readiness
+
+	started time.Time
+
+	hmu    sync.Mutex // guards hs and closed
+	hs     *http.Server
+	closed bool
+
+	mu   sync.RWMutex // guards what Reload may change
+	cfg  Config
+	tmpl *template.Template
+}
+
+// Config holds the tunable parts of the local API.
+type Config struct {
+	// MaxUpload caps the body of a single /video or /snapshot request.
+	MaxUpload int64
+	// TelegramMax is the largest file the bot may send through Telegram
+	// (50 MB for bots). Bigger clips are offered as a download link instead.
+	TelegramMax int64
+	// PublicURL is the base URL recipients use to reach /download and /clips
+	// links. If
+	// empty, the Host of the uploading request is used.
+	PublicURL string
+	// DownloadTTL is how long an oversized clip stays downloadable.
+	DownloadTTL time.Duration
+	// CaptionTemplate is a text/template for /video captions; see
+	// DefaultCaptionTemplate for the fields available.
+	CaptionTemplate string
+	// Clients may call the API. With none configured every protected
+	// request is refused, unless AllowUnauthenticated is set.
+	Clients []Client
+	// AllowUnauthenticated accepts every request while no Clients are
+	// configured, as before authentication existed. Only for a listener
+	// nothing untrusted can reach.
+	AllowUnauthenticated bool
+	// ReplayWindow bounds how far an HMAC-signed request's timestamp may be
+	// from the server clock.
+	ReplayWindow time.Duration
+	// Rules decide what happens to /events; nil means rules.Default().
+	Rules []rules.Rule
+	// UIUsers may log in to the web UI under /ui/. With none the UI is off.
+	UIUsers []UIUser
+	// SessionTTL is how long a web UI login lasts.
+	SessionTTL time.Duration
+}
+
+// DefaultConfig returns the limits used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		MaxUpload:    100 << 20,
+		TelegramMax:  50 << 20,
+		DownloadTTL:  24 * time.Hour,
+		ReplayWindow: 5 * time.Minute,
+		SessionTTL:   12 * time.Hour,
+	}
+}
+
+// Validate reports every problem with c that Configure would trip over or
+// that would make the API unusable.
+func (c Config) Validate() error {
+	var errs []error
+	if c.MaxUpload <= 0 || c.TelegramMax <= 0 {
+		errs = append(errs, errors.New("upload limits must be positive"))
+	}
+	if c.DownloadTTL <= 0 || c.ReplayWindow <= 0 || c.SessionTTL <= 0 {
+		errs = append(errs, errors.New("download TTL, replay window and session TTL must be positive"))
+	}
+	if c.PublicURL != "" {
+		if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("public URL %q: want http(s)://host", c.PublicURL))
+		}
+	}
+	if _, err := parseCaptionTemplate(c.CaptionTemplate); err != nil {
+		errs = append(errs, fmt.Errorf("caption template: %w", err))
+	}
+	if err := rules.Validate(c.Rules); err != nil {
+		errs = append(errs, err)
+	}
+	for _, cl := range c.Clients {
+		if cl.Name == "" || cl.Token == "" && cl.Secret == "" {
+			errs = append(errs, fmt.Errorf("client %q: needs a name and a token or secret", cl.Name))
+		}
+	}
+	for _, u := range c.UIUsers {
+		if u.Name == "" || u.Password == "" {
+			errs = append(errs, fmt.Errorf("ui user %q: needs a name and a password", u.Name))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func New(store *state.Store, bot *telegram.Bot) *Server {
-	return &Server{store: store, bot: bot}
+	s := &Server{store: store, bot: bot, events: newHub(store), logins: newLoginLimiter(), started: time.Now()}
+	s.dl = newDownloads(filepath.Join(os.TempDir(), "home-alarm-bot-downloads"), DefaultConfig().DownloadTTL)
+	_ = s.Configure(DefaultConfig())
+	return s
+}
+
+// Configure replaces the server's Config. Call it before Listen.
+func (s *Server) Configure(c Config) error {
+	tmpl, err := parseCaptionTemplate(c.CaptionTemplate)
+	if err != nil {
+		return fmt.Errorf("caption template: %w", err)
+	}
+	s.mu.Lock()
+	s.cfg, s.tmpl = c, tmpl
+	s.mu.Unlock()
+	s.bot.SetMaxUpload(c.TelegramMax)
+	s.dl.setTTL(c.DownloadTTL)
+	s.auth = newAuthenticator(c.Clients, c.ReplayWindow)
+	s.ui = newSessions(c.SessionTTL)
+
+	rs := c.Rules
+	if rs == nil {
+		rs = rules.Default()
+	}
+	if s.rules, err = rules.New(rs); err != nil {
+		return err
+	}
+	s.route = rules.NewRouter(s.rules, s.store, s.bot, s.reg)
+	return nil
+}
+
+// Reload applies the parts of c that are safe to change while serving: the
+// upload and Telegram size limits, PublicURL, CaptionTemplate and Rules. The
+// rest of c is ignored; changing it needs Configure and a restart. On error
+// nothing changes.
+func (s *Server) Reload(c Config) error {
+	tmpl, err := parseCaptionTemplate(c.CaptionTemplate)
+	if err != nil {
+		return fmt.Errorf("caption template: %w", err)
+	}
+	rs := c.Rules
+	if rs == nil {
+		rs = rules.Default()
+	}
+	if err := s.rules.Replace(rs); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg.MaxUpload, s.cfg.TelegramMax, s.cfg.PublicURL = c.MaxUpload, c.TelegramMax, c.PublicURL
+	s.cfg.CaptionTemplate, s.cfg.Rules = c.CaptionTemplate, c.Rules
+	s.tmpl = tmpl
+	s.bot.SetMaxUpload(c.TelegramMax)
+	return nil
+}
+
+// config returns the current Config and caption template.
+func (s *Server) config() (Config, *template.Template) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg, s.tmpl
+}
+
+// clearBypass drops any zone bypass once the system is disarmed.
+func (s *Server) clearBypass() {
+	if s.reg != nil {
+		_ = s.reg.SetBypass(nil)
+	}
 }
 
+// Router returns the sensor event router, for feeding events that do not
+// arrive over HTTP and for the offline watchdog.
+func (s *Server) Router() *rules.Router { return s.route }
+
+// cameraSeen counts an upload as a heartbeat from the camera.
+func (s *Server) cameraSeen(camera, zone string) {
+	if camera == "" {
+		return
+	}
+	_, _ = s.route.Route(sensors.Event{Type: sensors.Heartbeat, SensorID: camera, Zone: zone, Time: time.Now()})
+}
+
+// SetRegistry tracks /events senders in reg and honours its zone bypass.
+func (s *Server) SetRegistry(reg *sensors.Registry) {
+	s.reg = reg
+	s.route = rules.NewRouter(s.rules, s.store, s.bot, reg)
+}
+
+// SetWebhooks exposes d's delivery log under /webhooks.
+func (s *Server) SetWebhooks(d *webhook.Dispatcher) { s.hooks = d }
+
+// SetArchive makes /video keep every clip in a and serves them under /clips.
+func (s *Server) SetArchive(a *archive.Archive) { s.clips = a }
+
+// Listen serves the API on addr until Shutdown, after which it returns nil.
 func (s *Server) Listen(addr string) error {
-	mux := http.NewServeMux()
+	hs := &http.Server{Addr: addr, Handler: s.Handler()}
+	hs.RegisterOnShutdown(s.events.close)
+	s.hmu.Lock()
+	if s.closed {
+		s.hmu.Unlock()
+		return nil
+	}
+	s.hs = hs
+	s.hmu.Unlock()
 
-	mux.HandleFunc("/arm", func(w http.ResponseWriter, r *http.Request) {
-		s.store.Set(state.Armed)
-		s.bot.Broadcast("🔒 System Armed (via local API)")
-		w.WriteHeader(http.StatusOK)
-	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.dl.run(sweepEvery, stop)
 
-	mux.HandleFunc("/disarm", func(w http.ResponseWriter, r *http.Request) {
-		s.store.Set(state.Disarmed)
-		s.bot.Broadcast("🔓 System Disarmed (via local API)")
-		w.WriteHeader(http.StatusOK)
-	})
+	if err := hs.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
 
-	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
-		_ = json.NewEncoder(w).Encode(struct {
+// Shutdown stops accepting connections, ends the open event streams and
+// waits for the requests in flight until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.hmu.Lock()
+	hs := s.hs
+	s.closed = true
+	s.hmu.Unlock()
+	if hs == nil {
+		return nil
+	}
+	return hs.Shutdown(ctx)
+}
+
+// Handler returns the routes of the local API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	post := func(h http.HandlerFunc) http.HandlerFunc { return allow(s.protect(h), http.MethodPost) }
+	get := func(h http.HandlerFunc) http.HandlerFunc { return allow(s.protect(h), http.MethodGet, http.MethodHead) }
+
+	mux.HandleFunc("/arm", post(s.command(func(c Command) { s.armed(c, "local API") })))
+	mux.HandleFunc("/disarm", post(s.command(func(c Command) { s.disarmed(c, "local API") })))
+
+	mux.HandleFunc("/status", get(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, struct {
 			State state.AlarmState `json:"state"`
 		}{s.store.Get()})
-	})
+	}))
 
-	mux.HandleFunc("/alarm", func(w http.ResponseWriter, r *http.Request) {
-		s.bot.Broadcast("🚨 **ALARM TRIGGERED**")
-	})
+	mux.HandleFunc("/alarm", post(s.command(s.alarmed)))
+	mux.HandleFunc("/success", post(s.command(s.pinDisarmed)))
+
+	mux.HandleFunc("/events", post(s.handleEvents))
+	mux.HandleFunc("/events/stream", get(s.handleStream))
+	mux.HandleFunc("/sensors", get(s.handleSensors))
+	mux.HandleFunc("/video", post(requireMultipart(s.handleVideo)))
+	mux.HandleFunc("/snapshot", post(requireMultipart(s.handleSnapshot)))
+	mux.HandleFunc("/clips", get(s.handleClips))
+	mux.HandleFunc("/webhooks", get(s.handleWebhooks))
+	mux.HandleFunc("/metrics", get(metrics.Default.Handler().ServeHTTP))
+
+	// Supervisors probe these without credentials.
+	mux.HandleFunc("/healthz", allow(s.handleHealthz, http.MethodGet, http.MethodHead))
+	mux.HandleFunc("/readyz", allow(s.handleReadyz, http.MethodGet, http.MethodHead))
+
+	// Download links are sent to Telegram chats; their unguessable IDs are
+	// the credential, so they are not behind protect.
+	mux.HandleFunc("/download/", allow(s.dl.serve, http.MethodGet, http.MethodHead))
+	mux.HandleFunc("/clips/", allow(s.handleClip, http.MethodGet, http.MethodHead))
 
-	mux.HandleFunc("/success", func(w http.ResponseWriter, r *http.Request) {
-		s.bot.Broadcast("**System disarmed via PIN**")
+	// The web UI logs users in itself rather than using the API clients.
+	mux.Handle("/ui/", s.uiHandler())
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not found")
 	})
 
-	mux.HandleFunc("/video", s.handleVideo)
-	
+	return mux
+}
+
+// armed records and announces that the system was armed through via.
+func (s *Server) armed(c Command, via string) {
+	s.store.Set(state.Armed)
+	s.store.Record(state.Event{Kind: "state", Text: string(state.Armed), Fields: c.fields()})
+	s.bot.Broadcast("🔒 System Armed (via " + via + ")" + c.suffix())
+}
+
+// disarmed records and announces that the system was disarmed through via.
+func (s *Server) disarmed(c Command, via string) {
+	s.store.Set(state.Disarmed)
+	s.clearBypass()
+	s.store.Record(state.Event{Kind: "state", Text: string(state.Disarmed), Fields: c.fields()})
+	s.bot.Broadcast("🔓 System Disarmed (via " + via + ")" + c.suffix())
+}
+
+func (s *Server) alarmed(c Command) {
+	s.store.Record(state.Event{Kind: "alarm", Text: "alarm triggered", Fields: c.fields()})
+	s.bot.Broadcast("🚨 **ALARM TRIGGERED**" + c.suffix())
+}
 
-	return http.ListenAndServe(addr, mux)
+func (s *Server) pinDisarmed(c Command) {
+	s.clearBypass()
+	s.store.Record(state.Event{Kind: "success", Text: "disarmed via PIN", Fields: c.fields()})
+	s.bot.Broadcast("**System disarmed via PIN**" + c.suffix())
 }
 
+// videoMemBuffer is how much of an upload is kept in memory; anything larger
+// is spooled to a temp file.
+const videoMemBuffer = 1 << 20
+
 func (s *Server) handleVideo(w http.ResponseWriter, r *http.Request) {
-    r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+    cfg, tmpl := s.config()
+    r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxUpload)
 
-    if err := r.ParseMultipartForm(10 << 20); err != nil {
-        http.Error(w, "invalid multipart form", http.StatusBadRequest)
+    if err := r.ParseMultipartForm(videoMemBuffer); err != nil {
+        writeError(w, http.StatusBadRequest, "invalid multipart form")
         return
     }
+    defer r.MultipartForm.RemoveAll()
 
-    file, _, err := r.FormFile("file")
+    file, fh, err := r.FormFile("file")
     if err != nil {
-        http.Error(w, "file field missing", http.StatusBadRequest)
+        writeError(w, http.StatusBadRequest, "file field missing")
         return
     }
     defer file.Close()
 
-    if err := s.bot.BroadcastVideo(file, "🚨 Possible break-in detected"); err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+    meta, err := parseClipMeta(r.MultipartForm.Value)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    var sb strings.Builder
+    if err := tmpl.Execute(&sb, meta); err != nil {
+        writeError(w, http.StatusInternalServerError, "caption template: "+err.Error())
+        return
+    }
+    caption := sb.String()
+    fields := meta.fields()
+    s.cameraSeen(meta.Camera, meta.Zone)
+
+    name := fh.Filename
+    if name == "" {
+        name = "alarm.mp4"
+    }
+    playable := isPlayableVideo(file)
+
+    var link string
+    if s.clips != nil {
+        clip, err := s.clips.Save(file, archive.Clip{Name: name, Video: playable, Caption: caption, Fields: fields})
+        tooLarge := errors.Is(err, archive.ErrTooLarge)
+        if err == nil || tooLarge {
+            _, err = file.Seek(0, io.SeekStart)
+        }
+        if err != nil {
+            writeError(w, http.StatusInternalServerError, "archive: "+err.Error())
+            return
+        }
+        if tooLarge {
+            log.Printf("httpapi: clip %s (%d MB) not archived: larger than the archive limit", name, fh.Size>>20)
+        } else {
+            fields["clip"] = clip.ID
+            link = s.publicURL(r, clipLink(clip))
+        }
+    }
+    s.store.Record(state.Event{Kind: "video", Text: caption, Fields: fields})
+
+    switch {
+    case fh.Size > cfg.TelegramMax:
+        if link == "" {
+            token, err := s.dl.save(file, name)
+            if err != nil {
+                writeError(w, http.StatusInternalServerError, err.Error())
+                return
+            }
+            link = s.publicURL(r, "/download/"+token)
+        }
+        s.bot.Broadcast(fmt.Sprintf("%s\n🎞 Clip too large for Telegram (%d MB), download: %s",
+            caption, fh.Size>>20, link))
+    case !playable:
+        err = s.bot.BroadcastDocument(file, name, caption)
+    default:
+        err = s.bot.BroadcastVideo(file, caption)
+    }
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err.Error())
         return
     }
 
     w.WriteHeader(http.StatusOK)
-}
\ No newline at end of file
+}
+
+// publicURL turns a local path into a link recipients can open.
+func (s *Server) publicURL(r *http.Request, path string) string {
+	cfg, _ := s.config()
+	base := strings.TrimRight(cfg.PublicURL, "/")
+	if base == "" {
+		base = "http://" + r.Host
+	}
+	return base + path
+}
+
+// isPlayableVideo reports whether f looks like a format Telegram plays inline
+// (MP4). Anything else is sent as a document. f is rewound afterwards.
+func isPlayableVideo(f multipart.File) bool {
+	return sniff(f) == "video/mp4"
+}
+
+// handleSnapshot accepts one or more JPEG/PNG images in repeated "file" fields
+// plus an optional "camera" name, and broadcasts them as a photo or album.
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	cfg, _ := s.config()
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxUpload)
+
+	if err := r.ParseMultipartForm(videoMemBuffer); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		writeError(w, http.StatusBadRequest, "file field missing")
+		return
+	}
+
+	photos := make([]io.Reader, 0, len(headers))
+	for _, fh := range headers {
+		f, err := fh.Open()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer f.Close()
+		if !isImage(f) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s is not an image", fh.Filename))
+			return
+		}
+		photos = append(photos, f)
+	}
+
+	caption := "📸 Snapshot"
+	if cam := strings.TrimSpace(r.FormValue("camera")); cam != "" {
+		caption += " from " + cam
+		s.cameraSeen(cam, "")
+	}
+
+	if err := s.bot.BroadcastPhotos(photos, caption); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// isImage sniffs the first bytes of f and rewinds it afterwards.
+func isImage(f multipart.File) bool {
+	return strings.HasPrefix(sniff(f), "image/")
+}
+
+// sniff returns the detected content type of f and rewinds it.
+func sniff(f multipart.File) string {
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return ""
+	}
+	return http.DetectContentType(head[:n])
+}
@@ -3,7 +3,9 @@ package httpapi
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net"
 	"net/http"
@@ -31,6 +33,21 @@ func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
 // well as references to the store and bot so the caller can make assertions.
 func startTestServer(t *testing.T) (base string, st *state.Store) {
     t.Helper()
+    return startConfiguredServer(t, openConfig())
+}
+
+// openConfig is DefaultConfig with authentication explicitly switched off,
+// for tests that are not about it.
+func openConfig() Config {
+    cfg := DefaultConfig()
+    cfg.AllowUnauthenticated = true
+    return cfg
+}
+
+// startConfiguredServer is startTestServer with a custom Config. Each setup
+// func runs on the Server before it starts listening.
+func startConfiguredServer(t *testing.T, cfg Config, setup ...func(*Server)) (base string, st *state.Store) {
+    t.Helper()
 
     // Preserve the real transport so we can delegate localhost calls to it.
     realTransport := http.DefaultTransport
@@ -57,6 +74,12 @@ func startTestServer(t *testing.T) (base string, st *state.Store) {
     bot := telegram.NewBot(tgAPI, st, dummyAlarm)
 
     srv := New(st, bot)
+    if err := srv.Configure(cfg); err != nil {
+        t.Fatalf("Configure: %v", err)
+    }
+    for _, f := range setup {
+        f(srv)
+    }
 
     // Bind an available port first so we know the chosen address.
     l, err := net.Listen("tcp", "127.0.0.1:0")
@@ -86,7 +109,7 @@ func TestArmDisarmStatus(t *testing.T) {
     base, st := startTestServer(t)
 
     // 1 — Arm -----------------------------------------------------------------
-    res, err := http.Get(base + "/arm")
+    res, err := http.Post(base+"/arm", "application/json", nil)
     if err != nil || res.StatusCode != http.StatusOK {
         t.Fatalf("/arm failed: %v, status %d", err, res.StatusCode)
     }
@@ -95,7 +118,7 @@ func TestArmDisarmStatus(t *testing.T) {
     }
 
     // 2 — Disarm --------------------------------------------------------------
-    res, err = http.Get(base + "/disarm")
+    res, err = http.Post(base+"/disarm", "application/json", nil)
     if err != nil || res.StatusCode != http.StatusOK {
         t.Fatalf("/disarm failed: %v, status %d", err, res.StatusCode)
     }
@@ -124,9 +147,9 @@ func TestSimpleBroadcastEndpoints(t *testing.T) {
     base, _ := startTestServer(t)
     paths := []string{"/alarm", "/success"}
     for _, p := range paths {
-        res, err := http.Get(base + p)
+        res, err := http.Post(base+p, "application/json", nil)
         if err != nil || res.StatusCode != http.StatusOK {
-            t.Fatalf("GET %s: err=%v status=%d", p, err, res.StatusCode)
+            t.Fatalf("POST %s: err=%v status=%d", p, err, res.StatusCode)
         }
     }
 }
@@ -158,13 +181,22 @@ func TestVideoHandler_Success(t *testing.T) {
 func TestVideoHandler_Errors(t *testing.T) {
     base, _ := startTestServer(t)
 
-    // Case 1: invalid multipart form ----------------------------------------
+    // Case 1: not multipart at all -----------------------------------------
     res, err := http.Post(base+"/video", "text/plain", strings.NewReader("oops"))
     if err != nil {
         t.Fatalf("invalid‑form POST: %v", err)
     }
+    if res.StatusCode != http.StatusUnsupportedMediaType {
+        t.Fatalf("invalid‑form status = %d, want 415", res.StatusCode)
+    }
+
+    // Case 1b: multipart header but malformed body --------------------------
+    res, err = http.Post(base+"/video", "multipart/form-data; boundary=x", strings.NewReader("oops"))
+    if err != nil {
+        t.Fatalf("malformed‑form POST: %v", err)
+    }
     if res.StatusCode != http.StatusBadRequest {
-        t.Fatalf("invalid‑form status = %d, want 400", res.StatusCode)
+        t.Fatalf("malformed‑form status = %d, want 400", res.StatusCode)
     }
 
     // Case 2: missing file field --------------------------------------------
@@ -184,4 +216,222 @@ func TestVideoHandler_Errors(t *testing.T) {
     if res.StatusCode != http.StatusBadRequest {
         t.Fatalf("missing‑file status = %d, want 400", res.StatusCode)
     }
-}
\ No newline at end of file
+}
+// A clip bigger than the in-memory buffer must still be accepted (it is
+// spooled to disk) and streamed to Telegram intact.
+func TestVideoHandler_LargeClipSpooled(t *testing.T) {
+    base, _ := startConfiguredServer(t, openConfig(), func(s *Server) {
+        s.bot.Handle(telegram.Update{Message: &telegram.Message{Text: "/start", Chat: telegram.Chat{ID: 1}}})
+    })
+
+    // Capture the uploaded file on top of the stub transport. The clip is not
+    // a real MP4, so it goes out as a document.
+    sent := make(chan []byte, 1)
+    stub := http.DefaultTransport
+    http.DefaultTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+        if strings.HasSuffix(r.URL.Path, "/sendDocument") {
+            _, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+            mr := multipart.NewReader(r.Body, params["boundary"])
+            for p, err := mr.NextPart(); err == nil; p, err = mr.NextPart() {
+                if p.FormName() == "document" {
+                    data, _ := io.ReadAll(p)
+                    sent <- data
+                }
+            }
+        }
+        return stub.RoundTrip(r)
+    })
+    t.Cleanup(func() { http.DefaultTransport = stub })
+
+    // Vary the bytes so a reordered or truncated spool would not match.
+    clip := make([]byte, videoMemBuffer+1024)
+    for i := range clip {
+        clip[i] = byte(i * 7)
+    }
+    body := &bytes.Buffer{}
+    mw := multipart.NewWriter(body)
+    fw, _ := mw.CreateFormFile("file", "clip.mp4")
+    fw.Write(clip)
+    mw.Close()
+
+    req, _ := http.NewRequest(http.MethodPost, base+"/video", body)
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+
+    res, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatalf("/video post: %v", err)
+    }
+    if res.StatusCode != http.StatusOK {
+        t.Fatalf("/video status = %d, want 200", res.StatusCode)
+    }
+    select {
+    case got := <-sent:
+        if !bytes.Equal(got, clip) {
+            t.Fatalf("Telegram received %d bytes that differ from the %d-byte upload", len(got), len(clip))
+        }
+    case <-time.After(2 * time.Second):
+        t.Fatal("no sendDocument call")
+    }
+}
+
+/* ----------------------------------------------------------------------
+   /snapshot handler ------------------------------------------------------ */
+
+// jpegHeader is enough for http.DetectContentType to report image/jpeg.
+var jpegHeader = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+
+func postSnapshot(t *testing.T, base string, files [][]byte) *http.Response {
+    t.Helper()
+
+    body := &bytes.Buffer{}
+    mw := multipart.NewWriter(body)
+    mw.WriteField("camera", "porch")
+    for i, f := range files {
+        fw, _ := mw.CreateFormFile("file", fmt.Sprintf("snap%d.jpg", i))
+        fw.Write(f)
+    }
+    mw.Close()
+
+    req, _ := http.NewRequest(http.MethodPost, base+"/snapshot", body)
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+
+    res, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatalf("/snapshot post: %v", err)
+    }
+    return res
+}
+
+func TestSnapshotHandler(t *testing.T) {
+    base, _ := startTestServer(t)
+
+    if res := postSnapshot(t, base, [][]byte{jpegHeader, jpegHeader}); res.StatusCode != http.StatusOK {
+        t.Fatalf("album status = %d, want 200", res.StatusCode)
+    }
+    if res := postSnapshot(t, base, [][]byte{[]byte("not an image")}); res.StatusCode != http.StatusBadRequest {
+        t.Fatalf("non-image status = %d, want 400", res.StatusCode)
+    }
+    if res := postSnapshot(t, base, nil); res.StatusCode != http.StatusBadRequest {
+        t.Fatalf("no-file status = %d, want 400", res.StatusCode)
+    }
+}
+
+/* ----------------------------------------------------------------------
+   Oversized clips -------------------------------------------------------- */
+
+func TestVideoHandler_OversizedOffersDownload(t *testing.T) {
+    cfg := openConfig()
+    cfg.TelegramMax = 16
+    cfg.PublicURL = "https://cam.example"
+    base, _ := startConfiguredServer(t, cfg, func(s *Server) {
+        s.bot.Handle(telegram.Update{Message: &telegram.Message{Text: "/start", Chat: telegram.Chat{ID: 1}}})
+    })
+
+    // Capture the broadcast text on top of the stub transport.
+    texts := make(chan string, 4)
+    stub := http.DefaultTransport
+    http.DefaultTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+        if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+            r.ParseForm()
+            texts <- r.PostForm.Get("text")
+        }
+        return stub.RoundTrip(r)
+    })
+    t.Cleanup(func() { http.DefaultTransport = stub })
+
+    clip := []byte(strings.Repeat("0123456789abcdef", 4))
+    body := &bytes.Buffer{}
+    mw := multipart.NewWriter(body)
+    fw, _ := mw.CreateFormFile("file", "big.mp4")
+    fw.Write(clip)
+    mw.Close()
+
+    req, _ := http.NewRequest(http.MethodPost, base+"/video", body)
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+    res, err := http.DefaultClient.Do(req)
+    if err != nil || res.StatusCode != http.StatusOK {
+        t.Fatalf("/video oversized: err=%v status=%d", err, res.StatusCode)
+    }
+
+    // The link in the broadcast must fetch the clip itself.
+    var link string
+    select {
+    case txt := <-texts:
+        _, link, _ = strings.Cut(txt, "download: ")
+    case <-time.After(2 * time.Second):
+        t.Fatal("no broadcast")
+    }
+    path, ok := strings.CutPrefix(link, cfg.PublicURL)
+    if !ok || !strings.HasPrefix(path, "/download/") {
+        t.Fatalf("broadcast link = %q", link)
+    }
+    res, err = http.Get(base + path)
+    if err != nil || res.StatusCode != http.StatusOK {
+        t.Fatalf("GET %s: err=%v status=%d", path, err, res.StatusCode)
+    }
+    got, _ := io.ReadAll(res.Body)
+    res.Body.Close()
+    if !bytes.Equal(got, clip) {
+        t.Fatalf("downloaded %q, want %q", got, clip)
+    }
+
+    res, err = http.Get(base + "/download/does-not-exist")
+    if err != nil || res.StatusCode != http.StatusNotFound {
+        t.Fatalf("unknown download: err=%v status=%d", err, res.StatusCode)
+    }
+}
+
+func TestVideoHandler_MaxUpload(t *testing.T) {
+    cfg := openConfig()
+    cfg.MaxUpload = 128
+    base, _ := startConfiguredServer(t, cfg)
+
+    body := &bytes.Buffer{}
+    mw := multipart.NewWriter(body)
+    fw, _ := mw.CreateFormFile("file", "clip.mp4")
+    fw.Write(bytes.Repeat([]byte("v"), 1024))
+    mw.Close()
+
+    res, err := http.Post(base+"/video", mw.FormDataContentType(), body)
+    if err != nil {
+        t.Fatalf("/video post: %v", err)
+    }
+    if res.StatusCode != http.StatusBadRequest {
+        t.Fatalf("over-limit status = %d, want 400", res.StatusCode)
+    }
+}
+
+func TestVideoHandler_MetadataRecorded(t *testing.T) {
+    base, st := startTestServer(t)
+
+    body := &bytes.Buffer{}
+    mw := multipart.NewWriter(body)
+    mw.WriteField("camera", "garage")
+    mw.WriteField("confidence", "0.9")
+    fw, _ := mw.CreateFormFile("file", "clip.mp4")
+    fw.Write([]byte("dummydata"))
+    mw.Close()
+
+    res, err := http.Post(base+"/video", mw.FormDataContentType(), body)
+    if err != nil || res.StatusCode != http.StatusOK {
+        t.Fatalf("/video: err=%v status=%d", err, res.StatusCode)
+    }
+    h := st.History(1)
+    if len(h) != 1 || h[0].Kind != "video" || h[0].Fields["camera"] != "garage" {
+        t.Fatalf("history = %+v", h)
+    }
+    if !strings.Contains(h[0].Text, "on garage") {
+        t.Fatalf("caption = %q", h[0].Text)
+    }
+
+    body.Reset()
+    mw = multipart.NewWriter(body)
+    mw.WriteField("confidence", "7")
+    fw, _ = mw.CreateFormFile("file", "clip.mp4")
+    fw.Write([]byte("dummydata"))
+    mw.Close()
+    res, _ = http.Post(base+"/video", mw.FormDataContentType(), body)
+    if res.StatusCode != http.StatusBadRequest {
+        t.Fatalf("bad confidence status = %d, want 400", res.StatusCode)
+    }
+}
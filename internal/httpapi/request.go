@@ -0,0 +1,205 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// Command is the JSON body accepted by the state-changing routes /arm,
+// /disarm, /alarm and /success. Every field is optional and an empty body is
+// the same as {}:
+//
+//	{
+//	  "source": "keypad",          // what sent the command, ≤ 64 bytes
+//	  "reason": "leaving for work", // free text, ≤ 256 bytes
+//	  "actor":  "alice"             // who asked for it, ≤ 64 bytes
+//	}
+//
+// When actor is empty the authenticated client name is used instead.
+type Command struct {
+	Source string `json:"source,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Actor  string `json:"actor,omitempty"`
+}
+
+// maxCommandBody caps a Command request body.
+const maxCommandBody = 4 << 10
+
+// errorBody is what every error response carries.
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// writeError sends msg as a JSON error with the given status.
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(errorBody{msg})
+}
+
+// writeJSON sends v as a 200 JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// allow rejects requests whose method is not one of methods with 405.
+func allow(h http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range methods {
+			if r.Method == m {
+				h(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+	}
+}
+
+// requireMultipart rejects non-multipart uploads with 415.
+func requireMultipart(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mt != "multipart/form-data" {
+			writeError(w, http.StatusUnsupportedMediaType, "want multipart/form-data")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// errUnsupportedMedia marks a body that is not JSON.
+var errUnsupportedMedia = errors.New("want application/json")
+
+// decodeJSON strictly decodes a JSON body of at most limit bytes into v.
+func decodeJSON(r *http.Request, limit int64, v any) error {
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+		return errUnsupportedMedia
+	}
+	dec := json.NewDecoder(io.LimitReader(r.Body, limit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	if dec.More() {
+		return errors.New("invalid JSON body: trailing data")
+	}
+	return nil
+}
+
+// writeDecodeError answers a decodeJSON or validation failure.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnsupportedMedia) {
+		writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, err.Error())
+}
+
+// decodeCommand reads an optional Command body from r.
+func decodeCommand(r *http.Request) (Command, error) {
+	var c Command
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, maxCommandBody, &c); err != nil {
+			return c, err
+		}
+		if err := c.validate(); err != nil {
+			return c, err
+		}
+	}
+	if c.Actor == "" {
+		c.Actor = ClientName(r)
+	}
+	return c, nil
+}
+
+// parseCommand decodes a Command pushed by the alarm stream with the same
+// limits decodeCommand applies to one posted to the API.
+func parseCommand(data []byte) (Command, error) {
+	var c Command
+	if len(data) == 0 {
+		return c, nil
+	}
+	if len(data) > maxCommandBody {
+		return c, fmt.Errorf("command: longer than %d bytes", maxCommandBody)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return c, fmt.Errorf("invalid JSON body: %w", err)
+	}
+	if dec.More() {
+		return c, errors.New("invalid JSON body: trailing data")
+	}
+	return c, c.validate()
+}
+
+// validate bounds the free-text fields of c, which end up in Telegram
+// messages and the history.
+func (c Command) validate() error {
+	for _, f := range []struct {
+		name, val string
+		max       int
+	}{{"source", c.Source, 64}, {"reason", c.Reason, 256}, {"actor", c.Actor, 64}} {
+		if len(f.val) > f.max {
+			return fmt.Errorf("%s: longer than %d bytes", f.name, f.max)
+		}
+		if strings.IndexFunc(f.val, unicode.IsControl) >= 0 {
+			return fmt.Errorf("%s: contains control characters", f.name)
+		}
+	}
+	return nil
+}
+
+// command wraps a state-changing route: it decodes the Command body, answers
+// 415/400 on bad input, and otherwise runs h and replies 200.
+func (s *Server) command(h func(Command)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := decodeCommand(r)
+		if err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+		h(c)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// suffix renders the optional provenance of c for a broadcast message.
+func (c Command) suffix() string {
+	var parts []string
+	if c.Actor != "" {
+		parts = append(parts, "by "+c.Actor)
+	}
+	if c.Source != "" {
+		parts = append(parts, "from "+c.Source)
+	}
+	out := strings.Join(parts, " ")
+	if c.Reason != "" {
+		out += " — " + c.Reason
+	}
+	if out != "" {
+		out = " " + strings.TrimSpace(out)
+	}
+	return out
+}
+
+// fields flattens c for the state history.
+func (c Command) fields() map[string]string {
+	f := map[string]string{}
+	for k, v := range map[string]string{"source": c.Source, "reason": c.Reason, "actor": c.Actor} {
+		if v != "" {
+			f[k] = v
+		}
+	}
+	return f
+}
@@ -0,0 +1,71 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"home-alarm-bot/internal/state"
+)
+
+func TestRoutes_MethodAndPayloadValidation(t *testing.T) {
+	base, st := startTestServer(t)
+
+	check := func(res *http.Response, err error, want int) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != want {
+			t.Fatalf("%s %s = %d, want %d", res.Request.Method, res.Request.URL.Path, res.StatusCode, want)
+		}
+		if want >= 400 {
+			var body errorBody
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil || body.Error == "" {
+				t.Fatalf("error body not JSON: %v", err)
+			}
+		}
+	}
+
+	// A GET (e.g. a browser prefetch) must not disarm.
+	st.Set(state.Armed)
+	res, err := http.Get(base + "/disarm")
+	check(res, err, http.StatusMethodNotAllowed)
+	if res.Header.Get("Allow") != "POST" || st.Get() != state.Armed {
+		t.Fatalf("GET /disarm: Allow=%q state=%s", res.Header.Get("Allow"), st.Get())
+	}
+
+	res, err = http.Post(base+"/status", "application/json", nil)
+	check(res, err, http.StatusMethodNotAllowed)
+
+	res, err = http.Post(base+"/disarm", "text/plain", strings.NewReader("please"))
+	check(res, err, http.StatusUnsupportedMediaType)
+
+	res, err = http.Post(base+"/disarm", "application/json", strings.NewReader(`{"who":"me"}`))
+	check(res, err, http.StatusBadRequest)
+
+	res, err = http.Post(base+"/disarm", "application/json", strings.NewReader(`{"actor":"alice","source":"keypad","reason":"home"}`))
+	check(res, err, http.StatusOK)
+	if st.Get() != state.Disarmed {
+		t.Fatalf("valid /disarm did not disarm")
+	}
+	h := st.History(1)
+	if h[0].Fields["actor"] != "alice" || h[0].Fields["source"] != "keypad" {
+		t.Fatalf("command not recorded: %+v", h[0])
+	}
+
+	res, err = http.Get(base + "/nope")
+	check(res, err, http.StatusNotFound)
+}
+
+func TestCommandSuffix(t *testing.T) {
+	c := Command{Source: "keypad", Reason: "home", Actor: "alice"}
+	if got := c.suffix(); got != " by alice from keypad — home" {
+		t.Fatalf("suffix = %q", got)
+	}
+	if got := (Command{}).suffix(); got != "" {
+		t.Fatalf("empty suffix = %q", got)
+	}
+}
@@ -0,0 +1,159 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"home-alarm-bot/internal/state"
+)
+
+// heartbeatEvery is how often an idle stream gets a keep-alive comment;
+// a variable so tests can shorten it.
+var heartbeatEvery = 15 * time.Second
+
+// streamBuffer is how many events a slow stream client may lag behind
+// before it is disconnected; it resumes with Last-Event-ID.
+const streamBuffer = 64
+
+// hub fans recorded events out to the open streams.
+type hub struct {
+	mu   sync.Mutex
+	subs map[chan state.Event]struct{}
+}
+
+func newHub(store *state.Store) *hub {
+	h := &hub{subs: make(map[chan state.Event]struct{})}
+	store.OnRecord(h.publish)
+	return h
+}
+
+func (h *hub) subscribe() chan state.Event {
+	ch := make(chan state.Event, streamBuffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *hub) unsubscribe(ch chan state.Event) {
+	h.mu.Lock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+	h.mu.Unlock()
+}
+
+// close ends every open stream; clients reconnect to wherever the server
+// comes back.
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+func (h *hub) publish(ev state.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default: // too slow: drop it, the client reconnects and replays
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// handleStream serves GET /events/stream as Server-Sent Events. Every
+// connection starts with
+//
+//	event: snapshot
+//	data: {"state":"ARMED"}
+//
+// followed by history events as they are recorded, each as
+//
+//	id: 42
+//	event: <kind>          state, incident, sensor, alarm, video, …
+//	data: <state.Event as JSON>
+//
+// A Last-Event-ID header (or ?last_event_id=) first replays the events after
+// that ID still in the history. IDs restart when the bot does, so an ID
+// beyond the newest event replays the whole history instead. Idle streams
+// get a ": ping" comment every heartbeatEvery.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	after, _ := strconv.ParseInt(lastID, 10, 64)
+
+	// Subscribe before reading the history so nothing falls in between.
+	live := s.events.subscribe()
+	defer s.events.unsubscribe(live)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	snap, _ := json.Marshal(struct {
+		State state.AlarmState `json:"state"`
+	}{s.store.Get()})
+	fmt.Fprintf(w, "retry: 5000\nevent: snapshot\ndata: %s\n\n", snap)
+
+	if after > 0 {
+		history := s.store.History(0)
+		if n := len(history); n == 0 || after > history[n-1].ID {
+			after = 0 // the client saw a previous run; all of this one is new
+		}
+		for _, ev := range history {
+			if ev.ID > after {
+				writeEvent(w, ev)
+				after = ev.ID
+			}
+		}
+	}
+	flusher.Flush()
+
+	ping := time.NewTicker(heartbeatEvery)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-live:
+			if !ok {
+				return
+			}
+			if ev.ID <= after {
+				continue // already replayed; the store delivers in ID order
+			}
+			writeEvent(w, ev)
+			after = ev.ID
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev state.Event) {
+	data, _ := json.Marshal(ev)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Kind, data)
+}
@@ -0,0 +1,177 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"home-alarm-bot/internal/state"
+)
+
+// readSSE collects the next n events (id, event, data) from a stream,
+// skipping comments.
+func readSSE(t *testing.T, r *bufio.Reader, n int) []map[string]string {
+	t.Helper()
+	var out []map[string]string
+	cur := map[string]string{}
+	for len(out) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v (got %v)", err, out)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if len(cur) > 0 {
+				out = append(out, cur)
+				cur = map[string]string{}
+			}
+		case strings.HasPrefix(line, ":"):
+			cur["comment"] = line
+		default:
+			k, v, _ := strings.Cut(line, ": ")
+			cur[k] = v
+		}
+	}
+	return out
+}
+
+func TestEventStream(t *testing.T) {
+	base, st := startTestServer(t)
+	first := st.Record(state.Event{Kind: "incident", Text: "door opened"})
+	st.Record(state.Event{Kind: "sensor", Text: "motion"})
+
+	req, _ := http.NewRequest(http.MethodGet, base+"/events/stream", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	if first.ID != 1 {
+		t.Fatalf("first ID = %d", first.ID)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("/events/stream: %v", err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	r := bufio.NewReader(res.Body)
+
+	evs := readSSE(t, r, 2)
+	if evs[0]["event"] != "snapshot" || !strings.Contains(evs[0]["data"], `"DISARMED"`) {
+		t.Fatalf("snapshot = %v", evs[0])
+	}
+	if evs[1]["id"] != "2" || evs[1]["event"] != "sensor" || !strings.Contains(evs[1]["data"], "motion") {
+		t.Fatalf("replayed = %v", evs[1])
+	}
+
+	st.Set(state.Armed)
+	st.Record(state.Event{Kind: "state", Text: "armed"})
+	evs = readSSE(t, r, 1)
+	if evs[0]["id"] != "3" || evs[0]["event"] != "state" {
+		t.Fatalf("live = %v", evs[0])
+	}
+}
+
+// A client that last saw ID 500 before the bot restarted must still get
+// this run's events, which start again at 1.
+func TestEventStreamAfterRestart(t *testing.T) {
+	base, st := startTestServer(t)
+	st.Record(state.Event{Kind: "incident", Text: "door opened"})
+
+	req, _ := http.NewRequest(http.MethodGet, base+"/events/stream", nil)
+	req.Header.Set("Last-Event-ID", "500")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("/events/stream: %v", err)
+	}
+	defer res.Body.Close()
+	r := bufio.NewReader(res.Body)
+
+	evs := readSSE(t, r, 2)
+	if evs[1]["id"] != "1" || evs[1]["event"] != "incident" {
+		t.Fatalf("replayed = %v", evs[1])
+	}
+	st.Record(state.Event{Kind: "sensor", Text: "motion"})
+	if ev := readSSE(t, r, 1)[0]; ev["id"] != "2" {
+		t.Fatalf("live = %v", ev)
+	}
+}
+
+// Events recorded from many goroutines at once all reach the stream, in ID
+// order.
+func TestEventStreamConcurrentRecords(t *testing.T) {
+	base, st := startTestServer(t)
+	res, err := http.Get(base + "/events/stream")
+	if err != nil {
+		t.Fatalf("/events/stream: %v", err)
+	}
+	defer res.Body.Close()
+	r := bufio.NewReader(res.Body)
+	readSSE(t, r, 1) // snapshot
+	time.AfterFunc(2*time.Second, func() { res.Body.Close() }) // fail, not hang, on a lost event
+
+	const n = 32
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st.Record(state.Event{Kind: "sensor"})
+		}()
+	}
+	wg.Wait()
+	for i, ev := range readSSE(t, r, n) {
+		if ev["id"] != strconv.Itoa(i+1) {
+			t.Fatalf("event %d has id %s", i+1, ev["id"])
+		}
+	}
+}
+
+func TestEventStreamHeartbeat(t *testing.T) {
+	old := heartbeatEvery
+	heartbeatEvery = 20 * time.Millisecond
+	defer func() { heartbeatEvery = old }()
+
+	base, _ := startTestServer(t)
+	res, err := http.Get(base + "/events/stream")
+	if err != nil {
+		t.Fatalf("/events/stream: %v", err)
+	}
+	defer res.Body.Close()
+	r := bufio.NewReader(res.Body)
+	readSSE(t, r, 1) // snapshot
+	if ev := readSSE(t, r, 1)[0]; ev["comment"] != ": ping" {
+		t.Fatalf("heartbeat = %v", ev)
+	}
+}
+
+func TestShutdownEndsStreams(t *testing.T) {
+	var srv *Server
+	base, _ := startConfiguredServer(t, openConfig(), func(s *Server) { srv = s })
+
+	res, err := http.Get(base + "/events/stream")
+	if err != nil {
+		t.Fatalf("/events/stream: %v", err)
+	}
+	defer res.Body.Close()
+	r := bufio.NewReader(res.Body)
+	readSSE(t, r, 1) // snapshot
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("stream did not end cleanly: %v", err)
+	}
+	if _, err := http.Get(base + "/status"); err == nil {
+		t.Fatal("server still accepting requests after Shutdown")
+	}
+}
@@ -0,0 +1,64 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+
+	"home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/sensors"
+	"home-alarm-bot/internal/state"
+)
+
+// Ingest applies one event pushed by the alarm panel (see
+// alarm.Panel.Subscribe) exactly as if it had been posted to the local API:
+//
+//	armed, disarmed, alarm, success  data is an optional Command
+//	sensor                           data is a sensors.Event, as for /events
+//
+// Commands are held to the same limits as over HTTP. Unknown types and
+// malformed or invalid payloads are logged and dropped, and so are armed and
+// disarmed events that would not change the state.
+func (s *Server) Ingest(ev alarm.Event) {
+	if ev.Type == "sensor" {
+		var se sensors.Event
+		if err := json.Unmarshal(ev.Data, &se); err != nil {
+			log.Printf("alarm stream: event %s: %v", ev.ID, err)
+			return
+		}
+		if err := se.Validate(); err != nil {
+			log.Printf("alarm stream: event %s: %v", ev.ID, err)
+			return
+		}
+		if _, err := s.route.Route(se); err != nil {
+			log.Printf("alarm stream: event %s: %v", ev.ID, err)
+		}
+		return
+	}
+
+	c, err := parseCommand(ev.Data)
+	if err != nil {
+		log.Printf("alarm stream: event %s: %v", ev.ID, err)
+		return
+	}
+	if c.Source == "" {
+		c.Source = "alarm server"
+	}
+	switch ev.Type {
+	// The panel echoes changes made through the bot, which has already
+	// recorded and announced them.
+	case "armed":
+		if s.store.Get() != state.Armed {
+			s.armed(c, "alarm server")
+		}
+	case "disarmed":
+		if s.store.Get() != state.Disarmed {
+			s.disarmed(c, "alarm server")
+		}
+	case "alarm":
+		s.alarmed(c)
+	case "success":
+		s.pinDisarmed(c)
+	default:
+		log.Printf("alarm stream: ignoring %q event %s", ev.Type, ev.ID)
+	}
+}
@@ -0,0 +1,39 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/state"
+)
+
+func TestIngestAlarmStream(t *testing.T) {
+	var srv *Server
+	_, st := startConfiguredServer(t, openConfig(), func(s *Server) { srv = s })
+
+	srv.Ingest(alarm.Event{ID: "1", Type: "armed", Data: json.RawMessage(`{"actor":"keypad"}`)})
+	if st.Get() != state.Armed {
+		t.Fatalf("state after armed event = %s", st.Get())
+	}
+	srv.Ingest(alarm.Event{ID: "2", Type: "sensor", Data: json.RawMessage(`{"type":"glass_break","sensor_id":"k1"}`)})
+	srv.Ingest(alarm.Event{ID: "3", Type: "sensor", Data: json.RawMessage(`{"type":"earthquake"}`)})
+	srv.Ingest(alarm.Event{ID: "4", Type: "reboot"})
+	srv.Ingest(alarm.Event{ID: "4b", Type: "disarmed", Data: json.RawMessage(`{"actor":"x\u0007"}`)})
+	srv.Ingest(alarm.Event{ID: "4c", Type: "disarmed", Data: json.RawMessage(`{"actor":"x","pin":"1234"}`)})
+	if st.Get() != state.Armed {
+		t.Fatalf("invalid command applied: state %s", st.Get())
+	}
+	srv.Ingest(alarm.Event{ID: "5", Type: "disarmed"})
+	if st.Get() != state.Disarmed {
+		t.Fatalf("state after disarmed event = %s", st.Get())
+	}
+	// the panel echoing a change already made is not recorded again
+	srv.Ingest(alarm.Event{ID: "6", Type: "disarmed"})
+
+	h := st.History(0)
+	if len(h) != 3 || h[0].Fields["actor"] != "keypad" || h[0].Fields["source"] != "alarm server" ||
+		h[1].Kind != "incident" || h[2].Text != string(state.Disarmed) {
+		t.Fatalf("history = %+v", h)
+	}
+}
@@ -0,0 +1,94 @@
+package httpapi
+
+import (
+	"sync"
+	"time"
+)
+
+// Web UI logins are throttled per remote address and per user name. Each
+// failure past the first few locks the address and the name out for twice
+// as long as the last one did; a successful login clears both.
+const (
+	loginFree    = 3                // failures allowed before any lockout
+	loginBackoff = time.Second      // first lockout
+	loginMaxLock = 15 * time.Minute // longest lockout
+	loginForget  = time.Hour        // failures this old are forgotten
+)
+
+type loginLimiter struct {
+	now func() time.Time // a field so tests can move the clock
+
+	mu   sync.Mutex
+	keys map[string]*loginFailures // "ip " + host or "user " + name
+}
+
+type loginFailures struct {
+	count int
+	last  time.Time
+	until time.Time // no attempts before this
+
+	// For addresses: when a failure was last recorded in the history and
+	// how many have happened since; the rest are only logged.
+	recorded   time.Time
+	unrecorded int
+}
+
+func newLoginLimiter() *loginLimiter {
+	return &loginLimiter{now: time.Now, keys: make(map[string]*loginFailures)}
+}
+
+// wait returns how long host and user are still locked out, or 0.
+func (l *loginLimiter) wait(host, user string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var d time.Duration
+	for _, k := range []string{"ip " + host, "user " + user} {
+		if f, ok := l.keys[k]; ok {
+			d = max(d, f.until.Sub(now))
+		}
+	}
+	return d
+}
+
+// fail counts a failed login. It reports whether the failure should be
+// recorded in the history, which happens at most once per reportEvery per
+// address, and how many failures from host that record stands for.
+func (l *loginLimiter) fail(host, user string) (record bool, failures int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for k, f := range l.keys {
+		if now.Sub(f.last) > loginForget {
+			delete(l.keys, k)
+		}
+	}
+	for _, k := range []string{"ip " + host, "user " + user} {
+		f, ok := l.keys[k]
+		if !ok {
+			f = &loginFailures{}
+			l.keys[k] = f
+		}
+		f.count++
+		f.last = now
+		if n := f.count - loginFree; n > 0 {
+			f.until = now.Add(min(loginBackoff<<min(n-1, 20), loginMaxLock))
+		}
+	}
+
+	f := l.keys["ip "+host]
+	f.unrecorded++
+	if !f.recorded.IsZero() && now.Sub(f.recorded) < reportEvery {
+		return false, 0
+	}
+	failures, f.recorded, f.unrecorded = f.unrecorded, now, 0
+	return true, failures
+}
+
+// succeed forgets the failures of host and user.
+func (l *loginLimiter) succeed(host, user string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.keys, "ip "+host)
+	delete(l.keys, "user "+user)
+}
@@ -0,0 +1,76 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := newLoginLimiter()
+	l.now = func() time.Time { return now }
+
+	for i := 1; i <= loginFree; i++ {
+		record, n := l.fail("10.0.0.1", "alice")
+		if record != (i == 1) || (record && n != 1) {
+			t.Fatalf("failure %d: record %v, %d", i, record, n)
+		}
+	}
+	if d := l.wait("10.0.0.1", "bob"); d != 0 {
+		t.Fatalf("locked out after %d failures: %s", loginFree, d)
+	}
+	l.fail("10.0.0.1", "alice")
+	if d := l.wait("10.0.0.1", "bob"); d != loginBackoff {
+		t.Fatalf("address wait = %s, want %s", d, loginBackoff)
+	}
+	l.fail("10.0.0.1", "alice")
+	if d := l.wait("10.0.0.2", "alice"); d != 2*loginBackoff {
+		t.Fatalf("user wait from another address = %s, want %s", d, 2*loginBackoff)
+	}
+
+	// The next recorded failure carries those in between.
+	now = now.Add(reportEvery)
+	if record, n := l.fail("10.0.0.1", "alice"); !record || n != loginFree+2 {
+		t.Fatalf("after reportEvery: record %v, %d", record, n)
+	}
+
+	now = now.Add(time.Hour)
+	l.succeed("10.0.0.1", "alice")
+	if d := l.wait("10.0.0.1", "alice"); d != 0 {
+		t.Fatalf("still locked out after a successful login: %s", d)
+	}
+}
+
+func TestWebUILoginLockout(t *testing.T) {
+	cfg := openConfig()
+	cfg.UIUsers = []UIUser{{Name: "alice", Password: "s3cret"}}
+	base, st := startConfiguredServer(t, cfg)
+	jar, _ := cookiejar.New(nil)
+	c := &http.Client{Jar: jar}
+
+	login := func(password string) *http.Response {
+		t.Helper()
+		_, csrf := getPage(t, c, base+"/ui/login")
+		res, err := c.PostForm(base+"/ui/login", url.Values{"csrf": {csrf}, "user": {"alice"}, "password": {password}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+	for range loginFree + 1 {
+		if res := login("guess"); res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("wrong password = %d", res.StatusCode)
+		}
+	}
+	res := login("s3cret")
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") == "" {
+		t.Fatalf("login while locked out = %d, Retry-After %q", res.StatusCode, res.Header.Get("Retry-After"))
+	}
+	if h := st.History(0); len(h) != 1 || h[0].Kind != "auth" || h[0].Fields["failures"] != "1" {
+		t.Fatalf("failures not coalesced: %+v", h)
+	}
+}
@@ -0,0 +1,384 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/archive"
+	"home-alarm-bot/internal/sensors"
+	"home-alarm-bot/internal/state"
+)
+
+// UIUser may log in to the web UI under /ui/.
+type UIUser struct {
+	Name     string
+	Password string
+}
+
+// ParseUIUsers reads a comma-separated list of name:password entries, e.g.
+// "alice:correct-horse,bob:hunter2".
+func ParseUIUsers(spec string) ([]UIUser, error) {
+	var out []UIUser
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, pw, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || pw == "" {
+			return nil, fmt.Errorf("ui user %q: want name:password", entry)
+		}
+		out = append(out, UIUser{Name: name, Password: pw})
+	}
+	return out, nil
+}
+
+//go:embed ui
+var uiFiles embed.FS
+
+var uiTemplates = htmltemplate.Must(htmltemplate.New("").Funcs(htmltemplate.FuncMap{
+	"when": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Local().Format("Jan 2 15:04:05")
+	},
+	"size": func(n int64) string { return fmt.Sprintf("%.1f MB", float64(n)/(1<<20)) },
+}).ParseFS(uiFiles, "ui/*.html"))
+
+const (
+	sessionCookie = "session"
+	loginCookie   = "login_csrf"
+	// uiRecent is how many history events and clips the dashboard shows.
+	uiRecent = 20
+)
+
+// session is one logged-in browser. Every form it posts must carry csrf.
+type session struct {
+	user    string
+	csrf    string
+	expires time.Time
+}
+
+// sessions keeps the web UI logins in memory; a restart logs everyone out.
+type sessions struct {
+	ttl time.Duration
+
+	mu sync.Mutex
+	m  map[string]session
+}
+
+func newSessions(ttl time.Duration) *sessions {
+	return &sessions{ttl: ttl, m: make(map[string]session)}
+}
+
+func (ss *sessions) create(user string) (id string, sess session) {
+	id = randomToken()
+	sess = session{user: user, csrf: randomToken(), expires: time.Now().Add(ss.ttl)}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	now := time.Now()
+	for k, v := range ss.m {
+		if now.After(v.expires) {
+			delete(ss.m, k)
+		}
+	}
+	ss.m[id] = sess
+	return id, sess
+}
+
+func (ss *sessions) get(id string) (session, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	sess, ok := ss.m[id]
+	if !ok || time.Now().After(sess.expires) {
+		delete(ss.m, id)
+		return session{}, false
+	}
+	return sess, true
+}
+
+func (ss *sessions) drop(id string) {
+	ss.mu.Lock()
+	delete(ss.m, id)
+	ss.mu.Unlock()
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// sameToken compares two secrets in constant time.
+func sameToken(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// checkPassword reports whether name/password match a configured UI user.
+// Both sides are hashed first so the comparison does not leak lengths.
+func (s *Server) checkPassword(name, password string) bool {
+	cfg, _ := s.config()
+	got := sha256.Sum256([]byte(password))
+	ok := false
+	for _, u := range cfg.UIUsers {
+		want := sha256.Sum256([]byte(u.Password))
+		if subtle.ConstantTimeCompare(got[:], want[:]) == 1 && u.Name == name {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// uiHandler serves the web UI: a dashboard at /ui/ with the current state,
+// recent history, clips, sensors and subscribed chats, and arm/disarm
+// buttons. It has its own password login instead of the API clients; every
+// form carries a CSRF token bound to the login session. Without UIUsers the
+// UI is off.
+func (s *Server) uiHandler() http.Handler {
+	mux := http.NewServeMux()
+	static, _ := fs.Sub(uiFiles, "ui")
+	mux.Handle("/ui/static/", http.StripPrefix("/ui", http.FileServerFS(static)))
+	mux.HandleFunc("/ui/login", allow(s.handleLogin, http.MethodGet, http.MethodHead, http.MethodPost))
+	mux.HandleFunc("/ui/logout", allow(s.loggedIn(s.handleLogout), http.MethodPost))
+	mux.HandleFunc("/ui/arm", allow(s.loggedIn(s.handleUIArm), http.MethodPost))
+	mux.HandleFunc("/ui/disarm", allow(s.loggedIn(s.handleUIDisarm), http.MethodPost))
+	mux.HandleFunc("/ui/clips/", allow(s.loggedIn(func(w http.ResponseWriter, r *http.Request) {
+		s.serveClip(w, r, strings.TrimPrefix(r.URL.Path, "/ui/clips/"), "")
+	}), http.MethodGet, http.MethodHead))
+	mux.HandleFunc("/ui/{$}", allow(s.loggedIn(s.handleDashboard), http.MethodGet, http.MethodHead))
+	mux.HandleFunc("/ui/", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg, _ := s.config(); len(cfg.UIUsers) == 0 {
+			writeError(w, http.StatusNotFound, "web UI disabled")
+			return
+		}
+		h := w.Header()
+		h.Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "same-origin")
+		h.Set("Cache-Control", "no-store")
+		mux.ServeHTTP(w, r)
+	})
+}
+
+type sessionKey struct{}
+
+// loggedIn runs h for requests with a valid session and sends everyone else
+// to the login page. POSTs must also carry the session's CSRF token.
+func (s *Server) loggedIn(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(sessionCookie)
+		if err != nil {
+			http.Redirect(w, r, "/ui/login", http.StatusSeeOther)
+			return
+		}
+		sess, ok := s.ui.get(c.Value)
+		if !ok {
+			http.Redirect(w, r, "/ui/login", http.StatusSeeOther)
+			return
+		}
+		if r.Method == http.MethodPost && !sameToken(sess.csrf, r.PostFormValue("csrf")) {
+			http.Error(w, "invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), sessionKey{}, sess)
+		h(w, r.WithContext(context.WithValue(ctx, clientKey{}, sess.user)))
+	}
+}
+
+func currentSession(r *http.Request) session {
+	sess, _ := r.Context().Value(sessionKey{}).(session)
+	return sess
+}
+
+func (s *Server) setCookie(w http.ResponseWriter, r *http.Request, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/ui/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// handleLogin shows the login form and checks submitted credentials. The
+// form is protected by a double-submit token in a short-lived cookie, and
+// repeated failures lock the address and the user name out for a while.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var failed, locked bool
+	code := http.StatusOK
+	if r.Method == http.MethodPost {
+		c, err := r.Cookie(loginCookie)
+		if err != nil || !sameToken(c.Value, r.PostFormValue("csrf")) {
+			http.Error(w, "invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		name, host := r.PostFormValue("user"), remoteHost(r)
+		switch wait := s.logins.wait(host, name); {
+		case wait > 0:
+			locked, code = true, http.StatusTooManyRequests
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			log.Printf("httpapi: web UI login for %q from %s refused, locked out for %s", name, host, wait.Round(time.Second))
+		case s.checkPassword(name, r.PostFormValue("password")):
+			s.logins.succeed(host, name)
+			id, _ := s.ui.create(name)
+			cfg, _ := s.config()
+			s.setCookie(w, r, loginCookie, "", -1)
+			s.setCookie(w, r, sessionCookie, id, int(cfg.SessionTTL/time.Second))
+			http.Redirect(w, r, "/ui/", http.StatusSeeOther)
+			return
+		default:
+			failed, code = true, http.StatusUnauthorized
+			s.loginFailed(host, name)
+		}
+	}
+
+	token := randomToken()
+	s.setCookie(w, r, loginCookie, token, 3600)
+	s.render(w, code, "login.html", struct {
+		CSRF           string
+		Failed, Locked bool
+	}{token, failed, locked})
+}
+
+// loginFailed logs a rejected web UI login and counts it towards a lockout.
+// Only the first failure from host in every reportEvery is recorded in the
+// history, with the number of failures it stands for, so guessing cannot
+// flood the history and everything that follows it.
+func (s *Server) loginFailed(host, user string) {
+	log.Printf("httpapi: failed web UI login for %q from %s", user, host)
+	record, failures := s.logins.fail(host, user)
+	if !record {
+		return
+	}
+	s.store.Record(state.Event{Kind: "auth", Text: "failed web UI login",
+		Fields: map[string]string{"user": user, "remote": host, "failures": strconv.Itoa(failures)}})
+}
+
+// remoteHost is r's client address without the port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		s.ui.drop(c.Value)
+	}
+	s.setCookie(w, r, sessionCookie, "", -1)
+	http.Redirect(w, r, "/ui/login", http.StatusSeeOther)
+}
+
+// dashboard is what index.html renders.
+type dashboard struct {
+	User    string
+	CSRF    string
+	Flash   string
+	State   state.AlarmState
+	Modes   []alarm.ArmMode
+	Zones   []string
+	History []state.Event // newest first
+	Clips   []archive.Clip
+	Sensors []sensors.Sensor
+	Chats   []int64
+}
+
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	sess := currentSession(r)
+	d := dashboard{
+		User:    sess.user,
+		CSRF:    sess.csrf,
+		Flash:   r.URL.Query().Get("flash"),
+		State:   s.store.Get(),
+		Modes:   []alarm.ArmMode{alarm.ArmAway, alarm.ArmHome, alarm.ArmNight},
+		History: s.store.History(uiRecent),
+		Chats:   s.bot.Chats(),
+	}
+	slices.Reverse(d.History)
+	if s.clips != nil {
+		d.Clips = s.clips.Recent(uiRecent)
+	}
+	if s.reg != nil {
+		d.Sensors = s.reg.List()
+		d.Zones = s.reg.Zones()
+	}
+	s.render(w, http.StatusOK, "index.html", d)
+}
+
+// handleUIArm arms the panel in the posted mode, bypassing any checked zones.
+func (s *Server) handleUIArm(w http.ResponseWriter, r *http.Request) {
+	user := currentSession(r).user
+	mode, err := alarm.ParseArmMode(r.PostFormValue("mode"))
+	if err == nil {
+		ctx, cancel := context.WithTimeout(r.Context(), uiTimeout)
+		defer cancel()
+		err = s.bot.Arm(ctx, mode, r.PostForm["bypass"], "web UI", user)
+	}
+	if err != nil {
+		backToDashboard(w, r, "❌ "+err.Error())
+		return
+	}
+	msg := fmt.Sprintf("🔒 System Armed %s (via web UI) by %s", mode, user)
+	if zones := r.PostForm["bypass"]; len(zones) > 0 {
+		msg += " (bypassing " + strings.Join(zones, ", ") + ")"
+	}
+	s.bot.Broadcast(msg)
+	backToDashboard(w, r, "🔒 Armed "+string(mode))
+}
+
+func (s *Server) handleUIDisarm(w http.ResponseWriter, r *http.Request) {
+	user := currentSession(r).user
+	ctx, cancel := context.WithTimeout(r.Context(), uiTimeout)
+	defer cancel()
+	if err := s.bot.Disarm(ctx, "web UI", user); err != nil {
+		backToDashboard(w, r, "❌ "+err.Error())
+		return
+	}
+	s.bot.Broadcast("🔓 System Disarmed (via web UI) by " + user)
+	backToDashboard(w, r, "🔓 Disarmed")
+}
+
+// uiTimeout bounds the alarm server calls behind one button press.
+const uiTimeout = 15 * time.Second
+
+// backToDashboard redirects after a POST so reloading does not resubmit it.
+func backToDashboard(w http.ResponseWriter, r *http.Request, flash string) {
+	http.Redirect(w, r, "/ui/?flash="+url.QueryEscape(flash), http.StatusSeeOther)
+}
+
+func (s *Server) render(w http.ResponseWriter, code int, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := uiTemplates.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("httpapi: render %s: %v", name, err)
+	}
+}
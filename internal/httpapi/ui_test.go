@@ -0,0 +1,113 @@
+package httpapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"home-alarm-bot/internal/archive"
+	"home-alarm-bot/internal/state"
+)
+
+var csrfField = regexp.MustCompile(`name="csrf" value="([0-9a-f]+)"`)
+
+// getPage fetches path and returns the body and its CSRF token.
+func getPage(t *testing.T, c *http.Client, u string) (body, csrf string) {
+	t.Helper()
+	res, err := c.Get(u)
+	if err != nil {
+		t.Fatalf("GET %s: %v", u, err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	if m := csrfField.FindSubmatch(b); m != nil {
+		csrf = string(m[1])
+	}
+	return string(b), csrf
+}
+
+func TestWebUI(t *testing.T) {
+	cfg := openConfig()
+	cfg.UIUsers = []UIUser{{Name: "alice", Password: "s3cret"}}
+	a, _ := archive.Open(t.TempDir(), 0, 0)
+	clip, _ := a.Save(strings.NewReader("clip-bytes"), archive.Clip{Name: "yard.mp4"})
+	base, st := startConfiguredServer(t, cfg, func(s *Server) { s.SetArchive(a) })
+	jar, _ := cookiejar.New(nil)
+	c := &http.Client{Jar: jar}
+
+	// Not logged in: clips and the dashboard redirect to the login form.
+	if body, _ := getPage(t, c, base+"/ui/clips/"+clip.ID); body == "clip-bytes" {
+		t.Fatal("clip served without a login")
+	}
+	body, csrf := getPage(t, c, base+"/ui/")
+	if !strings.Contains(body, `action="/ui/login"`) || csrf == "" {
+		t.Fatalf("expected login form, got %s", body)
+	}
+
+	if res, err := c.Get(base + "/ui/static/style.css"); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("style.css: %v %v", res, err)
+	}
+
+	// A login without the form's token is refused.
+	res, _ := c.PostForm(base+"/ui/login", url.Values{"user": {"alice"}, "password": {"s3cret"}})
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("login without csrf = %d", res.StatusCode)
+	}
+
+	res, _ = c.PostForm(base+"/ui/login", url.Values{"csrf": {csrf}, "user": {"alice"}, "password": {"wrong"}})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("bad password = %d", res.StatusCode)
+	}
+	if h := st.History(1); len(h) != 1 || h[0].Kind != "auth" {
+		t.Fatalf("failed login not recorded: %+v", h)
+	}
+
+	_, csrf = getPage(t, c, base+"/ui/login")
+	res, _ = c.PostForm(base+"/ui/login", url.Values{"csrf": {csrf}, "user": {"alice"}, "password": {"s3cret"}})
+	res.Body.Close()
+	body, csrf = getPage(t, c, base+"/ui/")
+	if !strings.Contains(body, "State: 🔓 Disarmed") || !strings.Contains(body, "alice") {
+		t.Fatalf("dashboard = %s", body)
+	}
+	if !strings.Contains(body, `href="/ui/clips/`+clip.ID+`"`) {
+		t.Fatalf("dashboard does not link the clip: %s", body)
+	}
+	if got, _ := getPage(t, c, base+"/ui/clips/"+clip.ID); got != "clip-bytes" {
+		t.Fatalf("clip via UI = %q", got)
+	}
+
+	// Buttons need the session's token.
+	res, _ = c.PostForm(base+"/ui/arm", url.Values{"mode": {"home"}})
+	if res.StatusCode != http.StatusForbidden || st.Get() != state.Disarmed {
+		t.Fatalf("arm without csrf = %d, state %s", res.StatusCode, st.Get())
+	}
+	res, _ = c.PostForm(base+"/ui/arm", url.Values{"csrf": {csrf}, "mode": {"home"}})
+	b, _ := io.ReadAll(res.Body)
+	if st.Get() != state.Armed || !strings.Contains(string(b), "Armed home") {
+		t.Fatalf("arm: state %s, page %s", st.Get(), b)
+	}
+	if h := st.History(1); h[0].Fields["source"] != "web UI" || h[0].Fields["actor"] != "alice" {
+		t.Fatalf("arm recorded as %+v", h[0])
+	}
+
+	res, _ = c.PostForm(base+"/ui/logout", url.Values{"csrf": {csrf}})
+	res.Body.Close()
+	if body, _ := getPage(t, c, base+"/ui/"); !strings.Contains(body, `action="/ui/login"`) {
+		t.Fatalf("still logged in after logout: %s", body)
+	}
+}
+
+func TestWebUIDisabled(t *testing.T) {
+	base, _ := startTestServer(t)
+	res, err := http.Get(base + "/ui/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("/ui/ without users = %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,22 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"home-alarm-bot/internal/webhook"
+)
+
+// handleWebhooks lists the latest webhook delivery attempts as JSON, newest
+// first. ?limit=N caps the list (default 50).
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	if s.hooks == nil {
+		writeJSON(w, []webhook.Delivery{})
+		return
+	}
+	limit := 50
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	writeJSON(w, s.hooks.Deliveries(limit))
+}
@@ -0,0 +1,36 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"home-alarm-bot/internal/webhook"
+)
+
+func TestWebhooksDeliveryLog(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hook.Close()
+
+	var d *webhook.Dispatcher
+	base, _ := startConfiguredServer(t, openConfig(), func(s *Server) {
+		d = webhook.New(s.store, []webhook.Endpoint{{URL: hook.URL}})
+		s.SetWebhooks(d)
+	})
+	http.Post(base+"/alarm", "application/json", nil)
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.Get(base + "/webhooks")
+	if err != nil {
+		t.Fatalf("/webhooks: %v", err)
+	}
+	var log []webhook.Delivery
+	json.NewDecoder(res.Body).Decode(&log)
+	if len(log) != 1 || !log[0].OK || log[0].Kind != "alarm" {
+		t.Fatalf("/webhooks = %+v", log)
+	}
+}
@@ -0,0 +1,116 @@
+// Package lifecycle runs the bot's background work and takes it down in a
+// fixed order when the process is asked to stop, e.g. on SIGTERM.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Manager owns a context that ends when shutdown begins, the goroutines
+// started under it and the steps that stop everything else.
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	reason error
+	steps  []step
+}
+
+type step struct {
+	name string
+	stop func(context.Context) error
+}
+
+// New returns a Manager whose context ends with parent or on Stop. Pass a
+// context from signal.NotifyContext to shut down on signals.
+func New(parent context.Context) *Manager {
+	ctx, cancel := context.WithCancel(parent)
+	return &Manager{ctx: ctx, cancel: cancel}
+}
+
+// Context is done once shutdown has begun.
+func (m *Manager) Context() context.Context { return m.ctx }
+
+// Go runs f in a goroutine. f must return soon after ctx is done; Shutdown
+// waits for it before running the stop steps.
+func (m *Manager) Go(f func(ctx context.Context)) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		f(m.ctx)
+	}()
+}
+
+// OnStop adds a step to Shutdown. Steps run one after another, in the order
+// they were added.
+func (m *Manager) OnStop(name string, stop func(ctx context.Context) error) {
+	m.mu.Lock()
+	m.steps = append(m.steps, step{name, stop})
+	m.mu.Unlock()
+}
+
+// Stop begins shutdown because of err, e.g. a listener that failed. The
+// first non-nil err is kept as the reason; see Err.
+func (m *Manager) Stop(err error) {
+	m.mu.Lock()
+	if m.reason == nil {
+		m.reason = err
+	}
+	m.mu.Unlock()
+	m.cancel()
+}
+
+// Err returns why Stop was called, or nil for a requested shutdown.
+func (m *Manager) Err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reason
+}
+
+// Shutdown ends the context, waits for the goroutines started with Go and
+// runs the stop steps, all within timeout. A step still running at the
+// deadline is abandoned; the rest are still started, with the expired
+// context, but not waited for. Every failure is logged and returned, joined.
+func (m *Manager) Shutdown(timeout time.Duration) error {
+	m.cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	if err := run(ctx, func(context.Context) error { m.wg.Wait(); return nil }); err != nil {
+		errs = append(errs, fmt.Errorf("background tasks: %w", err))
+	}
+
+	m.mu.Lock()
+	steps := m.steps
+	m.mu.Unlock()
+	for _, s := range steps {
+		start := time.Now()
+		if err := run(ctx, s.stop); err != nil {
+			log.Printf("shutdown: %s: %v", s.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+			continue
+		}
+		log.Printf("shutdown: %s done in %s", s.name, time.Since(start).Round(time.Millisecond))
+	}
+	return errors.Join(errs...)
+}
+
+// run calls f and gives up on it when ctx ends.
+func run(ctx context.Context, f func(context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- f(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
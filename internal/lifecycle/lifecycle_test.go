@@ -0,0 +1,78 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	m := New(context.Background())
+
+	var log []string
+	m.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		log = append(log, "loop")
+	})
+	m.OnStop("http", func(context.Context) error { log = append(log, "http"); return nil })
+	m.OnStop("queues", func(context.Context) error { log = append(log, "queues"); return nil })
+	m.OnStop("notice", func(context.Context) error { log = append(log, "notice"); return nil })
+
+	if err := m.Shutdown(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(log, ","); got != "loop,http,queues,notice" {
+		t.Fatalf("order = %s", got)
+	}
+	if m.Context().Err() == nil {
+		t.Fatal("context still live after Shutdown")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	m := New(context.Background())
+	block := make(chan struct{})
+	defer close(block)
+
+	called := make(chan struct{})
+	m.OnStop("failing", func(context.Context) error { return errors.New("boom") })
+	m.OnStop("stuck", func(context.Context) error { <-block; return nil })
+	m.OnStop("after", func(ctx context.Context) error { close(called); return ctx.Err() })
+
+	start := time.Now()
+	err := m.Shutdown(50 * time.Millisecond)
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Shutdown took %s", d)
+	}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("steps after a stuck one were skipped")
+	}
+	for _, want := range []string{"failing: boom", "stuck: context deadline exceeded", "after: context deadline exceeded"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v lacks %q", err, want)
+		}
+	}
+}
+
+func TestStopReason(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	m := New(parent)
+	cancel()
+	<-m.Context().Done()
+	if m.Err() != nil {
+		t.Fatalf("Err = %v after parent cancel", m.Err())
+	}
+
+	m = New(context.Background())
+	m.Stop(errors.New("listen: address in use"))
+	m.Stop(errors.New("later"))
+	<-m.Context().Done()
+	if m.Err() == nil || m.Err().Error() != "listen: address in use" {
+		t.Fatalf("Err = %v", m.Err())
+	}
+}
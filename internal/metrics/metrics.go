@@ -0,0 +1,326 @@
+// Package metrics keeps counters, gauges and histograms in memory and writes
+// them in the Prometheus text exposition format. Packages declare their
+// metrics as package variables on Default:
+//
+//	var sent = metrics.NewCounter("things_sent_total", "Things sent by result.", "result")
+//
+//	sent.Inc("ok")
+//
+// Label values are passed positionally and must match the declared labels.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry is a set of named metrics.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+// Default is the registry the New* functions add to and /metrics serves.
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+type family interface {
+	info() *meta
+	write(w io.Writer)
+}
+
+// meta is what every metric has in common.
+type meta struct {
+	name, help, kind string
+	labels           []string
+}
+
+func (d *meta) info() *meta { return d }
+
+// key joins label values into a series key, checking their count.
+func (d *meta) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// series formats name{labels} for the label values in key, plus extra
+// label pairs such as le="0.5".
+func (d *meta) series(name, key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+escape(v)+`"`)
+		}
+	}
+	pairs = append(pairs, extra...)
+	if len(pairs) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// register adds f, or returns the metric already registered under the same
+// name so a package can be initialised more than once in tests.
+func register[T family](r *Registry, f T) T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := f.info()
+	if old, ok := r.families[d.name]; ok {
+		if o, ok := old.(T); ok && slices.Equal(old.info().labels, d.labels) {
+			return o
+		}
+		panic("metrics: " + d.name + " registered twice with different types or labels")
+	}
+	r.families[d.name] = f
+	return f
+}
+
+// Counter is a monotonically increasing value per label combination.
+type Counter struct {
+	meta
+	mu   sync.Mutex
+	vals map[string]float64
+}
+
+// Counter returns the counter name with the given labels, creating it.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return register(r, &Counter{meta: meta{name, help, "counter", labels}, vals: make(map[string]float64)})
+}
+
+// NewCounter is Default.Counter.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.Counter(name, help, labels...)
+}
+
+// Inc adds one to the series for values.
+func (c *Counter) Inc(values ...string) { c.Add(1, values...) }
+
+// Add adds v, which must not be negative, to the series for values.
+func (c *Counter) Add(v float64, values ...string) {
+	k := c.key(values)
+	c.mu.Lock()
+	c.vals[k] += v
+	c.mu.Unlock()
+}
+
+// Value returns the current value of the series for values.
+func (c *Counter) Value(values ...string) float64 {
+	k := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.vals[k]
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range sortedKeys(c.vals) {
+		fmt.Fprintf(w, "%s %s\n", c.series(c.name, k), formatFloat(c.vals[k]))
+	}
+}
+
+// Gauge is a value per label combination that can go up and down, or one
+// computed when scraped.
+type Gauge struct {
+	meta
+	mu   sync.Mutex
+	vals map[string]float64
+	fn   func() float64
+}
+
+// Gauge returns the gauge name with the given labels, creating it.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return register(r, &Gauge{meta: meta{name, help, "gauge", labels}, vals: make(map[string]float64)})
+}
+
+// NewGauge is Default.Gauge.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.Gauge(name, help, labels...)
+}
+
+// NewGaugeFunc registers an unlabelled gauge on Default whose value is f()
+// at scrape time. Registering the name again replaces f.
+func NewGaugeFunc(name, help string, f func() float64) *Gauge {
+	g := NewGauge(name, help)
+	g.mu.Lock()
+	g.fn = f
+	g.mu.Unlock()
+	return g
+}
+
+// Set sets the series for values to v.
+func (g *Gauge) Set(v float64, values ...string) {
+	k := g.key(values)
+	g.mu.Lock()
+	g.vals[k] = v
+	g.mu.Unlock()
+}
+
+// SetTime sets the series for values to t as Unix seconds.
+func (g *Gauge) SetTime(t time.Time, values ...string) {
+	g.Set(float64(t.UnixNano())/1e9, values...)
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.fn != nil {
+		fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+		return
+	}
+	for _, k := range sortedKeys(g.vals) {
+		fmt.Fprintf(w, "%s %s\n", g.series(g.name, k), formatFloat(g.vals[k]))
+	}
+}
+
+// DefBuckets suit request latencies in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations into cumulative buckets per label
+// combination.
+type Histogram struct {
+	meta
+	buckets []float64
+	mu      sync.Mutex
+	vals    map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Histogram returns the histogram name with the given upper bucket bounds
+// (ascending) and labels, creating it.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return register(r, &Histogram{meta: meta{name, help, "histogram", labels},
+		buckets: buckets, vals: make(map[string]*histogramSeries)})
+}
+
+// NewHistogram is Default.Histogram.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.Histogram(name, help, buckets, labels...)
+}
+
+// Observe adds v to the series for values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	k := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.vals[k]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.vals[k] = s
+	}
+	i, _ := slices.BinarySearch(h.buckets, v)
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+// Since observes the seconds elapsed since start.
+func (h *Histogram) Since(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+// Count returns how many observations the series for values has.
+func (h *Histogram) Count(values ...string) uint64 {
+	k := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.vals[k]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, k := range sortedKeys(h.vals) {
+		s := h.vals[k]
+		var cum uint64
+		for i, n := range s.counts {
+			cum += n
+			le := math.Inf(+1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_bucket", k, `le="`+formatFloat(le)+`"`), cum)
+		}
+		fmt.Fprintf(w, "%s %s\n", h.series(h.name+"_sum", k), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_count", k), s.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// WriteTo writes every metric in the text exposition format, sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	fams := make([]family, 0, len(r.families))
+	for _, f := range r.families {
+		fams = append(fams, f)
+	}
+	r.mu.Unlock()
+	slices.SortFunc(fams, func(a, b family) int { return strings.Compare(a.info().name, b.info().name) })
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range fams {
+		d := f.info()
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, d.kind)
+		f.write(cw)
+	}
+	return cw.n, cw.w.Flush()
+}
+
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Handler serves r in the text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("calls_total", "Calls.", "method", "result")
+	c.Inc("get", "ok")
+	c.Add(2, "get", `bad"one`)
+	h := r.Histogram("latency_seconds", "Latency.", []float64{.1, 1}, "method")
+	h.Observe(.05, "get")
+	h.Observe(.5, "get")
+	h.Observe(5, "get")
+	r.Gauge("up", "Up.").Set(1)
+
+	var sb strings.Builder
+	if _, err := r.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP calls_total Calls.
+# TYPE calls_total counter
+calls_total{method="get",result="bad\"one"} 2
+calls_total{method="get",result="ok"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="get",le="0.1"} 1
+latency_seconds_bucket{method="get",le="1"} 2
+latency_seconds_bucket{method="get",le="+Inf"} 3
+latency_seconds_sum{method="get"} 5.55
+latency_seconds_count{method="get"} 3
+# HELP up Up.
+# TYPE up gauge
+up 1
+`
+	if got := sb.String(); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	r := NewRegistry()
+	a := r.Counter("x_total", "X.", "l")
+	if b := r.Counter("x_total", "X.", "l"); a != b {
+		t.Fatal("re-registering returned a new counter")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering x_total as a gauge did not panic")
+		}
+	}()
+	r.Gauge("x_total", "X.")
+}
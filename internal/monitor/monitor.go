@@ -0,0 +1,130 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"home-alarm-bot/internal/metrics"
+	"home-alarm-bot/internal/state"
+)
+
+var (
+	lastHeartbeat = metrics.NewGauge("alarm_last_heartbeat_timestamp_seconds",
+		"When the alarm server last answered a status poll, as Unix time.")
+	serverDown = metrics.NewGauge("alarm_server_down",
+		"1 while the alarm server is considered unreachable.")
+)
+
+// StatusSource reports the panel's state; *alarm.Client satisfies it.
+type StatusSource interface {
+	Status(ctx context.Context) (string, error)
+}
+
+// Notifier receives broadcasts; *telegram.Bot satisfies it.
+type Notifier interface {
+	Broadcast(msg string)
+}
+
+// Monitor polls the alarm server, keeps state.Store in line with what the
+// panel reports, and raises an alert when the server has been unreachable
+// for longer than the threshold.
+type Monitor struct {
+	src       StatusSource
+	store     *state.Store
+	notify    Notifier
+	threshold time.Duration
+
+	mu      sync.Mutex
+	lastOK  time.Time
+	lastErr error
+	down    bool
+}
+
+// New returns a Monitor. threshold is how long polls may fail before the
+// server is reported unreachable.
+func New(src StatusSource, store *state.Store, n Notifier, threshold time.Duration) *Monitor {
+	return &Monitor{src: src, store: store, notify: n, threshold: threshold, lastOK: time.Now()}
+}
+
+// Run polls every interval until stop is closed.
+func (m *Monitor) Run(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-t.C:
+			m.Poll(now)
+		}
+	}
+}
+
+// Poll runs one status check as of now. The source is expected to bound the
+// call itself; *alarm.Client applies its own timeout.
+func (m *Monitor) Poll(now time.Time) {
+	version := m.store.Version()
+	st, err := m.src.Status(context.Background())
+
+	m.mu.Lock()
+	if err != nil {
+		m.lastErr = err
+		alert := !m.down && now.Sub(m.lastOK) > m.threshold
+		if alert {
+			m.down = true
+		}
+		since := m.lastOK
+		m.mu.Unlock()
+
+		if alert {
+			serverDown.Set(1)
+			m.store.Record(state.Event{Kind: "alarm_server_down", Text: err.Error()})
+			m.notify.Broadcast(fmt.Sprintf("⚠️ Alarm server unreachable since %s: %v",
+				since.Format("15:04:05"), err))
+		}
+		return
+	}
+	recovered := m.down
+	m.down, m.lastOK, m.lastErr = false, now, nil
+	m.mu.Unlock()
+	lastHeartbeat.SetTime(now)
+	serverDown.Set(0)
+
+	if recovered {
+		m.store.Record(state.Event{Kind: "alarm_server_up", Text: "alarm server reachable again"})
+		m.notify.Broadcast("✅ Alarm server reachable again")
+	}
+	m.reconcile(state.AlarmState(st), version)
+}
+
+// reconcile adopts the panel's state when it differs from the store, e.g.
+// after someone armed it at the keypad. version is the store's as the poll
+// began: a command that set the state since then is newer than what the
+// panel said, and wins.
+func (m *Monitor) reconcile(panel state.AlarmState, version uint64) {
+	if panel != state.Armed && panel != state.Disarmed {
+		log.Printf("monitor: ignoring unknown panel state %q", panel)
+		return
+	}
+	if m.store.Get() == panel {
+		return
+	}
+	had, ok := m.store.CompareAndSet(version, panel)
+	if !ok || had == panel {
+		return
+	}
+	m.store.Record(state.Event{Kind: "state", Text: string(panel),
+		Fields: map[string]string{"source": "panel", "previous": string(had)}})
+	m.notify.Broadcast(fmt.Sprintf("🔄 Panel reports %s (bot had %s) — state updated", panel, had))
+}
+
+// Health reports when the alarm server last answered, the last error since
+// then, and whether it is currently considered down.
+func (m *Monitor) Health() (lastOK time.Time, lastErr error, down bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastOK, m.lastErr, m.down
+}
@@ -0,0 +1,105 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"home-alarm-bot/internal/state"
+)
+
+type fakePanel struct {
+	st     string
+	err    error
+	during func() // runs while Status is in flight
+}
+
+func (f *fakePanel) Status(context.Context) (string, error) {
+	if f.during != nil {
+		f.during()
+	}
+	return f.st, f.err
+}
+
+type recorder struct{ msgs []string }
+
+func (r *recorder) Broadcast(msg string) { r.msgs = append(r.msgs, msg) }
+
+func TestMonitor_ReconcilesDrift(t *testing.T) {
+	panel := &fakePanel{st: "ARMED"}
+	st := state.New()
+	n := &recorder{}
+	m := New(panel, st, n, time.Minute)
+
+	m.Poll(time.Now())
+	if st.Get() != state.Armed {
+		t.Fatalf("store = %s, want ARMED", st.Get())
+	}
+	if len(n.msgs) != 1 || !strings.Contains(n.msgs[0], "Panel reports ARMED") {
+		t.Fatalf("broadcasts = %q", n.msgs)
+	}
+
+	m.Poll(time.Now()) // no drift, no message
+	panel.st = "SOMETHING"
+	m.Poll(time.Now()) // unknown state ignored
+	if len(n.msgs) != 1 || st.Get() != state.Armed {
+		t.Fatalf("unexpected broadcasts %q or state %s", n.msgs, st.Get())
+	}
+	if h := st.History(1); h[0].Fields["source"] != "panel" {
+		t.Fatalf("drift not recorded: %+v", h)
+	}
+}
+
+// TestMonitor_CommandDuringPoll arms the bot while a poll is in flight: the
+// panel's answer predates the command and must not undo it.
+func TestMonitor_CommandDuringPoll(t *testing.T) {
+	st := state.New()
+	panel := &fakePanel{st: "DISARMED"}
+	panel.during = func() { st.Set(state.Armed) }
+	n := &recorder{}
+	m := New(panel, st, n, time.Minute)
+
+	m.Poll(time.Now())
+	if st.Get() != state.Armed || len(n.msgs) != 0 {
+		t.Fatalf("store %s, broadcasts %q", st.Get(), n.msgs)
+	}
+
+	// The next poll sees the panel disagree with a settled store.
+	panel.during = nil
+	m.Poll(time.Now())
+	if st.Get() != state.Disarmed || len(n.msgs) != 1 {
+		t.Fatalf("drift not reconciled: store %s, broadcasts %q", st.Get(), n.msgs)
+	}
+}
+
+func TestMonitor_UnreachableThreshold(t *testing.T) {
+	panel := &fakePanel{err: errors.New("connection refused")}
+	st := state.New()
+	n := &recorder{}
+	start := time.Now()
+	m := New(panel, st, n, time.Minute)
+
+	m.Poll(start.Add(30 * time.Second))
+	if len(n.msgs) != 0 {
+		t.Fatalf("alerted before threshold: %q", n.msgs)
+	}
+	m.Poll(start.Add(2 * time.Minute))
+	m.Poll(start.Add(3 * time.Minute))
+	if len(n.msgs) != 1 || !strings.Contains(n.msgs[0], "unreachable") {
+		t.Fatalf("want one unreachable alert, got %q", n.msgs)
+	}
+	if _, err, down := m.Health(); !down || err == nil {
+		t.Fatalf("Health down=%v err=%v", down, err)
+	}
+
+	panel.err, panel.st = nil, "DISARMED"
+	m.Poll(start.Add(4 * time.Minute))
+	if last := n.msgs[len(n.msgs)-1]; !strings.Contains(last, "reachable again") {
+		t.Fatalf("recovery message = %q", last)
+	}
+	if _, _, down := m.Health(); down {
+		t.Fatal("still down after recovery")
+	}
+}
@@ -0,0 +1,489 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"home-alarm-bot/internal/mqtt/wire"
+)
+
+// Options configure a Client.
+type Options struct {
+	// Addr is host:port, optionally prefixed with tcp://, mqtt://, ssl://,
+	// tls:// or mqtts://. The last three, or a non-nil TLS, connect over TLS.
+	Addr     string
+	ClientID string
+	Username string
+	// Password is only sent with a Username; MQTT 3.1.1 has no password
+	// without one.
+	Password string
+	// KeepAlive is the ping interval; 30s if zero.
+	KeepAlive time.Duration
+	TLS       *tls.Config
+	// Will is published by the broker if the connection drops uncleanly.
+	Will *Message
+	// OnConnect runs after every (re)connection, once subscriptions are
+	// restored, e.g. to re-announce retained state.
+	OnConnect func()
+}
+
+// ErrNotConnected is returned by Publish while the client is reconnecting.
+var ErrNotConnected = errors.New("mqtt: not connected")
+
+// Backoff bounds for reconnecting; variables so tests can shorten them.
+var (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// ioTimeout bounds dialling, the handshake and each write.
+const ioTimeout = 10 * time.Second
+
+type subscription struct {
+	filter  string
+	qos     byte
+	handler func(Message)
+}
+
+// Client is a connection to a broker that reconnects on its own and restores
+// its subscriptions. Handlers run one at a time, in arrival order.
+type Client struct {
+	opts Options
+
+	mu      sync.Mutex
+	conn    net.Conn // nil while disconnected
+	up      chan struct{}
+	subs    []subscription
+	hooks   []func()
+	pending map[uint16]chan error
+	nextID  uint16
+
+	wmu    sync.Mutex // serialises writes
+	stop   chan struct{}
+	done   chan struct{}
+	closed sync.Once
+}
+
+// Connect starts a client that keeps connecting to opts.Addr until Close.
+// It returns at once; use WaitConnected to block until the first session.
+func Connect(opts Options) *Client {
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = 30 * time.Second
+	}
+	c := &Client{
+		opts:    opts,
+		up:      make(chan struct{}),
+		pending: make(map[uint16]chan error),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// WaitConnected blocks until the client has a session or ctx is done.
+func (c *Client) WaitConnected(ctx context.Context) error {
+	c.mu.Lock()
+	up := c.up
+	c.mu.Unlock()
+	select {
+	case <-up:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OnConnect adds f to the hooks run after every (re)connection, like
+// Options.OnConnect. If the client is connected already f runs now too.
+func (c *Client) OnConnect(f func()) {
+	c.mu.Lock()
+	c.hooks = append(c.hooks, f)
+	connected := c.conn != nil
+	c.mu.Unlock()
+	if connected {
+		go f()
+	}
+}
+
+// Connected reports whether the client currently has a session.
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// Publish sends m. For QoS 1 it waits for the broker's acknowledgement.
+func (c *Client) Publish(ctx context.Context, m Message) error {
+	if m.QoS > 1 {
+		return errors.New("mqtt: QoS 2 is not supported")
+	}
+	if m.QoS == 0 {
+		return c.write(wire.PublishPacket(m, 0))
+	}
+	id, ack := c.track()
+	defer c.untrack(id)
+	if err := c.write(wire.PublishPacket(m, id)); err != nil {
+		return err
+	}
+	return c.wait(ctx, ack)
+}
+
+// Subscribe registers h for messages matching filter, now and after every
+// reconnection. While disconnected it only registers.
+func (c *Client) Subscribe(ctx context.Context, filter string, qos byte, h func(Message)) error {
+	if qos > 1 {
+		return errors.New("mqtt: QoS 2 is not supported")
+	}
+	c.mu.Lock()
+	c.subs = append(c.subs, subscription{filter, qos, h})
+	connected := c.conn != nil
+	c.mu.Unlock()
+	if !connected {
+		return nil
+	}
+
+	id, ack := c.track()
+	defer c.untrack(id)
+	if err := c.write(subscribePacket(id, filter, qos)); err != nil {
+		if errors.Is(err, ErrNotConnected) {
+			return nil
+		}
+		return err
+	}
+	return c.wait(ctx, ack)
+}
+
+// Unsubscribe removes every handler registered for filter and tells the
+// broker to stop sending it. While disconnected it only unregisters.
+func (c *Client) Unsubscribe(ctx context.Context, filter string) error {
+	c.mu.Lock()
+	subs := c.subs[:0:0]
+	for _, s := range c.subs {
+		if s.filter != filter {
+			subs = append(subs, s)
+		}
+	}
+	c.subs = subs
+	connected := c.conn != nil
+	c.mu.Unlock()
+	if !connected {
+		return nil
+	}
+
+	id, ack := c.track()
+	defer c.untrack(id)
+	body := binary.BigEndian.AppendUint16(nil, id)
+	if err := c.write(wire.Packet{Header: wire.Unsubscribe<<4 | 2, Body: wire.AppendString(body, filter)}); err != nil {
+		if errors.Is(err, ErrNotConnected) {
+			return nil
+		}
+		return err
+	}
+	return c.wait(ctx, ack)
+}
+
+// Close disconnects cleanly, so no Will is sent, and stops reconnecting.
+func (c *Client) Close() error {
+	c.closed.Do(func() {
+		_ = c.write(wire.Packet{Header: wire.Disconnect << 4})
+		close(c.stop)
+		c.mu.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.mu.Unlock()
+	})
+	<-c.done
+	return nil
+}
+
+func subscribePacket(id uint16, filter string, qos byte) wire.Packet {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = wire.AppendString(body, filter)
+	return wire.Packet{Header: wire.Subscribe<<4 | 2, Body: append(body, qos)}
+}
+
+func (c *Client) track() (uint16, chan error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		c.nextID++
+		if _, busy := c.pending[c.nextID]; c.nextID != 0 && !busy {
+			break
+		}
+	}
+	ch := make(chan error, 1)
+	c.pending[c.nextID] = ch
+	return c.nextID, ch
+}
+
+func (c *Client) untrack(id uint16) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *Client) wait(ctx context.Context, ack chan error) error {
+	select {
+	case err := <-ack:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) write(p wire.Packet) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_ = conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+	if _, err := conn.Write(p.Encode()); err != nil {
+		conn.Close()
+		return ErrNotConnected
+	}
+	return nil
+}
+
+func (c *Client) run() {
+	defer close(c.done)
+	backoff := minBackoff
+	for {
+		conn, br, err := c.dial()
+		if err == nil {
+			backoff = minBackoff
+			err = c.serve(conn, br)
+		}
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+		log.Printf("mqtt %s: %v; reconnecting in %s", c.opts.Addr, err, backoff)
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// dial connects and completes the CONNECT handshake.
+func (c *Client) dial() (net.Conn, *bufio.Reader, error) {
+	addr, secure := c.opts.Addr, c.opts.TLS != nil
+	if scheme, rest, ok := strings.Cut(addr, "://"); ok {
+		addr = rest
+		secure = secure || scheme == "ssl" || scheme == "tls" || scheme == "mqtts"
+	}
+	d := &net.Dialer{Timeout: ioTimeout}
+	var conn net.Conn
+	var err error
+	if secure {
+		cfg := c.opts.TLS
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		conn, err = tls.DialWithDialer(d, "tcp", addr, cfg)
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(ioTimeout))
+	if _, err := conn.Write(c.connectPacket().Encode()); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	br := bufio.NewReader(conn)
+	p, err := wire.ReadPacket(br)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if p.Kind() != wire.Connack || len(p.Body) != 2 {
+		conn.Close()
+		return nil, nil, errors.New("mqtt: expected CONNACK")
+	}
+	if rc := p.Body[1]; rc != 0 {
+		conn.Close()
+		return nil, nil, connackError(rc)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, br, nil
+}
+
+func (c *Client) connectPacket() wire.Packet {
+	var flags byte = 0x02 // clean session
+	if w := c.opts.Will; w != nil {
+		flags |= 0x04 | w.QoS<<3
+		if w.Retain {
+			flags |= 0x20
+		}
+	}
+	// MQTT 3.1.1 §3.1.2.9: no password flag without the user name flag
+	user, pass := c.opts.Username, c.opts.Password
+	if user == "" {
+		pass = ""
+	}
+	if user != "" {
+		flags |= 0x80
+	}
+	if pass != "" {
+		flags |= 0x40
+	}
+	body := wire.AppendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(c.opts.KeepAlive/time.Second))
+	body = wire.AppendString(body, c.opts.ClientID)
+	if w := c.opts.Will; w != nil {
+		body = wire.AppendString(body, w.Topic)
+		body = wire.AppendString(body, string(w.Payload))
+	}
+	if user != "" {
+		body = wire.AppendString(body, user)
+	}
+	if pass != "" {
+		body = wire.AppendString(body, pass)
+	}
+	return wire.Packet{Header: wire.Connect << 4, Body: body}
+}
+
+func connackError(rc byte) error {
+	switch rc {
+	case 4:
+		return errors.New("mqtt: bad user name or password")
+	case 5:
+		return errors.New("mqtt: not authorized")
+	default:
+		return fmt.Errorf("mqtt: connection refused (code %d)", rc)
+	}
+}
+
+// serve runs one session until the connection drops.
+func (c *Client) serve(conn net.Conn, br *bufio.Reader) error {
+	c.mu.Lock()
+	c.conn = conn
+	subs := append([]subscription(nil), c.subs...)
+	c.mu.Unlock()
+
+	// Resubscriptions are not waited for, but their IDs are tracked like
+	// any other so a late SUBACK cannot settle someone else's packet.
+	for _, s := range subs {
+		id, _ := c.track()
+		_ = c.write(subscribePacket(id, s.filter, s.qos))
+	}
+
+	c.mu.Lock()
+	close(c.up)
+	hooks := c.hooks
+	c.mu.Unlock()
+	go func() {
+		if c.opts.OnConnect != nil {
+			c.opts.OnConnect()
+		}
+		for _, f := range hooks {
+			f()
+		}
+	}()
+
+	inbox := make(chan Message, 64)
+	defer close(inbox)
+	go func() {
+		for m := range inbox {
+			c.dispatch(m)
+		}
+	}()
+
+	pingDone := make(chan struct{})
+	defer close(pingDone)
+	go func() {
+		t := time.NewTicker(c.opts.KeepAlive)
+		defer t.Stop()
+		for {
+			select {
+			case <-pingDone:
+				return
+			case <-t.C:
+				_ = c.write(wire.Packet{Header: wire.Pingreq << 4})
+			}
+		}
+	}()
+
+	err := c.read(conn, br, inbox)
+
+	c.mu.Lock()
+	c.conn = nil
+	c.up = make(chan struct{})
+	for id, ch := range c.pending {
+		ch <- ErrNotConnected
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	conn.Close()
+	return err
+}
+
+func (c *Client) read(conn net.Conn, br *bufio.Reader, inbox chan<- Message) error {
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(c.opts.KeepAlive * 3 / 2))
+		p, err := wire.ReadPacket(br)
+		if err != nil {
+			return err
+		}
+		switch p.Kind() {
+		case wire.Publish:
+			m, id, err := wire.ParsePublish(p)
+			if err != nil {
+				return err
+			}
+			if m.QoS == 1 {
+				_ = c.write(wire.AckPacket(wire.Puback, id))
+			}
+			inbox <- m
+		case wire.Puback, wire.Suback, wire.Unsuback:
+			r := &wire.Reader{B: p.Body}
+			id := r.Uint16()
+			var err error
+			if p.Kind() == wire.Suback && len(r.B) > 0 && r.B[0] == 0x80 {
+				err = errors.New("mqtt: subscription refused")
+			}
+			c.mu.Lock()
+			if ch, ok := c.pending[id]; ok {
+				ch <- err
+				delete(c.pending, id)
+			}
+			c.mu.Unlock()
+		case wire.Pingresp:
+		default:
+			return fmt.Errorf("mqtt: unexpected packet type %d", p.Kind())
+		}
+	}
+}
+
+func (c *Client) dispatch(m Message) {
+	c.mu.Lock()
+	subs := append([]subscription(nil), c.subs...)
+	c.mu.Unlock()
+	for _, s := range subs {
+		if wire.Match(s.filter, m.Topic) {
+			s.handler(m)
+		}
+	}
+}
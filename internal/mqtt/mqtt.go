@@ -0,0 +1,13 @@
+// Package mqtt is a small MQTT 3.1.1 client: enough to publish retained
+// state and exchange commands with a broker. QoS 2 is not supported. Tests
+// can run against the in-process broker in mqtttest.
+package mqtt
+
+import "home-alarm-bot/internal/mqtt/wire"
+
+// Message is one application message.
+type Message = wire.Message
+
+// Match reports whether topic matches filter, which may use the + and #
+// wildcards.
+func Match(filter, topic string) bool { return wire.Match(filter, topic) }
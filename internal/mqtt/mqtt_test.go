@@ -0,0 +1,202 @@
+package mqtt
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"home-alarm-bot/internal/mqtt/mqtttest"
+)
+
+func startBroker(t *testing.T) (*mqtttest.Broker, string) {
+	t.Helper()
+	b := mqtttest.NewBroker()
+	addr, err := b.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b, addr
+}
+
+func connect(t *testing.T, opts Options) *Client {
+	t.Helper()
+	c := Connect(opts)
+	t.Cleanup(func() { c.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.WaitConnected(ctx); err != nil {
+		t.Fatalf("connect %s: %v", opts.ClientID, err)
+	}
+	return c
+}
+
+func receive(t *testing.T, ch <-chan Message) Message {
+	t.Helper()
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message")
+		return Message{}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a/b/c", true},
+		{"#", "a", true},
+		{"a/b", "a", false},
+		{"+/b", "x/c", false},
+	}
+	for _, tc := range cases {
+		if got := Match(tc.filter, tc.topic); got != tc.want {
+			t.Errorf("Match(%q, %q) = %v", tc.filter, tc.topic, got)
+		}
+	}
+}
+
+func TestPublishSubscribeRetained(t *testing.T) {
+	b, addr := startBroker(t)
+	ctx := context.Background()
+
+	pub := connect(t, Options{Addr: "tcp://" + addr, ClientID: "pub"})
+	if err := pub.Publish(ctx, Message{Topic: "home/state", Payload: []byte("ARMED"), QoS: 1, Retain: true}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if m, ok := b.Retained("home/state"); !ok || string(m.Payload) != "ARMED" {
+		t.Fatalf("retained = %+v %v", m, ok)
+	}
+
+	got := make(chan Message, 4)
+	sub := connect(t, Options{Addr: addr, ClientID: "sub"})
+	if err := sub.Subscribe(ctx, "home/#", 1, func(m Message) { got <- m }); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if m := receive(t, got); m.Topic != "home/state" || !m.Retain || string(m.Payload) != "ARMED" {
+		t.Fatalf("retained delivery = %+v", m)
+	}
+	_ = pub.Publish(ctx, Message{Topic: "home/events", Payload: []byte("x")})
+	if m := receive(t, got); m.Topic != "home/events" || m.Retain {
+		t.Fatalf("live delivery = %+v", m)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	_, addr := startBroker(t)
+	ctx := context.Background()
+
+	got := make(chan Message, 4)
+	sub := connect(t, Options{Addr: addr, ClientID: "sub"})
+	if err := sub.Subscribe(ctx, "a", 1, func(m Message) { got <- m }); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Subscribe(ctx, "b", 1, func(m Message) { got <- m }); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Unsubscribe(ctx, "a"); err != nil {
+		t.Fatalf("unsubscribe: %v", err)
+	}
+
+	pub := connect(t, Options{Addr: addr, ClientID: "pub"})
+	_ = pub.Publish(ctx, Message{Topic: "a", Payload: []byte("gone"), QoS: 1})
+	_ = pub.Publish(ctx, Message{Topic: "b", Payload: []byte("kept"), QoS: 1})
+	if m := receive(t, got); m.Topic != "b" {
+		t.Fatalf("got %+v after unsubscribing from a", m)
+	}
+}
+
+func TestWillAndAuth(t *testing.T) {
+	b, addr := startBroker(t)
+	b.Auth = func(user, pass string) bool { return user == "" && pass == "" || user == "bot" && pass == "pw" }
+	ctx := context.Background()
+
+	c := Connect(Options{Addr: addr, ClientID: "bad", Username: "bot", Password: "nope"})
+	short, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if err := c.WaitConnected(short); err == nil {
+		t.Fatal("connected with a wrong password")
+	}
+	c.Close()
+
+	// A password alone is not sent, so the broker sees an anonymous client.
+	connect(t, Options{Addr: addr, ClientID: "nouser", Password: "pw"})
+
+	watcher := connect(t, Options{Addr: addr, ClientID: "w", Username: "bot", Password: "pw"})
+	got := make(chan Message, 1)
+	_ = watcher.Subscribe(ctx, "bot/online", 0, func(m Message) { got <- m })
+
+	// A raw connection that vanishes without DISCONNECT triggers the will.
+	dying := Connect(Options{Addr: addr, ClientID: "d", Username: "bot", Password: "pw",
+		Will: &Message{Topic: "bot/online", Payload: []byte("offline"), Retain: true}})
+	if err := dying.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+	dying.mu.Lock()
+	dying.conn.(*net.TCPConn).Close()
+	dying.mu.Unlock()
+	if m := receive(t, got); string(m.Payload) != "offline" {
+		t.Fatalf("will = %+v", m)
+	}
+	dying.Close()
+}
+
+func TestReconnectRestoresSubscriptions(t *testing.T) {
+	minBackoff = 10 * time.Millisecond
+	defer func() { minBackoff = time.Second }()
+
+	b, addr := startBroker(t)
+	ctx := context.Background()
+	connected := make(chan struct{}, 4)
+	sub := connect(t, Options{Addr: addr, ClientID: "sub", OnConnect: func() { connected <- struct{}{} }})
+	<-connected
+	got := make(chan Message, 1)
+	_ = sub.Subscribe(ctx, "cmd", 1, func(m Message) { got <- m })
+	sub.mu.Lock()
+	sub.nextID = 0xFFF0
+	sub.mu.Unlock()
+
+	// Restart the broker on the same address.
+	b.Close()
+	b2 := mqtttest.NewBroker()
+	if _, err := b2.Listen(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer b2.Close()
+	select {
+	case <-connected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("client did not reconnect")
+	}
+
+	pub := connect(t, Options{Addr: addr, ClientID: "pub"})
+	// The resubscription is not acknowledged synchronously; retry briefly.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_ = pub.Publish(ctx, Message{Topic: "cmd", Payload: []byte("arm")})
+		select {
+		case m := <-got:
+			if string(m.Payload) != "arm" {
+				t.Fatalf("got %+v", m)
+			}
+			// the resubscription took its ID from the same sequence
+			sub.mu.Lock()
+			defer sub.mu.Unlock()
+			if sub.nextID != 0xFFF1 {
+				t.Fatalf("next packet ID = %#x, want 0xfff1", sub.nextID)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscription not restored")
+		}
+	}
+}
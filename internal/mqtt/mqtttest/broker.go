@@ -0,0 +1,256 @@
+// Package mqtttest provides an in-process MQTT broker for tests.
+package mqtttest
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"home-alarm-bot/internal/mqtt/wire"
+)
+
+// ioTimeout bounds each write to a client.
+const ioTimeout = 10 * time.Second
+
+// Broker is a minimal in-process MQTT broker. It keeps retained messages and
+// delivers everything at QoS 0; sessions are never persisted.
+type Broker struct {
+	// Auth, if set, decides whether a CONNECT's credentials are accepted.
+	Auth func(username, password string) bool
+
+	mu       sync.Mutex
+	ln       net.Listener
+	sessions map[*session]struct{}
+	retained map[string]wire.Message
+}
+
+type session struct {
+	conn    net.Conn
+	wmu     sync.Mutex
+	filters map[string]struct{}
+	will    *wire.Message
+}
+
+// NewBroker returns a Broker that is not yet listening.
+func NewBroker() *Broker {
+	return &Broker{sessions: make(map[*session]struct{}), retained: make(map[string]wire.Message)}
+}
+
+// Listen starts accepting clients on addr (e.g. "127.0.0.1:0") and returns
+// the address actually bound.
+func (b *Broker) Listen(addr string) (string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	b.ln = ln
+	b.mu.Unlock()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return ln.Addr().String(), nil
+}
+
+// Close stops listening and drops every client.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+	if b.ln == nil {
+		return nil
+	}
+	return b.ln.Close()
+}
+
+// Retained returns the retained message on topic, if any.
+func (b *Broker) Retained(topic string) (wire.Message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m, ok := b.retained[topic]
+	return m, ok
+}
+
+// Publish delivers m as if a client had sent it.
+func (b *Broker) Publish(m wire.Message) {
+	b.mu.Lock()
+	if m.Retain {
+		if len(m.Payload) == 0 {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m
+		}
+	}
+	var to []*session
+	for s := range b.sessions {
+		for f := range s.filters {
+			if wire.Match(f, m.Topic) {
+				to = append(to, s)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	m.QoS, m.Retain = 0, false
+	for _, s := range to {
+		s.send(wire.PublishPacket(m, 0))
+	}
+}
+
+func (s *session) send(p wire.Packet) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(ioTimeout))
+	if _, err := s.conn.Write(p.Encode()); err != nil {
+		s.conn.Close()
+	}
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(ioTimeout))
+	p, err := wire.ReadPacket(br)
+	if err != nil || p.Kind() != wire.Connect {
+		return
+	}
+	s, keepAlive, rc := b.connect(conn, p)
+	s.send(wire.Packet{Header: wire.Connack << 4, Body: []byte{0, rc}})
+	if rc != 0 {
+		return
+	}
+
+	b.mu.Lock()
+	b.sessions[s] = struct{}{}
+	b.mu.Unlock()
+
+	clean := false
+	defer func() {
+		b.mu.Lock()
+		delete(b.sessions, s)
+		b.mu.Unlock()
+		if !clean && s.will != nil {
+			b.Publish(*s.will)
+		}
+	}()
+
+	for {
+		if keepAlive > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		} else {
+			_ = conn.SetReadDeadline(time.Time{})
+		}
+		p, err := wire.ReadPacket(br)
+		if err != nil {
+			return
+		}
+		switch p.Kind() {
+		case wire.Publish:
+			m, id, err := wire.ParsePublish(p)
+			if err != nil {
+				log.Printf("mqtt broker: %v", err)
+				return
+			}
+			if m.QoS == 1 {
+				s.send(wire.AckPacket(wire.Puback, id))
+			}
+			b.Publish(m)
+		case wire.Subscribe:
+			b.subscribe(s, p)
+		case wire.Unsubscribe:
+			r := &wire.Reader{B: p.Body}
+			id := r.Uint16()
+			b.mu.Lock()
+			for len(r.B) > 0 && r.Err == nil {
+				delete(s.filters, r.Str())
+			}
+			b.mu.Unlock()
+			s.send(wire.AckPacket(wire.Unsuback, id))
+		case wire.Pingreq:
+			s.send(wire.Packet{Header: wire.Pingresp << 4})
+		case wire.Disconnect:
+			clean = true
+			return
+		default:
+			return
+		}
+	}
+}
+
+// connect parses CONNECT and returns the session, keep-alive and CONNACK code.
+func (b *Broker) connect(conn net.Conn, p wire.Packet) (*session, time.Duration, byte) {
+	s := &session{conn: conn, filters: make(map[string]struct{})}
+	r := &wire.Reader{B: p.Body}
+	if r.Str() != "MQTT" || r.Byte() != 4 {
+		return s, 0, 1 // unacceptable protocol version
+	}
+	flags := r.Byte()
+	keepAlive := time.Duration(r.Uint16()) * time.Second
+	r.Str() // client ID
+	if flags&0x04 != 0 {
+		s.will = &wire.Message{Topic: r.Str(), Payload: r.Bytes(), QoS: flags >> 3 & 3, Retain: flags&0x20 != 0}
+	}
+	var user, pass string
+	if flags&0xC0 == 0x40 {
+		return s, 0, 4 // a password without a user name, which 3.1.1 forbids
+	}
+	if flags&0x80 != 0 {
+		user = r.Str()
+	}
+	if flags&0x40 != 0 {
+		pass = r.Str()
+	}
+	if r.Err != nil {
+		return s, 0, 2 // identifier rejected; the packet was garbage
+	}
+	if b.Auth != nil && !b.Auth(user, pass) {
+		return s, 0, 4
+	}
+	return s, keepAlive, 0
+}
+
+func (b *Broker) subscribe(s *session, p wire.Packet) {
+	r := &wire.Reader{B: p.Body}
+	id := r.Uint16()
+	var codes []byte
+	var filters []string
+	for len(r.B) > 0 && r.Err == nil {
+		f := r.Str()
+		r.Byte() // requested QoS; everything is delivered at 0
+		filters = append(filters, f)
+		codes = append(codes, 0)
+	}
+	if r.Err != nil {
+		s.conn.Close()
+		return
+	}
+
+	b.mu.Lock()
+	var retained []wire.Message
+	for _, f := range filters {
+		s.filters[f] = struct{}{}
+		for _, m := range b.retained {
+			if wire.Match(f, m.Topic) {
+				retained = append(retained, m)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	s.send(wire.Packet{Header: wire.Suback << 4, Body: append(wire.AckPacket(0, id).Body, codes...)})
+	for _, m := range retained {
+		m.QoS = 0
+		s.send(wire.PublishPacket(m, 0))
+	}
+}
@@ -0,0 +1,195 @@
+// Package wire encodes and decodes MQTT 3.1.1 control packets. It is shared
+// by the mqtt client and the test broker in mqtttest.
+package wire
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Packet types.
+const (
+	Connect     = 1
+	Connack     = 2
+	Publish     = 3
+	Puback      = 4
+	Subscribe   = 8
+	Suback      = 9
+	Unsubscribe = 10
+	Unsuback    = 11
+	Pingreq     = 12
+	Pingresp    = 13
+	Disconnect  = 14
+)
+
+// MaxPacket bounds what either side accepts.
+const MaxPacket = 1 << 20
+
+// Message is one application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// Packet is a raw control packet: the first header byte and the body.
+type Packet struct {
+	Header byte
+	Body   []byte
+}
+
+// Kind returns the packet type from the header.
+func (p Packet) Kind() byte { return p.Header >> 4 }
+
+// ReadPacket reads one packet from r.
+func ReadPacket(r *bufio.Reader) (Packet, error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return Packet{}, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return Packet{}, err
+		}
+		n += int(b&0x7F) * mult
+		if b&0x80 == 0 {
+			break
+		}
+		if mult *= 128; i == 3 {
+			return Packet{}, errors.New("mqtt: malformed remaining length")
+		}
+	}
+	if n > MaxPacket {
+		return Packet{}, fmt.Errorf("mqtt: packet of %d bytes too large", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Packet{}, err
+	}
+	return Packet{h, body}, nil
+}
+
+// Encode returns p as it goes on the wire.
+func (p Packet) Encode() []byte {
+	out := []byte{p.Header}
+	n := len(p.Body)
+	for {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, p.Body...)
+}
+
+// AppendString appends s with its two-byte length prefix.
+func AppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// Reader walks a packet body. The first short read sets Err; later reads
+// return zero values.
+type Reader struct {
+	B   []byte
+	Err error
+}
+
+func (r *Reader) Uint16() uint16 {
+	if len(r.B) < 2 {
+		r.Err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.B)
+	r.B = r.B[2:]
+	return v
+}
+
+func (r *Reader) Byte() byte {
+	if len(r.B) < 1 {
+		r.Err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := r.B[0]
+	r.B = r.B[1:]
+	return v
+}
+
+func (r *Reader) Bytes() []byte {
+	n := int(r.Uint16())
+	if r.Err != nil || len(r.B) < n {
+		r.Err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := r.B[:n]
+	r.B = r.B[n:]
+	return v
+}
+
+// Str reads a length-prefixed UTF-8 string.
+func (r *Reader) Str() string { return string(r.Bytes()) }
+
+// PublishPacket encodes m; id is only sent for QoS 1.
+func PublishPacket(m Message, id uint16) Packet {
+	h := byte(Publish<<4) | m.QoS<<1
+	if m.Retain {
+		h |= 1
+	}
+	body := AppendString(nil, m.Topic)
+	if m.QoS > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	return Packet{h, append(body, m.Payload...)}
+}
+
+// ParsePublish decodes a PUBLISH packet and its packet ID (0 for QoS 0).
+func ParsePublish(p Packet) (Message, uint16, error) {
+	m := Message{QoS: p.Header >> 1 & 3, Retain: p.Header&1 != 0}
+	r := &Reader{B: p.Body}
+	m.Topic = r.Str()
+	var id uint16
+	if m.QoS > 0 {
+		id = r.Uint16()
+	}
+	if r.Err != nil {
+		return m, 0, errors.New("mqtt: malformed publish")
+	}
+	if m.QoS > 1 {
+		return m, 0, errors.New("mqtt: QoS 2 is not supported")
+	}
+	m.Payload = append([]byte(nil), r.B...)
+	return m, id, nil
+}
+
+// AckPacket is a PUBACK, SUBACK header or UNSUBACK for packet id.
+func AckPacket(kind byte, id uint16) Packet {
+	return Packet{kind << 4, binary.BigEndian.AppendUint16(nil, id)}
+}
+
+// Match reports whether topic matches filter, which may use the + and #
+// wildcards.
+func Match(filter, topic string) bool {
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fs {
+		switch {
+		case f == "#":
+			return true
+		case i >= len(ts):
+			return false
+		case f != "+" && f != ts[i]:
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
@@ -0,0 +1,398 @@
+// Package mqttbridge mirrors the alarm onto MQTT: the state as a retained
+// message, history events as they are recorded, and arm/disarm commands
+// from authorised publishers.
+//
+// Commands arrive on a shared topic, so anyone the broker lets subscribe to
+// it, or to #, sees every command. They therefore carry no secret: each is
+// signed with its actor's secret over a timestamp, and one that is stale or
+// seen before is refused, so a captured command cannot be replayed. Signing
+// does not hide commands or stop others from publishing junk; use broker
+// ACLs for that.
+package mqttbridge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/mqtt"
+	"home-alarm-bot/internal/state"
+)
+
+// Topics names where the bridge publishes and listens. Empty topics take
+// their default under Config.Prefix.
+type Topics struct {
+	State        string // retained "ARMED" / "DISARMED"; default <prefix>/state
+	Availability string // retained "online" / "offline"; default <prefix>/availability
+	Incidents    string // incident and alarm events; default <prefix>/incidents
+	Sensors      string // sensor events; default <prefix>/sensors
+	Events       string // every other event; default <prefix>/events
+	Command      string // arm/disarm requests; default <prefix>/command
+}
+
+// Config describes the bridge.
+type Config struct {
+	// Prefix roots the default topics; "home-alarm-bot" if empty.
+	Prefix string
+	Topics Topics
+	// Secrets maps each actor to the secret its commands are signed with.
+	// Commands from other actors are refused; with no secrets, all are.
+	Secrets map[string]string
+	// Window bounds how far a command's timestamp may be from the bot's
+	// clock; 5 minutes if zero.
+	Window time.Duration
+	// HACodes maps each code typed in Home Assistant to the actor it stands
+	// for. The codes cross the broker in clear; see HomeAssistant.
+	//
+	// Neither secrets nor codes carry a Telegram role: all the bridge can do
+	// is arm and disarm, so every actor here has an operator's rights, and
+	// listing an actor is the grant. Reading state needs no command, and
+	// there is no way to change the PIN over MQTT.
+	HACodes map[string]string
+}
+
+// withDefaults fills in the default topics.
+func (c Config) withDefaults() Config {
+	if c.Prefix == "" {
+		c.Prefix = "home-alarm-bot"
+	}
+	def := func(t *string, name string) {
+		if *t == "" {
+			*t = c.Prefix + "/" + name
+		}
+	}
+	def(&c.Topics.State, "state")
+	def(&c.Topics.Availability, "availability")
+	def(&c.Topics.Incidents, "incidents")
+	def(&c.Topics.Sensors, "sensors")
+	def(&c.Topics.Events, "events")
+	def(&c.Topics.Command, "command")
+	if c.Window <= 0 {
+		c.Window = 5 * time.Minute
+	}
+	return c
+}
+
+// Will is the message to register on the MQTT connection so the broker
+// marks the bot offline if it disappears.
+func (c Config) Will() *mqtt.Message {
+	return &mqtt.Message{Topic: c.withDefaults().Topics.Availability, Payload: []byte("offline"), QoS: 1, Retain: true}
+}
+
+// Commander carries out commands; *telegram.Bot satisfies it.
+type Commander interface {
+	Arm(ctx context.Context, mode alarm.ArmMode, zones []string, source, actor string) error
+	Disarm(ctx context.Context, source, actor string) error
+	Broadcast(msg string)
+}
+
+// Command is the JSON accepted on the command topic:
+//
+//	{"action":"arm","mode":"home","bypass":["garage"],"id":"42",
+//	 "actor":"alice","ts":1700000000,"sig":"…"}
+//	{"action":"disarm","actor":"alice","ts":1700000000,"sig":"…"}
+//
+// ts is Unix seconds and sig the hex HMAC-SHA256, keyed with the actor's
+// secret, of
+//
+//	<ts>\n<actor>\n<action>\n<mode>\n<bypass joined by ",">\n<id>
+//
+// as Sign computes it. The outcome is published to <command topic>/result as
+// {"id":"42","action":"arm","ok":true} or with "error" set.
+type Command struct {
+	Action string        `json:"action"`
+	Mode   alarm.ArmMode `json:"mode,omitempty"`
+	Bypass []string      `json:"bypass,omitempty"`
+	ID     string        `json:"id,omitempty"`
+	Actor  string        `json:"actor"`
+	Time   int64         `json:"ts"`
+	Sig    string        `json:"sig"`
+}
+
+// Sign returns cmd's signature under secret, for the sig field.
+func (cmd Command) Sign(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s\n%s\n%s\n%s\n%s", cmd.Time, cmd.Actor, cmd.Action, cmd.Mode, strings.Join(cmd.Bypass, ","), cmd.ID)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Result is published after each Command.
+type Result struct {
+	ID     string `json:"id,omitempty"`
+	Action string `json:"action"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+// commandTimeout bounds one command, panel round trip included.
+const commandTimeout = 15 * time.Second
+
+// outbox is how many messages may wait while the broker is slow.
+const outbox = 256
+
+// commandQueue bounds the authorised commands waiting for the worker.
+// Commands run off the client's dispatch goroutine: with the mqtt alarm
+// driver the panel's reply arrives on that same goroutine, and a command
+// waiting on it there would wait until it timed out.
+const commandQueue = 16
+
+// Bridge connects a state.Store and a Commander to MQTT.
+type Bridge struct {
+	c     *mqtt.Client
+	cfg   Config
+	store *state.Store
+	cmd   Commander
+	out   chan mqtt.Message
+	jobs  chan func() // commands for work, see commandQueue
+
+	quit      chan struct{} // closed by Close
+	done      chan struct{} // closed when run returns
+	closeOnce sync.Once
+
+	mu   sync.Mutex
+	seen map[string]time.Time // signature → expiry, for replay protection
+}
+
+// New returns a Bridge; call Start to begin.
+func New(c *mqtt.Client, cfg Config, store *state.Store, cmd Commander) *Bridge {
+	return &Bridge{c: c, cfg: cfg.withDefaults(), store: store, cmd: cmd, out: make(chan mqtt.Message, outbox),
+		jobs: make(chan func(), commandQueue), quit: make(chan struct{}), done: make(chan struct{}), seen: make(map[string]time.Time)}
+}
+
+// Topics returns the topics in use, defaults filled in.
+func (b *Bridge) Topics() Topics { return b.cfg.Topics }
+
+// Start hooks into the store, subscribes to the command topic and publishes
+// until ctx is done. State and availability are re-announced after every
+// reconnection.
+func (b *Bridge) Start(ctx context.Context) error {
+	if err := b.c.Subscribe(ctx, b.cfg.Topics.Command, 1, b.handleCommand); err != nil {
+		return err
+	}
+	b.store.OnChange(func(_, cur state.AlarmState) { b.publishState(cur) })
+	b.store.OnRecord(b.publishEvent)
+	b.c.OnConnect(func() {
+		b.enqueue(mqtt.Message{Topic: b.cfg.Topics.Availability, Payload: []byte("online"), QoS: 1, Retain: true})
+		b.publishState(b.store.Get())
+	})
+	go b.run(ctx)
+	go b.work(ctx)
+	return nil
+}
+
+// Publish queues m for the broker; it never blocks. Other integrations
+// sharing the connection use it so their messages keep the bridge's order.
+func (b *Bridge) Publish(m mqtt.Message) { b.enqueue(m) }
+
+func (b *Bridge) publishState(st state.AlarmState) {
+	b.enqueue(mqtt.Message{Topic: b.cfg.Topics.State, Payload: []byte(st), QoS: 1, Retain: true})
+}
+
+func (b *Bridge) publishEvent(ev state.Event) {
+	topic := b.cfg.Topics.Events
+	switch {
+	case ev.Kind == "incident" || ev.Kind == "alarm":
+		topic = b.cfg.Topics.Incidents
+	case strings.HasPrefix(ev.Kind, "sensor"):
+		topic = b.cfg.Topics.Sensors
+	}
+	payload, _ := json.Marshal(ev)
+	b.enqueue(mqtt.Message{Topic: topic, Payload: payload, QoS: 1})
+}
+
+func (b *Bridge) enqueue(m mqtt.Message) {
+	select {
+	case b.out <- m:
+	default:
+		log.Printf("mqtt bridge: outbox full, dropping message to %s", m.Topic)
+	}
+}
+
+func (b *Bridge) run(ctx context.Context) {
+	defer close(b.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.quit:
+			return
+		case m := <-b.out:
+			pctx, cancel := context.WithTimeout(ctx, commandTimeout)
+			err := b.c.Publish(pctx, m)
+			cancel()
+			// Retained state is re-announced on reconnect, so only the
+			// events are lost while the broker is away.
+			if err != nil {
+				log.Printf("mqtt bridge: publish %s: %v", m.Topic, err)
+			}
+		}
+	}
+}
+
+// work runs queued commands one at a time until the bridge stops.
+func (b *Bridge) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.quit:
+			return
+		case job := <-b.jobs:
+			job()
+		}
+	}
+}
+
+// submit queues job for work; it never blocks. It reports false when the
+// queue is full.
+func (b *Bridge) submit(job func()) bool {
+	select {
+	case b.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the bridge, publishes whatever is still queued and then marks
+// the bot offline, which a clean disconnect does not do through the Will.
+// It gives up when ctx is done. Call it after Start and before closing the
+// client.
+func (b *Bridge) Close(ctx context.Context) error {
+	b.closeOnce.Do(func() { close(b.quit) })
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	for {
+		select {
+		case m := <-b.out:
+			if err := b.c.Publish(ctx, m); err != nil {
+				return fmt.Errorf("publish %s: %w", m.Topic, err)
+			}
+		default:
+			return b.c.Publish(ctx, *b.cfg.Will())
+		}
+	}
+}
+
+func (b *Bridge) handleCommand(m mqtt.Message) {
+	var cmd Command
+	if err := json.Unmarshal(m.Payload, &cmd); err != nil {
+		b.reply(Result{Action: "?", Error: "invalid JSON"})
+		return
+	}
+	if err := b.verify(cmd); err != nil {
+		b.reply(b.refuse(cmd, "MQTT", err))
+		return
+	}
+	if !b.submit(func() { b.reply(b.execute(cmd, "MQTT", cmd.Actor)) }) {
+		log.Printf("mqtt bridge: command queue full, dropping %q from %s", cmd.Action, cmd.Actor)
+		b.reply(Result{ID: cmd.ID, Action: cmd.Action, Error: "busy"})
+	}
+}
+
+// verify checks cmd's signature, timestamp and freshness.
+func (b *Bridge) verify(cmd Command) error {
+	secret, ok := b.cfg.Secrets[cmd.Actor]
+	if !ok || cmd.Actor == "" || secret == "" {
+		return fmt.Errorf("unknown actor %q", cmd.Actor)
+	}
+	if d := time.Since(time.Unix(cmd.Time, 0)); d > b.cfg.Window || d < -b.cfg.Window {
+		return errors.New("timestamp outside replay window")
+	}
+	if subtle.ConstantTimeCompare([]byte(cmd.Sign(secret)), []byte(strings.ToLower(cmd.Sig))) != 1 {
+		return errors.New("signature mismatch")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	for k, exp := range b.seen {
+		if now.After(exp) {
+			delete(b.seen, k)
+		}
+	}
+	key := strings.ToLower(cmd.Sig)
+	if _, dup := b.seen[key]; dup {
+		return errors.New("replayed command")
+	}
+	b.seen[key] = now.Add(2 * b.cfg.Window)
+	return nil
+}
+
+// refuse logs and records a command that failed authorisation.
+func (b *Bridge) refuse(cmd Command, via string, reason error) Result {
+	source := strings.ToLower(via)
+	log.Printf("mqtt bridge: refused %q command from %s: %v", cmd.Action, via, reason)
+	b.store.Record(state.Event{Kind: "auth", Text: source + " command refused",
+		Fields: map[string]string{"source": source, "action": cmd.Action}})
+	return Result{ID: cmd.ID, Action: cmd.Action, Error: "unauthorized"}
+}
+
+// execute runs an authorised cmd for actor; via names the front end in
+// broadcasts.
+func (b *Bridge) execute(cmd Command, via, actor string) Result {
+	res := Result{ID: cmd.ID, Action: cmd.Action}
+	source := strings.ToLower(via)
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	var err error
+	switch cmd.Action {
+	case "arm":
+		mode, perr := alarm.ParseArmMode(string(cmd.Mode))
+		if perr != nil {
+			err = perr
+			break
+		}
+		if err = b.cmd.Arm(ctx, mode, cmd.Bypass, source, actor); err == nil {
+			msg := "🔒 System Armed (via " + via + ") by " + actor
+			if len(cmd.Bypass) > 0 {
+				msg += " (bypassing " + strings.Join(cmd.Bypass, ", ") + ")"
+			}
+			b.cmd.Broadcast(msg)
+		}
+	case "disarm":
+		if err = b.cmd.Disarm(ctx, source, actor); err == nil {
+			b.cmd.Broadcast("🔓 System Disarmed (via " + via + ") by " + actor)
+		}
+	default:
+		err = fmt.Errorf("unknown action %q", cmd.Action)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	res.OK = err == nil
+	return res
+}
+
+// authorize maps a Home Assistant code to its actor in constant time per
+// code.
+func (b *Bridge) authorize(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	for t, actor := range b.cfg.HACodes {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return actor, true
+		}
+	}
+	return "", false
+}
+
+func (b *Bridge) reply(r Result) {
+	payload, _ := json.Marshal(r)
+	b.enqueue(mqtt.Message{Topic: b.cfg.Topics.Command + "/result", Payload: payload, QoS: 1})
+}
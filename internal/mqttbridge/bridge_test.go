@@ -0,0 +1,269 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/mqtt"
+	"home-alarm-bot/internal/mqtt/mqtttest"
+	"home-alarm-bot/internal/state"
+	"home-alarm-bot/internal/testutil"
+)
+
+type fakeCommander struct {
+	store *state.Store
+	mu    sync.Mutex
+	calls []string
+	sent  []string
+}
+
+func (f *fakeCommander) Arm(_ context.Context, mode alarm.ArmMode, zones []string, source, actor string) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, "arm "+string(mode)+" "+source+" "+actor)
+	f.mu.Unlock()
+	f.store.Set(state.Armed)
+	f.store.Record(state.Event{Kind: "state", Text: string(state.Armed), Fields: map[string]string{"mode": string(mode)}})
+	return nil
+}
+
+func (f *fakeCommander) Disarm(_ context.Context, source, actor string) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, "disarm "+source+" "+actor)
+	f.mu.Unlock()
+	f.store.Set(state.Disarmed)
+	return nil
+}
+
+func (f *fakeCommander) Broadcast(msg string) {
+	f.mu.Lock()
+	f.sent = append(f.sent, msg)
+	f.mu.Unlock()
+}
+
+// start runs a broker, a bridge and a second client acting as the home
+// automation side. Each setup func runs on the started bridge.
+func start(t *testing.T, cfg Config, setup ...func(*Bridge)) (*mqtttest.Broker, *mqtt.Client, *state.Store, *fakeCommander) {
+	t.Helper()
+	broker := mqtttest.NewBroker()
+	addr, err := broker.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { broker.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	c := mqtt.Connect(mqtt.Options{Addr: addr, ClientID: "bot", Will: cfg.Will()})
+	t.Cleanup(func() { c.Close() })
+	if err := c.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+	st := state.New()
+	cmd := &fakeCommander{store: st}
+	b := New(c, cfg, st, cmd)
+	if err := b.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range setup {
+		f(b)
+	}
+
+	ha := mqtt.Connect(mqtt.Options{Addr: addr, ClientID: "ha"})
+	t.Cleanup(func() { ha.Close() })
+	if err := ha.WaitConnected(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return broker, ha, st, cmd
+}
+
+func retained(b *mqtttest.Broker, topic string) string {
+	m, _ := b.Retained(topic)
+	return string(m.Payload)
+}
+
+func TestBridge_PublishesStateAndEvents(t *testing.T) {
+	broker, ha, st, _ := start(t, Config{Prefix: "home", Topics: Topics{Incidents: "alerts/home"}})
+	ctx := context.Background()
+
+	testutil.WaitFor(t, "online", func() bool { return retained(broker, "home/availability") == "online" })
+	testutil.WaitFor(t, "initial state", func() bool { return retained(broker, "home/state") == "DISARMED" })
+
+	got := make(chan mqtt.Message, 8)
+	_ = ha.Subscribe(ctx, "alerts/#", 0, func(m mqtt.Message) { got <- m })
+	_ = ha.Subscribe(ctx, "home/sensors", 0, func(m mqtt.Message) { got <- m })
+	time.Sleep(20 * time.Millisecond)
+
+	st.Set(state.Armed)
+	testutil.WaitFor(t, "armed state", func() bool { return retained(broker, "home/state") == "ARMED" })
+
+	st.Record(state.Event{Kind: "incident", Text: "glass break in kitchen"})
+	st.Record(state.Event{Kind: "sensor_offline", Text: "pir offline"})
+	for _, want := range []struct{ topic, kind string }{{"alerts/home", "incident"}, {"home/sensors", "sensor_offline"}} {
+		select {
+		case m := <-got:
+			var ev state.Event
+			if json.Unmarshal(m.Payload, &ev); m.Topic != want.topic || ev.Kind != want.kind || ev.ID == 0 {
+				t.Fatalf("got %s %s, want %s %s", m.Topic, m.Payload, want.topic, want.kind)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %s event", want.kind)
+		}
+	}
+}
+
+func TestBridge_CloseDrains(t *testing.T) {
+	var b *Bridge
+	broker, ha, st, _ := start(t, Config{Prefix: "home"}, func(br *Bridge) { b = br })
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	testutil.WaitFor(t, "online", func() bool { return retained(broker, "home/availability") == "online" })
+
+	var mu sync.Mutex
+	var got []string
+	_ = ha.Subscribe(ctx, "home/events", 1, func(m mqtt.Message) {
+		mu.Lock()
+		got = append(got, string(m.Payload))
+		mu.Unlock()
+	})
+	time.Sleep(20 * time.Millisecond)
+
+	for range 20 {
+		st.Record(state.Event{Kind: "video", Text: "clip"})
+	}
+	if err := b.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if a := retained(broker, "home/availability"); a != "offline" {
+		t.Fatalf("availability = %q after Close", a)
+	}
+	testutil.WaitFor(t, "all queued events", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 20
+	})
+}
+
+func TestBridge_Commands(t *testing.T) {
+	_, ha, st, cmd := start(t, Config{Secrets: map[string]string{"hass": "s3cret"}})
+	ctx := context.Background()
+
+	results := make(chan Result, 4)
+	_ = ha.Subscribe(ctx, "home-alarm-bot/command/result", 0, func(m mqtt.Message) {
+		var r Result
+		json.Unmarshal(m.Payload, &r)
+		results <- r
+	})
+	send := func(c Command) Result {
+		t.Helper()
+		payload, _ := json.Marshal(c)
+		_ = ha.Publish(ctx, mqtt.Message{Topic: "home-alarm-bot/command", Payload: payload, QoS: 1})
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no result for %s", payload)
+			return Result{}
+		}
+	}
+	signed := func(c Command) Command {
+		c.Actor, c.Time = "hass", time.Now().Unix()
+		c.Sig = c.Sign("s3cret")
+		return c
+	}
+
+	forged := signed(Command{Action: "arm"})
+	forged.Sig = forged.Sign("guess")
+	if r := send(forged); r.OK || r.Error != "unauthorized" {
+		t.Fatalf("bad signature: %+v", r)
+	}
+	if h := st.History(1); len(h) != 1 || h[0].Kind != "auth" {
+		t.Fatalf("refusal not recorded: %+v", h)
+	}
+	stale := Command{Action: "arm", Actor: "hass", Time: time.Now().Add(-time.Hour).Unix()}
+	stale.Sig = stale.Sign("s3cret")
+	if r := send(stale); r.OK {
+		t.Fatalf("stale command accepted: %+v", r)
+	}
+	if r := send(signed(Command{Action: "arm", Mode: "holiday"})); r.OK {
+		t.Fatalf("bad mode accepted: %+v", r)
+	}
+	arm := signed(Command{Action: "arm", Mode: "home", ID: "7"})
+	if r := send(arm); !r.OK || r.ID != "7" {
+		t.Fatalf("arm: %+v", r)
+	}
+	if r := send(arm); r.OK || r.Error != "unauthorized" {
+		t.Fatalf("replayed arm: %+v", r)
+	}
+	tampered := signed(Command{Action: "disarm", ID: "8"})
+	tampered.ID = "9"
+	if r := send(tampered); r.OK {
+		t.Fatalf("tampered command accepted: %+v", r)
+	}
+	if r := send(signed(Command{Action: "disarm"})); !r.OK {
+		t.Fatalf("disarm: %+v", r)
+	}
+
+	cmd.mu.Lock()
+	defer cmd.mu.Unlock()
+	if len(cmd.calls) != 2 || cmd.calls[0] != "arm home mqtt hass" || cmd.calls[1] != "disarm mqtt hass" {
+		t.Fatalf("calls = %v", cmd.calls)
+	}
+	if len(cmd.sent) != 2 || cmd.sent[0] != "🔒 System Armed (via MQTT) by hass" {
+		t.Fatalf("broadcasts = %v", cmd.sent)
+	}
+}
+
+// pingCommander arms only once a message reaches the bridge's own client,
+// as the mqtt alarm driver does when it waits for the panel's reply.
+type pingCommander struct {
+	fakeCommander
+	ping chan struct{}
+}
+
+func (p *pingCommander) Arm(ctx context.Context, mode alarm.ArmMode, zones []string, source, actor string) error {
+	select {
+	case <-p.ping:
+		return p.fakeCommander.Arm(ctx, mode, zones, source, actor)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pingOnReply makes b's commander a pingCommander that waits for a message
+// on panel/reply.
+func pingOnReply(b *Bridge) {
+	pc := &pingCommander{fakeCommander: fakeCommander{store: b.store}, ping: make(chan struct{}, 1)}
+	b.cmd = pc
+	_ = b.c.Subscribe(context.Background(), "panel/reply", 1, func(mqtt.Message) { pc.ping <- struct{}{} })
+}
+
+func TestBridge_CommandLeavesDispatchFree(t *testing.T) {
+	_, ha, _, _ := start(t, Config{Secrets: map[string]string{"hass": "s3cret"}}, pingOnReply)
+	ctx := context.Background()
+
+	results := make(chan Result, 1)
+	_ = ha.Subscribe(ctx, "home-alarm-bot/command/result", 0, func(m mqtt.Message) {
+		var r Result
+		json.Unmarshal(m.Payload, &r)
+		results <- r
+	})
+	c := Command{Action: "arm", Actor: "hass", Time: time.Now().Unix()}
+	c.Sig = c.Sign("s3cret")
+	payload, _ := json.Marshal(c)
+	_ = ha.Publish(ctx, mqtt.Message{Topic: "home-alarm-bot/command", Payload: payload, QoS: 1})
+	_ = ha.Publish(ctx, mqtt.Message{Topic: "panel/reply", Payload: []byte("ok"), QoS: 1})
+
+	select {
+	case r := <-results:
+		if !r.OK {
+			t.Fatalf("arm: %+v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("arm still waiting: the command holds the client's dispatch goroutine")
+	}
+}
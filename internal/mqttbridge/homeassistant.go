@@ -0,0 +1,296 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/mqtt"
+	"home-alarm-bot/internal/sensors"
+	"home-alarm-bot/internal/state"
+)
+
+// HomeAssistant announces the alarm through Home Assistant's MQTT discovery:
+// an alarm_control_panel entity, a motion binary_sensor per zone and a
+// connectivity binary_sensor per sensor and camera. Arming and disarming
+// from HA go through the bridge's command path, with the code typed in HA
+// checked against Config.HACodes.
+//
+// HA cannot sign commands, so the code travels in clear on
+// <prefix>/ha/command and anyone who can read that topic, or #, learns it
+// and can replay it. The broker's ACLs are the real boundary: only HA may
+// publish to the topic, and only HA and the bot may read it. The code itself
+// is never published; discovery asks HA to prompt for it (REMOTE_CODE).
+// With no codes configured every HA command is refused. A code grants what
+// an operator may do from Telegram, arm and disarm, which is all the panel
+// entity offers; see Config.HACodes.
+type HomeAssistant struct {
+	b         *Bridge
+	discovery string
+	node      string
+	reg       *sensors.Registry
+
+	mu        sync.Mutex
+	mode      alarm.ArmMode
+	triggered bool
+	announced map[string]bool // discovery topics sent this session
+}
+
+// zoneOffDelay is how long, in seconds, a zone stays "detected" in HA after
+// its last event.
+const zoneOffDelay = 60
+
+// HomeAssistant returns the discovery integration for b. discovery is HA's
+// discovery prefix ("homeassistant" if empty); reg, which may be nil,
+// supplies the zones and sensors known at startup.
+func (b *Bridge) HomeAssistant(discovery string, reg *sensors.Registry) *HomeAssistant {
+	if discovery == "" {
+		discovery = "homeassistant"
+	}
+	return &HomeAssistant{
+		b:         b,
+		discovery: strings.TrimRight(discovery, "/"),
+		node:      slug(b.cfg.Prefix),
+		reg:       reg,
+		announced: make(map[string]bool),
+	}
+}
+
+// topic returns the bridge's HA-specific topics.
+func (h *HomeAssistant) topic(parts ...string) string {
+	return h.b.cfg.Prefix + "/ha/" + strings.Join(parts, "/")
+}
+
+// Start subscribes to HA's commands and announces every entity, again after
+// each reconnection since the broker may have lost retained messages.
+func (h *HomeAssistant) Start(ctx context.Context) error {
+	if err := h.b.c.Subscribe(ctx, h.topic("command"), 1, h.handleCommand); err != nil {
+		return err
+	}
+	h.b.store.OnChange(h.stateChanged)
+	h.b.store.OnRecord(h.recorded)
+	h.b.c.OnConnect(func() {
+		h.mu.Lock()
+		clear(h.announced)
+		h.mu.Unlock()
+		h.announceAll()
+	})
+	return nil
+}
+
+func (h *HomeAssistant) announceAll() {
+	h.announcePanel()
+	if h.reg != nil {
+		for _, z := range h.reg.Zones() {
+			h.announceZone(z)
+		}
+		for _, s := range h.reg.List() {
+			h.announceDevice(s.ID)
+			if s.Offline {
+				h.connectivity(s.ID, false)
+			}
+		}
+	}
+	h.publishState()
+}
+
+// device groups every entity under one HA device.
+func (h *HomeAssistant) device() map[string]any {
+	return map[string]any{
+		"identifiers":  []string{h.node},
+		"name":         "Home alarm bot",
+		"manufacturer": "home-alarm-bot",
+	}
+}
+
+// announce publishes a retained discovery config once per session.
+func (h *HomeAssistant) announce(component, object string, cfg map[string]any) {
+	topic := h.discovery + "/" + component + "/" + h.node + "/" + object + "/config"
+	h.mu.Lock()
+	seen := h.announced[topic]
+	h.announced[topic] = true
+	h.mu.Unlock()
+	if seen {
+		return
+	}
+	cfg["device"] = h.device()
+	cfg["availability_topic"] = h.b.cfg.Topics.Availability
+	payload, _ := json.Marshal(cfg)
+	h.b.Publish(mqtt.Message{Topic: topic, Payload: payload, QoS: 1, Retain: true})
+}
+
+func (h *HomeAssistant) announcePanel() {
+	h.announce("alarm_control_panel", "panel", map[string]any{
+		"name":                 "Alarm",
+		"unique_id":            h.node + "_panel",
+		"state_topic":          h.topic("state"),
+		"command_topic":        h.topic("command"),
+		"command_template":     `{"action":"{{ action }}","code":"{{ code }}"}`,
+		"code":                 "REMOTE_CODE",
+		"code_arm_required":    true,
+		"code_disarm_required": true,
+		"supported_features":   []string{"arm_home", "arm_away", "arm_night"},
+	})
+}
+
+func (h *HomeAssistant) announceZone(zone string) {
+	h.announce("binary_sensor", "zone_"+slug(zone), map[string]any{
+		"name":         "Zone " + zone,
+		"unique_id":    h.node + "_zone_" + slug(zone),
+		"state_topic":  h.topic("zone", slug(zone)),
+		"device_class": "motion",
+		"off_delay":    zoneOffDelay,
+	})
+}
+
+func (h *HomeAssistant) announceDevice(id string) {
+	h.announce("binary_sensor", "dev_"+slug(id), map[string]any{
+		"name":            id + " connectivity",
+		"unique_id":       h.node + "_dev_" + slug(id),
+		"state_topic":     h.topic("device", slug(id)),
+		"device_class":    "connectivity",
+		"entity_category": "diagnostic",
+	})
+}
+
+func (h *HomeAssistant) connectivity(id string, online bool) {
+	payload := "OFF"
+	if online {
+		payload = "ON"
+	}
+	h.b.Publish(mqtt.Message{Topic: h.topic("device", slug(id)), Payload: []byte(payload), QoS: 1, Retain: true})
+}
+
+// haState maps the store onto HA's alarm_control_panel states.
+func (h *HomeAssistant) haState() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case h.b.store.Get() != state.Armed:
+		return "disarmed"
+	case h.triggered:
+		return "triggered"
+	case h.mode == "":
+		return "armed_away"
+	default:
+		return "armed_" + string(h.mode)
+	}
+}
+
+func (h *HomeAssistant) publishState() {
+	h.b.Publish(mqtt.Message{Topic: h.topic("state"), Payload: []byte(h.haState()), QoS: 1, Retain: true})
+}
+
+func (h *HomeAssistant) stateChanged(_, _ state.AlarmState) {
+	h.mu.Lock()
+	h.mode, h.triggered = "", false
+	h.mu.Unlock()
+	h.publishState()
+}
+
+// trips are the sensor events that mark a zone as detected.
+var trips = map[string]bool{
+	string(sensors.DoorOpen):   true,
+	string(sensors.Motion):     true,
+	string(sensors.GlassBreak): true,
+	string(sensors.Tamper):     true,
+}
+
+func (h *HomeAssistant) recorded(ev state.Event) {
+	switch ev.Kind {
+	case "state":
+		if m := ev.Fields["mode"]; m != "" {
+			h.mu.Lock()
+			h.mode = alarm.ArmMode(m)
+			h.mu.Unlock()
+			h.publishState()
+		}
+	case "alarm", "incident":
+		if h.b.store.Get() == state.Armed {
+			h.mu.Lock()
+			h.triggered = true
+			h.mu.Unlock()
+			h.publishState()
+		}
+	case "sensor_offline":
+		h.announceDevice(ev.Fields["sensor_id"])
+		h.connectivity(ev.Fields["sensor_id"], false)
+		return
+	}
+
+	// Any sign of life from a sensor or camera; trips light up the zone.
+	id := ev.Fields["sensor_id"]
+	if id == "" {
+		id = ev.Fields["camera"]
+	}
+	if id != "" {
+		h.announceDevice(id)
+		h.connectivity(id, true)
+	}
+	zone := ev.Fields["zone"]
+	if zone != "" && (trips[ev.Fields["type"]] || ev.Kind == "video") {
+		h.announceZone(zone)
+		h.b.Publish(mqtt.Message{Topic: h.topic("zone", slug(zone)), Payload: []byte("ON"), QoS: 1})
+	}
+}
+
+// haActions maps HA's command payloads onto bridge commands.
+var haActions = map[string]Command{
+	"ARM_AWAY":  {Action: "arm", Mode: alarm.ArmAway},
+	"ARM_HOME":  {Action: "arm", Mode: alarm.ArmHome},
+	"ARM_NIGHT": {Action: "arm", Mode: alarm.ArmNight},
+	"DISARM":    {Action: "disarm"},
+}
+
+func (h *HomeAssistant) handleCommand(m mqtt.Message) {
+	var in struct {
+		Action string `json:"action"`
+		Code   string `json:"code"`
+	}
+	if err := json.Unmarshal(m.Payload, &in); err != nil {
+		log.Printf("home assistant: bad command %q", m.Payload)
+		return
+	}
+	cmd, ok := haActions[in.Action]
+	if !ok {
+		log.Printf("home assistant: unsupported action %q", in.Action)
+		return
+	}
+	actor, ok := h.b.authorize(in.Code)
+	if !ok {
+		h.failed(in.Action, h.b.refuse(cmd, "Home Assistant", errors.New("bad code")))
+		return
+	}
+	queued := h.b.submit(func() {
+		if res := h.b.execute(cmd, "Home Assistant", actor); !res.OK {
+			h.failed(in.Action, res)
+		}
+	})
+	if !queued {
+		h.failed(in.Action, Result{Action: cmd.Action, Error: "command queue full"})
+	}
+}
+
+// failed logs res and puts HA's panel back to the real state.
+func (h *HomeAssistant) failed(action string, res Result) {
+	log.Printf("home assistant: %s: %s", action, res.Error)
+	h.publishState()
+}
+
+// slug turns a name into an identifier HA accepts in topics and IDs.
+func slug(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '_'
+		}
+	}, s)
+}
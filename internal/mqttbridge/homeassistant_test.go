@@ -0,0 +1,90 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"home-alarm-bot/internal/mqtt"
+	"home-alarm-bot/internal/sensors"
+	"home-alarm-bot/internal/state"
+	"home-alarm-bot/internal/testutil"
+)
+
+func TestHomeAssistant(t *testing.T) {
+	reg := sensors.NewRegistry([]sensors.Sensor{{ID: "Front Door", Zone: "hall"}}, true)
+	broker, ha, st, _ := start(t, Config{Prefix: "alarm", HACodes: map[string]string{"4321": "hass"}}, func(b *Bridge) {
+		if err := b.HomeAssistant("", reg).Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	ctx := context.Background()
+
+	var panel map[string]any
+	testutil.WaitFor(t, "panel discovery", func() bool {
+		m, ok := broker.Retained("homeassistant/alarm_control_panel/alarm/panel/config")
+		return ok && json.Unmarshal(m.Payload, &panel) == nil
+	})
+	if panel["command_topic"] != "alarm/ha/command" || panel["availability_topic"] != "alarm/availability" || panel["code"] != "REMOTE_CODE" {
+		t.Fatalf("panel config = %v", panel)
+	}
+	if m, _ := broker.Retained("homeassistant/alarm_control_panel/alarm/panel/config"); strings.Contains(string(m.Payload), "4321") {
+		t.Fatal("discovery config publishes the code")
+	}
+	for _, topic := range []string{
+		"homeassistant/binary_sensor/alarm/zone_hall/config",
+		"homeassistant/binary_sensor/alarm/dev_front_door/config",
+	} {
+		testutil.WaitFor(t, topic, func() bool { _, ok := broker.Retained(topic); return ok })
+	}
+	testutil.WaitFor(t, "disarmed", func() bool { return retained(broker, "alarm/ha/state") == "disarmed" })
+
+	command := func(payload string) {
+		_ = ha.Publish(ctx, mqtt.Message{Topic: "alarm/ha/command", Payload: []byte(payload), QoS: 1})
+	}
+
+	// A wrong code is refused like any unauthorised MQTT command.
+	command(`{"action":"ARM_NIGHT","code":"0000"}`)
+	testutil.WaitFor(t, "refusal", func() bool { h := st.History(1); return len(h) == 1 && h[0].Kind == "auth" })
+	if st.Get() != state.Disarmed {
+		t.Fatal("armed with a wrong code")
+	}
+
+	command(`{"action":"ARM_NIGHT","code":"4321"}`)
+	testutil.WaitFor(t, "armed_night", func() bool { return retained(broker, "alarm/ha/state") == "armed_night" })
+
+	// An incident while armed shows as triggered; a new zone and camera
+	// are announced on first sight.
+	zone := make(chan string, 1)
+	_ = ha.Subscribe(ctx, "alarm/ha/zone/+", 0, func(m mqtt.Message) { zone <- m.Topic + "=" + string(m.Payload) })
+	st.Record(state.Event{Kind: "incident", Fields: map[string]string{"type": "glass_break", "sensor_id": "k1", "zone": "Kitchen"}})
+	testutil.WaitFor(t, "triggered", func() bool { return retained(broker, "alarm/ha/state") == "triggered" })
+	if got := <-zone; got != "alarm/ha/zone/kitchen=ON" {
+		t.Fatalf("zone update = %s", got)
+	}
+	testutil.WaitFor(t, "kitchen discovery", func() bool {
+		_, ok := broker.Retained("homeassistant/binary_sensor/alarm/zone_kitchen/config")
+		return ok
+	})
+	if retained(broker, "alarm/ha/device/k1") != "ON" {
+		t.Fatal("sensor connectivity not published")
+	}
+
+	command(`{"action":"DISARM","code":"4321"}`)
+	testutil.WaitFor(t, "disarmed again", func() bool { return retained(broker, "alarm/ha/state") == "disarmed" })
+}
+
+func TestHomeAssistant_CommandLeavesDispatchFree(t *testing.T) {
+	broker, ha, _, _ := start(t, Config{Prefix: "alarm", HACodes: map[string]string{"4321": "hass"}}, pingOnReply, func(b *Bridge) {
+		if err := b.HomeAssistant("", nil).Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	ctx := context.Background()
+	testutil.WaitFor(t, "disarmed", func() bool { return retained(broker, "alarm/ha/state") == "disarmed" })
+
+	_ = ha.Publish(ctx, mqtt.Message{Topic: "alarm/ha/command", Payload: []byte(`{"action":"ARM_HOME","code":"4321"}`), QoS: 1})
+	_ = ha.Publish(ctx, mqtt.Message{Topic: "panel/reply", Payload: []byte("ok"), QoS: 1})
+	testutil.WaitFor(t, "armed_home", func() bool { return retained(broker, "alarm/ha/state") == "armed_home" })
+}
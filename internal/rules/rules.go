@@ -0,0 +1,187 @@
+package rules
+
+import (
+	"fmt"
+	"sync"
+
+	"home-alarm-bot/internal/sensors"
+	"home-alarm-bot/internal/state"
+)
+
+// Action is what to do with a sensor event.
+type Action string
+
+const (
+	// Log only records the event in the history.
+	Log Action = "log"
+	// Broadcast also tells every chat.
+	Broadcast Action = "broadcast"
+	// Incident records an incident and sends an alarm to every chat.
+	Incident Action = "incident"
+)
+
+// Rule matches events by type, zone and alarm state; empty lists match
+// anything.
+type Rule struct {
+	Types  []sensors.Type     `json:"types,omitempty"`
+	Zones  []string           `json:"zones,omitempty"`
+	States []state.AlarmState `json:"states,omitempty"`
+	Action Action             `json:"action"`
+}
+
+func (r Rule) matches(ev sensors.Event, st state.AlarmState) bool {
+	return contains(r.Types, ev.Type) && contains(r.Zones, ev.Zone) && contains(r.States, st)
+}
+
+func contains[T comparable](list []T, v T) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Engine picks the Action of the first matching rule, or Log.
+type Engine struct {
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// New validates rules and returns an Engine for them.
+func New(rules []Rule) (*Engine, error) {
+	if err := Validate(rules); err != nil {
+		return nil, err
+	}
+	return &Engine{rules: rules}, nil
+}
+
+// Validate checks that every rule has a known action.
+func Validate(rules []Rule) error {
+	for i, r := range rules {
+		switch r.Action {
+		case Log, Broadcast, Incident:
+		default:
+			return fmt.Errorf("rule %d: unknown action %q", i, r.Action)
+		}
+	}
+	return nil
+}
+
+// Replace validates rules and swaps them in; the engine keeps its old rules
+// if they are invalid. It is safe to call while events are being decided.
+func (e *Engine) Replace(rules []Rule) error {
+	if err := Validate(rules); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.rules = rules
+	e.mu.Unlock()
+	return nil
+}
+
+// Default returns the rules used when none are configured: glass breaks and
+// tampering are always incidents, doors and motion are incidents while armed,
+// power and battery problems are broadcast, and everything else is logged.
+func Default() []Rule {
+	return []Rule{
+		{Types: []sensors.Type{sensors.GlassBreak, sensors.Tamper}, Action: Incident},
+		{Types: []sensors.Type{sensors.DoorOpen, sensors.Motion}, States: []state.AlarmState{state.Armed}, Action: Incident},
+		{Types: []sensors.Type{sensors.PowerLoss, sensors.LowBattery}, Action: Broadcast},
+	}
+}
+
+// Decide returns the action for ev given the current alarm state.
+func (e *Engine) Decide(ev sensors.Event, st state.AlarmState) Action {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, r := range e.rules {
+		if r.matches(ev, st) {
+			return r.Action
+		}
+	}
+	return Log
+}
+
+// Notifier is where broadcasts and incidents are sent; *telegram.Bot
+// satisfies it.
+type Notifier interface {
+	Broadcast(msg string)
+}
+
+// Router records sensor events in the store and acts on the Engine's
+// decision. Events from bypassed zones are only logged.
+type Router struct {
+	engine *Engine
+	store  *state.Store
+	notify Notifier
+	reg    *sensors.Registry
+}
+
+// NewRouter wires an Engine to its outputs. reg may be nil, in which case
+// sensors are not tracked and nothing is bypassed.
+func NewRouter(e *Engine, store *state.Store, n Notifier, reg *sensors.Registry) *Router {
+	return &Router{engine: e, store: store, notify: n, reg: reg}
+}
+
+// Route handles one validated event and returns the action taken. It fails
+// only when the registry rejects an unknown sensor. Heartbeats update the
+// registry and announce a recovery, but are not recorded or ruled on.
+func (r *Router) Route(ev sensors.Event) (Action, error) {
+	action := Log
+	if r.reg != nil {
+		recovered, err := r.reg.Observe(&ev)
+		if err != nil {
+			return "", err
+		}
+		if recovered {
+			r.store.Record(state.Event{Kind: "sensor_online", Time: ev.Time, Text: ev.SensorID + " back online", Fields: ev.Fields()})
+			r.notify.Broadcast("✅ Sensor " + ev.SensorID + " is back online")
+		}
+	}
+	if ev.Type == sensors.Heartbeat {
+		return action, nil
+	}
+	if r.reg == nil || !r.reg.Bypassed(ev.Zone) {
+		action = r.engine.Decide(ev, r.store.Get())
+	}
+
+	fields := ev.Fields()
+	fields["action"] = string(action)
+	kind := "sensor"
+	if action == Incident {
+		kind = "incident"
+	}
+	r.store.Record(state.Event{Kind: kind, Time: ev.Time, Text: ev.Describe(), Fields: fields})
+
+	switch action {
+	case Incident:
+		r.notify.Broadcast("🚨 **INCIDENT**: " + ev.Describe())
+	case Broadcast:
+		r.notify.Broadcast("ℹ️ " + ev.Describe())
+	}
+	return action, nil
+}
+
+// Offline records and announces a sensor whose heartbeat lapsed; pass it to
+// sensors.Registry.Watch.
+func (r *Router) Offline(s sensors.Sensor) {
+	f := map[string]string{"sensor_id": s.ID}
+	if s.Zone != "" {
+		f["zone"] = s.Zone
+	}
+	r.store.Record(state.Event{Kind: "sensor_offline", Text: s.ID + " offline", Fields: f})
+	msg := "📴 Sensor " + s.ID
+	if s.Zone != "" {
+		msg += " (" + s.Zone + ")"
+	}
+	if s.LastSeen.IsZero() {
+		msg += " has not reported since startup"
+	} else {
+		msg += " offline, last seen " + s.LastSeen.Format("2006-01-02 15:04:05")
+	}
+	r.notify.Broadcast(msg)
+}
@@ -0,0 +1,138 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"home-alarm-bot/internal/sensors"
+	"home-alarm-bot/internal/state"
+)
+
+type recorder struct{ msgs []string }
+
+func (r *recorder) Broadcast(msg string) { r.msgs = append(r.msgs, msg) }
+
+func TestDefaultRules(t *testing.T) {
+	e, err := New(Default())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	cases := []struct {
+		typ  sensors.Type
+		st   state.AlarmState
+		want Action
+	}{
+		{sensors.GlassBreak, state.Disarmed, Incident},
+		{sensors.Tamper, state.Armed, Incident},
+		{sensors.DoorOpen, state.Armed, Incident},
+		{sensors.DoorOpen, state.Disarmed, Log},
+		{sensors.Motion, state.Disarmed, Log},
+		{sensors.LowBattery, state.Armed, Broadcast},
+		{sensors.PowerLoss, state.Disarmed, Broadcast},
+	}
+	for _, tc := range cases {
+		if got := e.Decide(sensors.Event{Type: tc.typ, SensorID: "s"}, tc.st); got != tc.want {
+			t.Errorf("Decide(%s, %s) = %s, want %s", tc.typ, tc.st, got, tc.want)
+		}
+	}
+}
+
+func TestRuleZonesAndValidation(t *testing.T) {
+	e, _ := New([]Rule{{Zones: []string{"garage"}, Action: Broadcast}})
+	if got := e.Decide(sensors.Event{Type: sensors.Motion, Zone: "garage"}, state.Disarmed); got != Broadcast {
+		t.Fatalf("garage motion = %s, want broadcast", got)
+	}
+	if got := e.Decide(sensors.Event{Type: sensors.Motion, Zone: "hall"}, state.Disarmed); got != Log {
+		t.Fatalf("hall motion = %s, want log", got)
+	}
+	if _, err := New([]Rule{{Action: "explode"}}); err == nil {
+		t.Fatal("expected error for unknown action")
+	}
+}
+
+func TestEngineReplace(t *testing.T) {
+	e, _ := New(Default())
+	if err := e.Replace([]Rule{{Action: "explode"}}); err == nil {
+		t.Fatal("expected error for unknown action")
+	}
+	if got := e.Decide(sensors.Event{Type: sensors.GlassBreak}, state.Disarmed); got != Incident {
+		t.Fatalf("after a rejected Replace glass break = %s, want incident", got)
+	}
+	if err := e.Replace([]Rule{{Action: Broadcast}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Decide(sensors.Event{Type: sensors.Motion}, state.Disarmed); got != Broadcast {
+		t.Fatalf("after Replace motion = %s, want broadcast", got)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	e, _ := New(Default())
+	st := state.New()
+	n := &recorder{}
+	r := NewRouter(e, st, n, nil)
+
+	if got, _ := r.Route(sensors.Event{Type: sensors.GlassBreak, SensorID: "k1", Zone: "kitchen"}); got != Incident {
+		t.Fatalf("Route = %s, want incident", got)
+	}
+	if len(n.msgs) != 1 || n.msgs[0] != "🚨 **INCIDENT**: glass break on k1 (kitchen)" {
+		t.Fatalf("broadcasts = %q", n.msgs)
+	}
+	r.Route(sensors.Event{Type: sensors.Motion, SensorID: "m1"})
+	if len(n.msgs) != 1 {
+		t.Fatalf("logged event should not broadcast")
+	}
+	h := st.History(0)
+	if len(h) != 2 || h[0].Kind != "incident" || h[1].Kind != "sensor" || h[1].Fields["action"] != "log" {
+		t.Fatalf("history = %+v", h)
+	}
+}
+
+func TestRouter_BypassedZoneOnlyLogs(t *testing.T) {
+	e, _ := New(Default())
+	st := state.New()
+	reg := sensors.NewRegistry([]sensors.Sensor{{ID: "g1", Zone: "garage"}}, false)
+	r := NewRouter(e, st, &recorder{}, reg)
+
+	if err := reg.SetBypass([]string{"garage"}); err != nil {
+		t.Fatalf("SetBypass: %v", err)
+	}
+	if got, err := r.Route(sensors.Event{Type: sensors.GlassBreak, SensorID: "g1"}); err != nil || got != Log {
+		t.Fatalf("bypassed glass break = %s, %v; want log", got, err)
+	}
+	if _, err := r.Route(sensors.Event{Type: sensors.Motion, SensorID: "nope"}); err == nil {
+		t.Fatal("unknown sensor should be rejected")
+	}
+}
+
+func TestRouter_OfflineAndRecovery(t *testing.T) {
+	e, _ := New(Default())
+	st := state.New()
+	n := &recorder{}
+	reg := sensors.NewRegistry([]sensors.Sensor{{ID: "cam", Zone: "porch"}}, false)
+	r := NewRouter(e, st, n, reg)
+
+	for _, s := range reg.Check(time.Now().Add(time.Hour)) {
+		t.Fatalf("sensor without heartbeat went offline: %+v", s)
+	}
+	r.Offline(sensors.Sensor{ID: "cam", Zone: "porch"})
+	if len(n.msgs) != 1 || !strings.Contains(n.msgs[0], "cam (porch)") {
+		t.Fatalf("offline broadcast = %q", n.msgs)
+	}
+
+	// Mark offline through the registry and let a heartbeat recover it.
+	cfg, _ := sensors.ParseSpec("cam2:porch:1s")
+	reg = sensors.NewRegistry(cfg, false)
+	r = NewRouter(e, st, n, reg)
+	reg.Check(time.Now().Add(time.Minute))
+	if act, err := r.Route(sensors.Event{Type: sensors.Heartbeat, SensorID: "cam2", Time: time.Now()}); err != nil || act != Log {
+		t.Fatalf("heartbeat Route = %s, %v", act, err)
+	}
+	if last := n.msgs[len(n.msgs)-1]; !strings.Contains(last, "back online") {
+		t.Fatalf("recovery broadcast = %q", last)
+	}
+	if h := st.History(1); h[0].Kind != "sensor_online" {
+		t.Fatalf("recovery not recorded: %+v", h)
+	}
+}
@@ -0,0 +1,196 @@
+// Package schedule arms and disarms the system at fixed times of day, e.g.
+// night mode at 23:00 on weekdays.
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"home-alarm-bot/internal/alarm"
+)
+
+// Entry is one scheduled command.
+type Entry struct {
+	// At is the local time of day, "HH:MM".
+	At string `json:"at"`
+	// Days limits the entry to some weekdays ("mon" … "sun"); empty means
+	// every day.
+	Days []string `json:"days,omitempty"`
+	// Action is "arm" or "disarm".
+	Action string `json:"action"`
+	// Mode is the arm mode; empty means away.
+	Mode alarm.ArmMode `json:"mode,omitempty"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Validate checks the time, days, action and mode of e.
+func (e Entry) Validate() error {
+	if _, _, err := e.clock(); err != nil {
+		return err
+	}
+	for _, d := range e.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("schedule %s: unknown day %q (want mon … sun)", e.At, d)
+		}
+	}
+	switch e.Action {
+	case "arm":
+		if _, err := alarm.ParseArmMode(string(e.Mode)); err != nil {
+			return fmt.Errorf("schedule %s: %w", e.At, err)
+		}
+	case "disarm":
+	default:
+		return fmt.Errorf("schedule %s: unknown action %q (want arm or disarm)", e.At, e.Action)
+	}
+	return nil
+}
+
+func (e Entry) clock() (hour, min int, err error) {
+	t, err := time.Parse("15:04", e.At)
+	if err != nil {
+		return 0, 0, fmt.Errorf("schedule %q: want HH:MM", e.At)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// Next returns the first time after t at which e fires, in t's location.
+func (e Entry) Next(t time.Time) time.Time {
+	h, m, err := e.clock()
+	if err != nil {
+		return time.Time{}
+	}
+	day := time.Date(t.Year(), t.Month(), t.Day(), h, m, 0, 0, t.Location())
+	for i := 0; i < 8; i++ {
+		at := day.AddDate(0, 0, i)
+		if at.After(t) && e.on(at.Weekday()) {
+			return at
+		}
+	}
+	return time.Time{}
+}
+
+func (e Entry) on(d time.Weekday) bool {
+	if len(e.Days) == 0 {
+		return true
+	}
+	for _, name := range e.Days {
+		if weekdays[strings.ToLower(name)] == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Commander carries out the scheduled commands; *telegram.Bot satisfies it.
+type Commander interface {
+	Arm(ctx context.Context, mode alarm.ArmMode, zones []string, source, actor string) error
+	Disarm(ctx context.Context, source, actor string) error
+	Broadcast(msg string)
+}
+
+// commandTimeout bounds the alarm server calls of one scheduled command.
+const commandTimeout = 30 * time.Second
+
+// Scheduler runs entries until its context ends. Entries can be replaced
+// while it runs.
+type Scheduler struct {
+	cmd Commander
+	now func() time.Time // a field so tests can move the clock
+
+	mu      sync.Mutex
+	entries []Entry
+	changed chan struct{}
+}
+
+func New(cmd Commander) *Scheduler {
+	return &Scheduler{cmd: cmd, now: time.Now, changed: make(chan struct{}, 1)}
+}
+
+// Set replaces the entries; they must already be valid.
+func (s *Scheduler) Set(entries []Entry) {
+	s.mu.Lock()
+	s.entries = entries
+	s.mu.Unlock()
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the entries due soonest after now and when.
+func (s *Scheduler) next(now time.Time) (time.Time, []Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var at time.Time
+	var due []Entry
+	for _, e := range s.entries {
+		n := e.Next(now)
+		switch {
+		case n.IsZero():
+		case at.IsZero() || n.Before(at):
+			at, due = n, []Entry{e}
+		case n.Equal(at):
+			due = append(due, e)
+		}
+	}
+	return at, due
+}
+
+// Run fires entries at their times until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		now := s.now()
+		at, due := s.next(now)
+		var wake <-chan time.Time
+		var t *time.Timer
+		if !at.IsZero() {
+			t = time.NewTimer(at.Sub(now))
+			wake = t.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-s.changed:
+		case <-wake:
+			for _, e := range due {
+				s.fire(ctx, e)
+			}
+		}
+		if t != nil {
+			t.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// fire carries out e and announces the result.
+func (s *Scheduler) fire(ctx context.Context, e Entry) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	actor := "schedule " + e.At
+	if e.Action == "disarm" {
+		if err := s.cmd.Disarm(ctx, "schedule", actor); err != nil {
+			log.Printf("schedule: disarm at %s: %v", e.At, err)
+			s.cmd.Broadcast(fmt.Sprintf("❌ Scheduled disarm at %s failed: %v", e.At, err))
+			return
+		}
+		s.cmd.Broadcast("🔓 System Disarmed (scheduled " + e.At + ")")
+		return
+	}
+	mode, _ := alarm.ParseArmMode(string(e.Mode))
+	if err := s.cmd.Arm(ctx, mode, nil, "schedule", actor); err != nil {
+		log.Printf("schedule: arm at %s: %v", e.At, err)
+		s.cmd.Broadcast(fmt.Sprintf("❌ Scheduled arm at %s failed: %v", e.At, err))
+		return
+	}
+	s.cmd.Broadcast(fmt.Sprintf("🔒 System Armed %s (scheduled %s)", mode, e.At))
+}
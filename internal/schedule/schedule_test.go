@@ -0,0 +1,134 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"home-alarm-bot/internal/alarm"
+)
+
+func TestEntryNext(t *testing.T) {
+	// 2026-10-16 is a Friday.
+	fri := time.Date(2026, 10, 16, 22, 0, 0, 0, time.UTC)
+	cases := []struct {
+		e    Entry
+		want time.Time
+	}{
+		{Entry{At: "23:00", Action: "arm"}, time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC)},
+		{Entry{At: "07:30", Action: "disarm"}, time.Date(2026, 10, 17, 7, 30, 0, 0, time.UTC)},
+		{Entry{At: "07:30", Days: []string{"mon", "Tue"}, Action: "disarm"}, time.Date(2026, 10, 19, 7, 30, 0, 0, time.UTC)},
+		{Entry{At: "22:00", Days: []string{"fri"}, Action: "arm"}, time.Date(2026, 10, 23, 22, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		if got := tc.e.Next(fri); !got.Equal(tc.want) {
+			t.Errorf("%+v.Next = %s, want %s", tc.e, got, tc.want)
+		}
+	}
+}
+
+func TestEntryValidate(t *testing.T) {
+	good := []Entry{{At: "23:00", Action: "arm", Mode: alarm.ArmNight}, {At: "7:05", Days: []string{"sat"}, Action: "disarm"}}
+	for _, e := range good {
+		if err := e.Validate(); err != nil {
+			t.Errorf("%+v: %v", e, err)
+		}
+	}
+	bad := []Entry{
+		{At: "25:00", Action: "arm"},
+		{At: "23:00", Action: "explode"},
+		{At: "23:00", Action: "arm", Mode: "party"},
+		{At: "23:00", Days: []string{"someday"}, Action: "arm"},
+	}
+	for _, e := range bad {
+		if err := e.Validate(); err == nil {
+			t.Errorf("%+v accepted", e)
+		}
+	}
+}
+
+type fakeCommander struct {
+	log []string
+}
+
+func (f *fakeCommander) Arm(_ context.Context, mode alarm.ArmMode, _ []string, source, actor string) error {
+	f.log = append(f.log, "arm "+string(mode)+" by "+actor)
+	return nil
+}
+
+func (f *fakeCommander) Disarm(_ context.Context, source, actor string) error {
+	f.log = append(f.log, "disarm by "+actor)
+	return nil
+}
+
+func (f *fakeCommander) Broadcast(msg string) { f.log = append(f.log, msg) }
+
+func TestSchedulerNextAndFire(t *testing.T) {
+	cmd := &fakeCommander{}
+	s := New(cmd)
+	s.Set([]Entry{
+		{At: "07:00", Action: "disarm"},
+		{At: "23:00", Action: "arm", Mode: alarm.ArmNight},
+		{At: "23:00", Days: []string{"sat"}, Action: "arm"},
+	})
+
+	// 2026-10-16 is a Friday.
+	at, due := s.next(time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local))
+	if at.Hour() != 23 || len(due) != 1 || due[0].Mode != alarm.ArmNight {
+		t.Fatalf("next = %s %+v", at, due)
+	}
+	at, due = s.next(time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local))
+	if at.Hour() != 23 || len(due) != 2 {
+		t.Fatalf("saturday next = %s %+v", at, due)
+	}
+
+	for _, e := range due {
+		s.fire(context.Background(), e)
+	}
+	want := []string{
+		"arm night by schedule 23:00", "🔒 System Armed night (scheduled 23:00)",
+		"arm away by schedule 23:00", "🔒 System Armed away (scheduled 23:00)",
+	}
+	if len(cmd.log) != len(want) {
+		t.Fatalf("log = %q", cmd.log)
+	}
+	for i := range want {
+		if cmd.log[i] != want[i] {
+			t.Fatalf("log = %q, want %q", cmd.log, want)
+		}
+	}
+}
+
+func TestSchedulerRunFiresOnce(t *testing.T) {
+	cmd := &fakeCommander{}
+	s := New(cmd)
+	// a clock that reaches 23:00 a moment after Run starts
+	start, base := time.Now(), time.Date(2026, 10, 16, 22, 59, 59, 900e6, time.Local)
+	s.now = func() time.Time { return base.Add(time.Since(start)) }
+	s.Set([]Entry{{At: "23:00", Action: "disarm"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { s.Run(ctx); close(done) }()
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	<-done
+
+	if len(cmd.log) != 2 || cmd.log[0] != "disarm by schedule 23:00" {
+		t.Fatalf("log = %q", cmd.log)
+	}
+}
+
+func TestSchedulerStops(t *testing.T) {
+	s := New(&fakeCommander{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { s.Run(ctx); close(done) }()
+	s.Set([]Entry{{At: "03:00", Action: "disarm"}})
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
@@ -0,0 +1,87 @@
+package sensors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Type is the kind of thing a sensor reports.
+type Type string
+
+const (
+	DoorOpen   Type = "door_open"
+	Motion     Type = "motion"
+	GlassBreak Type = "glass_break"
+	Tamper     Type = "tamper"
+	LowBattery Type = "low_battery"
+	PowerLoss  Type = "power_loss"
+	// Heartbeat only says "still alive"; it never reaches the rules.
+	Heartbeat Type = "heartbeat"
+)
+
+// Types lists every known event type.
+var Types = []Type{DoorOpen, Motion, GlassBreak, Tamper, LowBattery, PowerLoss, Heartbeat}
+
+// Event is one report from a sensor.
+type Event struct {
+	Type     Type      `json:"type"`
+	SensorID string    `json:"sensor_id"`
+	Zone     string    `json:"zone,omitempty"`
+	Time     time.Time `json:"time,omitempty"`
+	// Battery is the reported charge in percent, if the sensor sends one.
+	Battery *int `json:"battery,omitempty"`
+}
+
+// Validate checks the event is well formed and stamps Time if missing.
+func (e *Event) Validate() error {
+	known := false
+	for _, t := range Types {
+		if e.Type == t {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	if e.SensorID == "" {
+		return errors.New("sensor_id is required")
+	}
+	for name, v := range map[string]string{"sensor_id": e.SensorID, "zone": e.Zone} {
+		if len(v) > 64 {
+			return fmt.Errorf("%s: longer than 64 bytes", name)
+		}
+		if strings.IndexFunc(v, unicode.IsControl) >= 0 {
+			return fmt.Errorf("%s: contains control characters", name)
+		}
+	}
+	if e.Battery != nil && (*e.Battery < 0 || *e.Battery > 100) {
+		return fmt.Errorf("battery %d: want 0..100", *e.Battery)
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	return nil
+}
+
+// Describe renders the event for a human, e.g. "glass break on kitchen-1
+// (kitchen)".
+func (e Event) Describe() string {
+	s := strings.ReplaceAll(string(e.Type), "_", " ") + " on " + e.SensorID
+	if e.Zone != "" {
+		s += " (" + e.Zone + ")"
+	}
+	return s
+}
+
+// Fields flattens e for the state history.
+func (e Event) Fields() map[string]string {
+	f := map[string]string{"type": string(e.Type), "sensor_id": e.SensorID}
+	if e.Zone != "" {
+		f["zone"] = e.Zone
+	}
+	return f
+}
@@ -0,0 +1,26 @@
+package sensors
+
+import "testing"
+
+func TestEventValidate(t *testing.T) {
+	ev := Event{Type: DoorOpen, SensorID: "front-door", Zone: "hall"}
+	if err := ev.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if ev.Time.IsZero() {
+		t.Fatal("Validate should stamp Time")
+	}
+	if got := ev.Describe(); got != "door open on front-door (hall)" {
+		t.Fatalf("Describe = %q", got)
+	}
+
+	for name, bad := range map[string]Event{
+		"type":    {Type: "earthquake", SensorID: "s"},
+		"sensor":  {Type: Motion},
+		"control": {Type: Motion, SensorID: "s\n1"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
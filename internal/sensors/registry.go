@@ -0,0 +1,225 @@
+package sensors
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sensor is what the registry knows about one device.
+type Sensor struct {
+	ID       string    `json:"id"`
+	Zone     string    `json:"zone,omitempty"`
+	LastSeen time.Time `json:"last_seen,omitempty"`
+	Battery  int       `json:"battery"` // percent, -1 when unknown
+	State    Type      `json:"state,omitempty"`
+	// Heartbeat is the longest expected gap between reports; zero means the
+	// sensor is not watched for going offline.
+	Heartbeat time.Duration `json:"heartbeat,omitempty"`
+	Offline   bool          `json:"offline"`
+}
+
+// ErrUnknownSensor is returned for events from sensors that are neither
+// configured nor auto-registered.
+var ErrUnknownSensor = errors.New("unknown sensor")
+
+// Registry tracks the configured sensors, the zones they belong to and the
+// zones bypassed for the current arming.
+type Registry struct {
+	auto             bool
+	defaultHeartbeat time.Duration
+
+	started time.Time
+
+	mu       sync.RWMutex
+	sensors  map[string]*Sensor
+	bypassed map[string]bool
+}
+
+// NewRegistry starts with the configured sensors. With auto set, sensors
+// that first appear in an event are added on the fly.
+func NewRegistry(configured []Sensor, auto bool) *Registry {
+	r := &Registry{auto: auto, started: time.Now(), sensors: make(map[string]*Sensor), bypassed: make(map[string]bool)}
+	for _, s := range configured {
+		s := s
+		s.Battery = -1
+		r.sensors[s.ID] = &s
+	}
+	return r
+}
+
+// SetDefaultHeartbeat sets the heartbeat given to auto-registered sensors.
+func (r *Registry) SetDefaultHeartbeat(d time.Duration) {
+	r.mu.Lock()
+	r.defaultHeartbeat = d
+	r.mu.Unlock()
+}
+
+// ParseSpec reads a comma-separated list of id:zone:heartbeat entries, e.g.
+// "front-door:hall:10m,garage-pir:garage". Zone and heartbeat may be omitted.
+func ParseSpec(spec string) ([]Sensor, error) {
+	var out []Sensor
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if parts[0] == "" {
+			return nil, fmt.Errorf("sensor %q: empty id", entry)
+		}
+		s := Sensor{ID: parts[0]}
+		if len(parts) > 1 {
+			s.Zone = parts[1]
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			d, err := time.ParseDuration(parts[2])
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("sensor %q: bad heartbeat %q", entry, parts[2])
+			}
+			s.Heartbeat = d
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// Observe records ev against its sensor and fills in ev.Zone from the
+// registry when the event did not carry one. recovered is true when the
+// sensor had been marked offline. An event older than the last one seen does
+// not bring an offline sensor back.
+func (r *Registry) Observe(ev *Event) (recovered bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sensors[ev.SensorID]
+	if !ok {
+		if !r.auto {
+			return false, fmt.Errorf("%w %q", ErrUnknownSensor, ev.SensorID)
+		}
+		s = &Sensor{ID: ev.SensorID, Zone: ev.Zone, Battery: -1, Heartbeat: r.defaultHeartbeat}
+		r.sensors[s.ID] = s
+	}
+	if ev.Zone == "" {
+		ev.Zone = s.Zone
+	} else if s.Zone == "" {
+		s.Zone = ev.Zone
+	}
+	if ev.Time.After(s.LastSeen) {
+		s.LastSeen = ev.Time
+		recovered, s.Offline = s.Offline, false
+	}
+	if ev.Type != Heartbeat {
+		s.State = ev.Type
+	}
+	if ev.Battery != nil {
+		s.Battery = *ev.Battery
+	}
+	return recovered, nil
+}
+
+// Check marks sensors offline whose heartbeat has lapsed at now and returns
+// the ones that just went offline. Sensors that were never seen are timed
+// from when the registry was created.
+func (r *Registry) Check(now time.Time) []Sensor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Sensor
+	for _, s := range r.sensors {
+		if s.Heartbeat <= 0 || s.Offline {
+			continue
+		}
+		last := s.LastSeen
+		if last.IsZero() {
+			last = r.started
+		}
+		if now.Sub(last) > s.Heartbeat {
+			s.Offline = true
+			out = append(out, *s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Watch runs Check every tick and hands newly offline sensors to offline,
+// until stop is closed.
+func (r *Registry) Watch(tick time.Duration, stop <-chan struct{}, offline func(Sensor)) {
+	t := time.NewTicker(tick)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-t.C:
+			for _, s := range r.Check(now) {
+				offline(s)
+			}
+		}
+	}
+}
+
+// List returns a snapshot of every sensor, ordered by zone then ID.
+func (r *Registry) List() []Sensor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Sensor, 0, len(r.sensors))
+	for _, s := range r.sensors {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Zone != out[j].Zone {
+			return out[i].Zone < out[j].Zone
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Zones returns the distinct zones of all known sensors, sorted.
+func (r *Registry) Zones() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := map[string]bool{}
+	var out []string
+	for _, s := range r.sensors {
+		if s.Zone != "" && !seen[s.Zone] {
+			seen[s.Zone] = true
+			out = append(out, s.Zone)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SetBypass replaces the set of bypassed zones. Every zone must be known.
+// Pass nil to clear the bypass, e.g. on disarm.
+func (r *Registry) SetBypass(zones []string) error {
+	known := map[string]bool{}
+	for _, z := range r.Zones() {
+		known[z] = true
+	}
+	for _, z := range zones {
+		if !known[z] {
+			return fmt.Errorf("unknown zone %q", z)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bypassed = make(map[string]bool, len(zones))
+	for _, z := range zones {
+		r.bypassed[z] = true
+	}
+	return nil
+}
+
+// Bypassed reports whether zone is bypassed.
+func (r *Registry) Bypassed(zone string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.bypassed[zone]
+}
@@ -0,0 +1,107 @@
+package sensors
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistry_ObserveAndList(t *testing.T) {
+	cfg, err := ParseSpec("front-door:hall, garage-pir:garage")
+	if err != nil {
+		t.Fatalf("ParseSpec: %v", err)
+	}
+	r := NewRegistry(cfg, false)
+
+	batt := 40
+	ev := Event{Type: DoorOpen, SensorID: "front-door", Time: time.Unix(100, 0), Battery: &batt}
+	if _, err := r.Observe(&ev); err != nil {
+		t.Fatalf("Observe: %v", err)
+	}
+	if ev.Zone != "hall" {
+		t.Fatalf("zone not filled from registry: %q", ev.Zone)
+	}
+
+	unknown := Event{Type: Motion, SensorID: "attic"}
+	if _, err := r.Observe(&unknown); !errors.Is(err, ErrUnknownSensor) {
+		t.Fatalf("unknown sensor err = %v", err)
+	}
+
+	list := r.List()
+	if len(list) != 2 || list[0].ID != "garage-pir" || list[1].Battery != 40 || list[1].State != DoorOpen {
+		t.Fatalf("List = %+v", list)
+	}
+	if list[0].Battery != -1 || !list[0].LastSeen.IsZero() {
+		t.Fatalf("unseen sensor should have unknown battery: %+v", list[0])
+	}
+}
+
+func TestRegistry_AutoRegisterAndBypass(t *testing.T) {
+	r := NewRegistry(nil, true)
+	ev := Event{Type: Motion, SensorID: "pir-1", Zone: "garage"}
+	if _, err := r.Observe(&ev); err != nil {
+		t.Fatalf("Observe: %v", err)
+	}
+	if zones := r.Zones(); len(zones) != 1 || zones[0] != "garage" {
+		t.Fatalf("Zones = %v", zones)
+	}
+
+	if err := r.SetBypass([]string{"attic"}); err == nil {
+		t.Fatal("bypassing an unknown zone should fail")
+	}
+	if err := r.SetBypass([]string{"garage"}); err != nil || !r.Bypassed("garage") {
+		t.Fatalf("SetBypass: %v", err)
+	}
+	r.SetBypass(nil)
+	if r.Bypassed("garage") {
+		t.Fatal("bypass not cleared")
+	}
+}
+
+func TestRegistry_HeartbeatOfflineAndRecovery(t *testing.T) {
+	cfg, err := ParseSpec("cam-porch:front:1m,door:hall")
+	if err != nil || cfg[0].Heartbeat != time.Minute || cfg[1].Heartbeat != 0 {
+		t.Fatalf("ParseSpec = %+v, %v", cfg, err)
+	}
+	if _, err := ParseSpec("x:y:soon"); err == nil {
+		t.Fatal("bad heartbeat should fail")
+	}
+
+	r := NewRegistry(cfg, true)
+	r.SetDefaultHeartbeat(5 * time.Minute)
+	now := time.Now()
+
+	ev := Event{Type: Heartbeat, SensorID: "cam-porch", Time: now}
+	r.Observe(&ev)
+	if got := r.Check(now.Add(30 * time.Second)); len(got) != 0 {
+		t.Fatalf("sensor offline too early: %+v", got)
+	}
+	got := r.Check(now.Add(2 * time.Minute))
+	if len(got) != 1 || got[0].ID != "cam-porch" {
+		t.Fatalf("Check = %+v, want cam-porch offline", got)
+	}
+	if again := r.Check(now.Add(3 * time.Minute)); len(again) != 0 {
+		t.Fatalf("offline should be reported once, got %+v", again)
+	}
+
+	late := Event{Type: Heartbeat, SensorID: "cam-porch", Time: now.Add(-time.Minute)}
+	if recovered, _ := r.Observe(&late); recovered || !r.List()[0].Offline {
+		t.Fatalf("late event brought sensor back: %+v", r.List()[0])
+	}
+
+	ev = Event{Type: Heartbeat, SensorID: "cam-porch", Time: now.Add(4 * time.Minute)}
+	if recovered, _ := r.Observe(&ev); !recovered {
+		t.Fatal("expected recovery")
+	}
+	if r.List()[0].State != "" {
+		t.Fatalf("heartbeat must not change state: %+v", r.List()[0])
+	}
+
+	auto := Event{Type: Motion, SensorID: "new-pir", Time: now}
+	r.Observe(&auto)
+	for _, s := range r.List() {
+		if s.ID == "new-pir" && s.Heartbeat != 5*time.Minute {
+			t.Fatalf("auto-registered heartbeat = %s", s.Heartbeat)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package state
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 type AlarmState string
 
@@ -11,9 +14,33 @@ const (
 
 type Store struct {
 	sync.RWMutex
-	val AlarmState
+	val     AlarmState
+	version uint64 // counts Set calls; see CompareAndSet
+
+	// dispatch is held from each Set or Record until its hooks return, so
+	// hooks see changes and events in the order they happened.
+	dispatch sync.Mutex
+
+	nextID int64
+	events []Event
+
+	onChange []func(prev, cur AlarmState)
+	onRecord []func(Event)
 }
 
+// Event is one entry of the store's history: an alarm, a clip, a snapshot.
+// Fields carries free-form details such as the camera that fired.
+type Event struct {
+	ID     int64             `json:"id"`
+	Time   time.Time         `json:"time"`
+	Kind   string            `json:"kind"`
+	Text   string            `json:"text"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// historySize is how many events the store keeps.
+const historySize = 200
+
 func New() *Store { return &Store{val: Disarmed} }
 
 func (s *Store) Get() AlarmState {
@@ -23,7 +50,101 @@ func (s *Store) Get() AlarmState {
 }
 
 func (s *Store) Set(v AlarmState) {
+	s.dispatch.Lock()
+	defer s.dispatch.Unlock()
+	s.Lock()
+	prev := s.val
+	s.val = v
+	s.version++
+	hooks := s.onChange
+	s.Unlock()
+	if prev != v {
+		for _, f := range hooks {
+			f(prev, v)
+		}
+	}
+}
+
+// Version returns a number that grows with every Set, whether or not it
+// changed the state.
+func (s *Store) Version() uint64 {
+	s.RLock()
+	defer s.RUnlock()
+	return s.version
+}
+
+// CompareAndSet sets v like Set, but only if no Set has happened since
+// Version returned version. It returns the state before the call and
+// whether v was set. Use it to apply a state read from elsewhere without
+// overwriting a newer change.
+func (s *Store) CompareAndSet(version uint64, v AlarmState) (prev AlarmState, ok bool) {
+	s.dispatch.Lock()
+	defer s.dispatch.Unlock()
 	s.Lock()
+	prev = s.val
+	if s.version != version {
+		s.Unlock()
+		return prev, false
+	}
 	s.val = v
+	s.version++
+	hooks := s.onChange
 	s.Unlock()
+	if prev != v {
+		for _, f := range hooks {
+			f(prev, v)
+		}
+	}
+	return prev, true
+}
+
+// OnChange registers f to be called after every Set that changes the state.
+// Hooks run on the caller's goroutine, one change at a time and in order;
+// they must not block or call Set or Record.
+func (s *Store) OnChange(f func(prev, cur AlarmState)) {
+	s.Lock()
+	s.onChange = append(s.onChange, f)
+	s.Unlock()
+}
+
+// OnRecord registers f to be called with every recorded event, ID and Time
+// filled in. Hooks run like OnChange's, in ID order and in step with state
+// changes.
+func (s *Store) OnRecord(f func(Event)) {
+	s.Lock()
+	s.onRecord = append(s.onRecord, f)
+	s.Unlock()
+}
+
+// Record appends ev to the history, stamping its ID and, if unset, its Time.
+// The oldest events are dropped once historySize is reached.
+func (s *Store) Record(ev Event) Event {
+	s.dispatch.Lock()
+	defer s.dispatch.Unlock()
+	s.Lock()
+	s.nextID++
+	ev.ID = s.nextID
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	s.events = append(s.events, ev)
+	if len(s.events) > historySize {
+		s.events = s.events[len(s.events)-historySize:]
+	}
+	hooks := s.onRecord
+	s.Unlock()
+	for _, f := range hooks {
+		f(ev)
+	}
+	return ev
+}
+
+// History returns up to n of the most recent events, oldest first.
+func (s *Store) History(n int) []Event {
+	s.RLock()
+	defer s.RUnlock()
+	if n <= 0 || n > len(s.events) {
+		n = len(s.events)
+	}
+	return append([]Event(nil), s.events[len(s.events)-n:]...)
 }
@@ -1,6 +1,7 @@
 package state
 
 import (
+	"runtime"
 	"sync"
 	"testing"
 )
@@ -18,6 +19,18 @@ func TestStore_GetSet(t *testing.T) {
 	}
 }
 
+func TestStore_CompareAndSet(t *testing.T) {
+	s := New()
+	v := s.Version()
+	s.Set(Disarmed) // no change, still a newer Set
+	if prev, ok := s.CompareAndSet(v, Armed); ok || prev != Disarmed || s.Get() != Disarmed {
+		t.Fatalf("stale CompareAndSet applied: prev %s ok %v state %s", prev, ok, s.Get())
+	}
+	if prev, ok := s.CompareAndSet(s.Version(), Armed); !ok || prev != Disarmed || s.Get() != Armed {
+		t.Fatalf("CompareAndSet: prev %s ok %v state %s", prev, ok, s.Get())
+	}
+}
+
 // Extra assurance that the RWMutex really protects us.
 func TestStore_RaceSafety(t *testing.T) {
 	const n = 100
@@ -32,3 +45,83 @@ func TestStore_RaceSafety(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestStore_RecordHistory(t *testing.T) {
+	s := New()
+
+	for i := 0; i < historySize+5; i++ {
+		s.Record(Event{Kind: "video", Fields: map[string]string{"camera": "porch"}})
+	}
+
+	all := s.History(0)
+	if len(all) != historySize {
+		t.Fatalf("history length = %d, want %d", len(all), historySize)
+	}
+	last := s.History(2)
+	if len(last) != 2 || last[1].ID != historySize+5 || last[0].ID != historySize+4 {
+		t.Fatalf("unexpected tail: %+v", last)
+	}
+	if last[1].Time.IsZero() || last[1].Fields["camera"] != "porch" {
+		t.Fatalf("event not stamped or fields lost: %+v", last[1])
+	}
+}
+
+func TestStore_Hooks(t *testing.T) {
+	s := New()
+	var changes []string
+	var recorded []int64
+	s.OnChange(func(prev, cur AlarmState) { changes = append(changes, string(prev)+">"+string(cur)) })
+	s.OnRecord(func(ev Event) { recorded = append(recorded, ev.ID) })
+
+	s.Set(Armed)
+	s.Set(Armed) // no change, no hook
+	s.Set(Disarmed)
+	s.Record(Event{Kind: "alarm"})
+
+	if len(changes) != 2 || changes[0] != "DISARMED>ARMED" || changes[1] != "ARMED>DISARMED" {
+		t.Fatalf("changes = %v", changes)
+	}
+	if len(recorded) != 1 || recorded[0] != 1 {
+		t.Fatalf("recorded = %v", recorded)
+	}
+}
+
+// Concurrent writers must not deliver hooks out of order: the last change a
+// hook sees is the current state and events arrive in ID order.
+func TestStore_HooksOrderedUnderConcurrency(t *testing.T) {
+	s := New()
+	var changes []AlarmState
+	var ids []int64
+	s.OnChange(func(prev, cur AlarmState) {
+		runtime.Gosched() // widen the window between assignment and hook
+		if n := len(changes); n > 0 && changes[n-1] != prev {
+			t.Errorf("change %s>%s delivered after %s", prev, cur, changes[n-1])
+		}
+		changes = append(changes, cur)
+	})
+	s.OnRecord(func(ev Event) { runtime.Gosched(); ids = append(ids, ev.ID) })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				s.Set(Armed)
+			} else {
+				s.Set(Disarmed)
+			}
+			s.Record(Event{Kind: "state"})
+		}()
+	}
+	wg.Wait()
+
+	if len(changes) > 0 && changes[len(changes)-1] != s.Get() {
+		t.Fatalf("last hook saw %s, store is %s", changes[len(changes)-1], s.Get())
+	}
+	for i, id := range ids {
+		if id != int64(i+1) {
+			t.Fatalf("events delivered as %v", ids)
+		}
+	}
+}
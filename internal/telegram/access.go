@@ -0,0 +1,115 @@
+package telegram
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"home-alarm-bot/internal/state"
+)
+
+// Role is what a chat may ask the bot to do. Each role includes the ones
+// before it.
+type Role string
+
+const (
+	// Viewer may read state, history, sensors and clips.
+	Viewer Role = "viewer"
+	// Operator may also arm and disarm.
+	Operator Role = "operator"
+	// Admin may also change the PIN.
+	Admin Role = "admin"
+)
+
+var roleRank = map[Role]int{Viewer: 1, Operator: 2, Admin: 3}
+
+// ParseRole checks that s names a known role.
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if roleRank[r] == 0 {
+		return "", fmt.Errorf("unknown role %q (want viewer, operator or admin)", s)
+	}
+	return r, nil
+}
+
+// allows reports whether r includes need.
+func (r Role) allows(need Role) bool { return roleRank[r] >= roleRank[need] }
+
+// SetAccess limits the bot to the chats in acl, each with its role; messages
+// from other chats are dropped without a reply. With an empty acl every chat
+// is let in as Admin, as before allowlists existed.
+// Subscribed chats that lose access stop receiving broadcasts. It is safe to
+// call while updates are being handled.
+func (b *Bot) SetAccess(acl map[int64]Role) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.acl = acl
+	if len(acl) == 0 {
+		return
+	}
+	for id := range b.chats {
+		if _, ok := acl[id]; !ok {
+			delete(b.chats, id)
+		}
+	}
+}
+
+// role returns the role of chatID and whether it may use the bot at all.
+func (b *Bot) role(chatID int64) (Role, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.acl) == 0 {
+		return Admin, true
+	}
+	r, ok := b.acl[chatID]
+	return r, ok
+}
+
+// Owners returns the admin chats, sorted: those given Admin in the access
+// list, or every subscribed chat when there is none.
+func (b *Bot) Owners() []int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var out []int64
+	if len(b.acl) == 0 {
+		for id := range b.chats {
+			out = append(out, id)
+		}
+	}
+	for id, r := range b.acl {
+		if r == Admin {
+			out = append(out, id)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// NotifyOwners sends msg to every chat in Owners.
+func (b *Bot) NotifyOwners(msg string) {
+	for _, id := range b.Owners() {
+		countBroadcast(b.tg.SendMessage(id, msg))
+	}
+}
+
+// commandRole is the least role that may run cmd, as returned by
+// commandName.
+func commandRole(cmd string) Role {
+	switch cmd {
+	case "/arm", "/disarm":
+		return Operator
+	case "/change_pin":
+		return Admin
+	default:
+		return Viewer
+	}
+}
+
+// refuse records and answers a chat that asked for more than its role
+// allows. Only the command name is kept: its arguments may hold a PIN.
+func (b *Bot) refuse(chatID int64, cmd string) {
+	log.Printf("telegram: refused %s from chat %d: role does not allow it", cmd, chatID)
+	b.store.Record(state.Event{Kind: "auth", Text: "telegram role does not allow " + cmd,
+		Fields: map[string]string{"actor": chatActor(chatID), "command": cmd}})
+	_ = b.tg.SendMessage(chatID, "⛔ Your role does not allow "+cmd)
+}
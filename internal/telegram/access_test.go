@@ -0,0 +1,119 @@
+package telegram
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"home-alarm-bot/internal/state"
+)
+
+func TestBot_AccessAndRoles(t *testing.T) {
+	bot, rt, armCalls, st := newInstrumentedBot(t)
+	bot.SetAccess(map[int64]Role{2: Viewer, 3: Operator})
+
+	lastReply := func() string {
+		t.Helper()
+		raw, _ := io.ReadAll(rt.reqs[len(rt.reqs)-1].Body)
+		vals, _ := url.ParseQuery(string(raw))
+		return vals.Get("text")
+	}
+
+	if got := bot.Chats(); len(got) != 0 {
+		t.Fatalf("chat 1 still subscribed after losing access: %v", got)
+	}
+
+	bot.Handle(Update{Message: &Message{Text: "/status", Chat: Chat{ID: 9}}})
+	if len(rt.reqs) != 0 || len(st.History(10)) != 0 || len(bot.Chats()) != 0 {
+		t.Fatalf("unknown chat: %d replies, history %+v, chats %v", len(rt.reqs), st.History(10), bot.Chats())
+	}
+
+	bot.Handle(Update{Message: &Message{Text: "/arm", Chat: Chat{ID: 2}}})
+	if !strings.Contains(lastReply(), "role does not allow") || *armCalls != 0 {
+		t.Fatalf("viewer /arm: %q, %d arm calls", lastReply(), *armCalls)
+	}
+	if h := st.History(1); len(h) != 1 || h[0].Kind != "auth" || h[0].Fields["actor"] != "chat 2" || h[0].Fields["command"] != "/arm" {
+		t.Fatalf("refusal not recorded: %+v", h)
+	}
+
+	bot.Handle(Update{Message: &Message{Text: "/arm", Chat: Chat{ID: 3}}})
+	if st.Get() != state.Armed || *armCalls != 1 {
+		t.Fatalf("operator /arm: state %s, %d arm calls", st.Get(), *armCalls)
+	}
+	bot.Handle(Update{Message: &Message{Text: "/change_pin 9999", Chat: Chat{ID: 3}}})
+	if !strings.Contains(lastReply(), "role does not allow") {
+		t.Fatalf("operator /change_pin: %q", lastReply())
+	}
+
+	if got := bot.Chats(); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Fatalf("subscribed chats = %v", got)
+	}
+}
+
+// TestBot_RoleCheckUsesDispatchedCommand sends /change_pin in the forms
+// Telegram delivers besides "/change_pin 1234"; each must be refused, and
+// the PIN must stay out of the history.
+func TestBot_RoleCheckUsesDispatchedCommand(t *testing.T) {
+	bot, rt, _, st := newInstrumentedBot(t)
+	bot.SetAccess(map[int64]Role{2: Viewer})
+
+	for _, txt := range []string{"/change_pin 5555", "/change_pin\t5555", "/change_pin@home_bot 5555", "/change_pin@home_bot\n5555"} {
+		rt.reqs = nil
+		bot.Handle(Update{Message: &Message{Text: txt, Chat: Chat{ID: 2}}})
+		if len(rt.reqs) != 1 {
+			t.Fatalf("%q: %d replies", txt, len(rt.reqs))
+		}
+		raw, _ := io.ReadAll(rt.reqs[0].Body)
+		vals, _ := url.ParseQuery(string(raw))
+		if got := vals.Get("text"); got != "⛔ Your role does not allow /change_pin" {
+			t.Errorf("%q: reply %q", txt, got)
+		}
+	}
+	for _, e := range st.History(10) {
+		if strings.Contains(fmt.Sprint(e), "5555") {
+			t.Fatalf("PIN recorded: %+v", e)
+		}
+	}
+}
+
+func TestCommandName(t *testing.T) {
+	for txt, want := range map[string]string{
+		"/arm":                "/arm",
+		"/arm night":          "/arm",
+		"/arm@home_bot night": "/arm",
+		"/disarm\tnow":        "/disarm",
+		"  ":                  "",
+	} {
+		if got := commandName(txt); got != want {
+			t.Errorf("commandName(%q) = %q, want %q", txt, got, want)
+		}
+	}
+}
+
+func TestBot_NotifyOwners(t *testing.T) {
+	bot, rt, _, _ := newInstrumentedBot(t)
+	sentTo := func() []string {
+		var out []string
+		for _, r := range rt.reqs {
+			raw, _ := io.ReadAll(r.Body)
+			vals, _ := url.ParseQuery(string(raw))
+			out = append(out, vals.Get("chat_id"))
+		}
+		rt.reqs = nil
+		return out
+	}
+
+	// Without an access list every subscribed chat is an owner.
+	bot.NotifyOwners("going offline")
+	if got := strings.Join(sentTo(), ","); got != "1" {
+		t.Fatalf("notice sent to %s, want 1", got)
+	}
+
+	bot.SetAccess(map[int64]Role{7: Admin, 3: Operator, 5: Admin})
+	bot.NotifyOwners("going offline")
+	if got := strings.Join(sentTo(), ","); got != "5,7" {
+		t.Fatalf("notice sent to %s, want 5,7", got)
+	}
+}
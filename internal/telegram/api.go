@@ -2,15 +2,47 @@ package telegram
 
 
 import (
-	"bytes"          
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
+
+	"home-alarm-bot/internal/metrics"
+)
+
+var (
+	apiCalls = metrics.NewCounter("telegram_api_requests_total",
+		"Telegram Bot API calls by method and result (ok or error).", "method", "result")
+	apiLatency = metrics.NewHistogram("telegram_api_request_duration_seconds",
+		"Telegram Bot API call latency; getUpdates long-polls for up to 60s.",
+		[]float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 90}, "method")
 )
 
+// observe records the outcome of one Bot API call for /metrics. Use it as
+// defer observe("sendMessage", time.Now(), &err).
+func observe(method string, start time.Time, err *error) {
+	apiLatency.Since(start, method)
+	result := "ok"
+	if *err != nil {
+		result = "error"
+	}
+	apiCalls.Inc(method, result)
+}
+
+// checkStatus turns a non-2xx Bot API response into an error.
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("telegram returned %s", resp.Status)
+	}
+	return nil
+}
+
 type API struct {
 	token  string
 	client *http.Client
@@ -28,11 +60,18 @@ func (t *API) endpoint(method string) string {
 }
 
 // GET https://api.telegram.org/bot<TOKEN>/getUpdates?offset=…
-func (t *API) GetUpdates(offset int) ([]Update, error) {
+//
+// The long poll is abandoned when ctx is done.
+func (t *API) GetUpdates(ctx context.Context, offset int) (_ []Update, err error) {
+	defer observe("getUpdates", time.Now(), &err)
 	v := url.Values{}
 	v.Set("offset", fmt.Sprint(offset))
 	v.Set("timeout", "60")
-	resp, err := t.client.Get(t.endpoint("getUpdates") + "?" + v.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.endpoint("getUpdates")+"?"+v.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -48,8 +87,37 @@ func (t *API) GetUpdates(offset int) ([]Update, error) {
 	return r.Result, nil
 }
 
+// GetMe returns the bot's own account; it is a cheap way to check that the
+// Bot API is reachable and the token valid.
+func (t *API) GetMe(ctx context.Context) (_ User, err error) {
+	defer observe("getMe", time.Now(), &err)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.endpoint("getMe"), nil)
+	if err != nil {
+		return User{}, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return User{}, err
+	}
+	defer resp.Body.Close()
+
+	var r struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+		Result      User   `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return User{}, err
+	}
+	if !r.Ok {
+		return User{}, fmt.Errorf("telegram returned %s: %s", resp.Status, r.Description)
+	}
+	return r.Result, nil
+}
+
 // POST https://api.telegram.org/bot<TOKEN>/sendMessage
-func (t *API) SendMessage(chatID int64, text string) error {
+func (t *API) SendMessage(chatID int64, text string) (err error) {
+	defer observe("sendMessage", time.Now(), &err)
 	payload := url.Values{}
 	payload.Set("chat_id", fmt.Sprint(chatID))
 	payload.Set("text", text)
@@ -62,49 +130,386 @@ func (t *API) SendMessage(chatID int64, text string) error {
 	var pr struct {
 		Ok bool `json:"ok"`
 	}
-	return json.NewDecoder(resp.Body).Decode(&pr)
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+		return err
+	}
+	if !pr.Ok {
+		return fmt.Errorf("telegram returned %s", resp.Status)
+	}
+	return nil
 }
 
-func (a *API) SendVideo(chatID int64, file []byte, caption string) error {
-    var body bytes.Buffer
-    mw := multipart.NewWriter(&body)
+// SendMessageKeyboard sends text with an inline keyboard, one row per
+// element of rows.
+func (t *API) SendMessageKeyboard(chatID int64, text string, rows [][]InlineButton) (err error) {
+	defer observe("sendMessage", time.Now(), &err)
+	markup, err := json.Marshal(struct {
+		InlineKeyboard [][]InlineButton `json:"inline_keyboard"`
+	}{rows})
+	if err != nil {
+		return err
+	}
+	payload := url.Values{}
+	payload.Set("chat_id", fmt.Sprint(chatID))
+	payload.Set("text", text)
+	payload.Set("reply_markup", string(markup))
+	resp, err := t.client.PostForm(t.endpoint("sendMessage"), payload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return checkStatus(resp)
+}
 
-    _ = mw.WriteField("chat_id", fmt.Sprint(chatID))
-    _ = mw.WriteField("caption", caption)
+// AnswerCallbackQuery acknowledges a button press, optionally showing text
+// as a short notification.
+func (t *API) AnswerCallbackQuery(id, text string) (err error) {
+	defer observe("answerCallbackQuery", time.Now(), &err)
+	payload := url.Values{}
+	payload.Set("callback_query_id", id)
+	payload.Set("text", text)
+	resp, err := t.client.PostForm(t.endpoint("answerCallbackQuery"), payload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return checkStatus(resp)
+}
+
+// formFile is one file part of a multipart upload.
+type formFile struct {
+	field, name string
+	r           io.Reader
+}
 
-    fw, _ := mw.CreateFormFile("video", "alarm.mp4")
-    _, _ = fw.Write(file)
-    mw.Close()
+// uploadTimeout bounds one upload, response included: long enough for a
+// clip at Telegram's 50 MB limit over a slow uplink, short enough that a
+// stalled connection does not hold up the broadcast for good.
+const uploadTimeout = 10 * time.Minute
 
-	req, _ := http.NewRequest("POST", a.endpoint("sendVideo"), &body)
+// sendTimeout bounds a call that only posts form fields.
+const sendTimeout = 30 * time.Second
 
-    req.Header.Set("Content-Type", mw.FormDataContentType())
+// upload POSTs fields and files to method as multipart/form-data and decodes
+// the reply's result into result. The body is streamed through a pipe
+// rather than built in memory, so each reader is read exactly once.
+func (a *API) upload(method string, fields url.Values, files []formFile, result any) (err error) {
+	defer observe(method, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
 
-    resp, err := http.DefaultClient.Do(req)
-    if err != nil {
-        return err
-    }
-    defer resp.Body.Close()
+	go func() {
+		var err error
+		for k, vs := range fields {
+			for _, v := range vs {
+				if err == nil {
+					err = mw.WriteField(k, v)
+				}
+			}
+		}
+		for _, f := range files {
+			if err != nil {
+				break
+			}
+			var fw io.Writer
+			if fw, err = mw.CreateFormFile(f.field, f.name); err == nil {
+				_, err = io.Copy(fw, f.r)
+			}
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
 
-    if resp.StatusCode >= 400 {
-        return fmt.Errorf("telegram returned %s", resp.Status)
-    }
-    return nil
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint(method), pr)
+	if err != nil {
+		pr.CloseWithError(err) // unblock the writer goroutine
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	return decodeResult(resp, result)
 }
 
+// postForm POSTs url-encoded fields to method; used for re-sending media by
+// file_id.
+func (a *API) postForm(method string, fields url.Values) (err error) {
+	defer observe(method, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint(method), strings.NewReader(fields.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return decodeResult(resp, nil)
+}
+
+// decodeResult checks resp's status, decodes the result field of its body
+// into result if result is not nil, and closes the body. A reply without a
+// result leaves result as it was.
+func decodeResult(resp *http.Response, result any) error {
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	if result != nil {
+		_ = json.NewDecoder(resp.Body).Decode(&struct {
+			Result any `json:"result"`
+		}{result})
+	}
+	return nil
+}
+
+// SendVideo uploads the clip read from r to chatID and returns the file_id
+// Telegram assigned to it, so the same clip can be re-sent without another
+// upload.
+func (a *API) SendVideo(chatID int64, r io.Reader, caption string) (string, error) {
+	fields := url.Values{}
+	fields.Set("chat_id", fmt.Sprint(chatID))
+	fields.Set("caption", caption)
+
+	var m sentMessage
+	if err := a.upload("sendVideo", fields, []formFile{{"video", "alarm.mp4", r}}, &m); err != nil {
+		return "", err
+	}
+	return m.fileID(), nil
+}
+
+// SendVideoFileID re-sends a video that was already uploaded, by file_id.
+func (a *API) SendVideoFileID(chatID int64, fileID, caption string) error {
+	fields := url.Values{}
+	fields.Set("chat_id", fmt.Sprint(chatID))
+	fields.Set("video", fileID)
+	fields.Set("caption", caption)
+
+	return a.postForm("sendVideo", fields)
+}
+
+// SendPhoto uploads the image read from r to chatID and returns the file_id
+// of its largest size.
+func (a *API) SendPhoto(chatID int64, r io.Reader, caption string) (string, error) {
+	fields := url.Values{}
+	fields.Set("chat_id", fmt.Sprint(chatID))
+	fields.Set("caption", caption)
+
+	var m sentMessage
+	if err := a.upload("sendPhoto", fields, []formFile{{"photo", "snapshot.jpg", r}}, &m); err != nil {
+		return "", err
+	}
+	return m.fileID(), nil
+}
+
+// SendPhotoFileID re-sends a photo that was already uploaded, by file_id.
+func (a *API) SendPhotoFileID(chatID int64, fileID, caption string) error {
+	fields := url.Values{}
+	fields.Set("chat_id", fmt.Sprint(chatID))
+	fields.Set("photo", fileID)
+	fields.Set("caption", caption)
+
+	return a.postForm("sendPhoto", fields)
+}
+
+// SendDocument uploads r to chatID as a file called name and returns its
+// file_id.
+func (a *API) SendDocument(chatID int64, r io.Reader, name, caption string) (string, error) {
+	fields := url.Values{}
+	fields.Set("chat_id", fmt.Sprint(chatID))
+	fields.Set("caption", caption)
+
+	var m sentMessage
+	if err := a.upload("sendDocument", fields, []formFile{{"document", name, r}}, &m); err != nil {
+		return "", err
+	}
+	return m.fileID(), nil
+}
+
+// SendDocumentFileID re-sends a document that was already uploaded, by file_id.
+func (a *API) SendDocumentFileID(chatID int64, fileID, caption string) error {
+	fields := url.Values{}
+	fields.Set("chat_id", fmt.Sprint(chatID))
+	fields.Set("document", fileID)
+	fields.Set("caption", caption)
+
+	return a.postForm("sendDocument", fields)
+}
+
+// SendMediaGroup sends media as a single album (2–10 items). The caption is
+// attached to the first item, which is how Telegram shows an album caption.
+// Items with a FileID are sent by reference, the rest are uploaded. The
+// returned file_ids are in album order; entries may be empty if Telegram did
+// not report one.
+func (a *API) SendMediaGroup(chatID int64, media []InputMedia, caption string) ([]string, error) {
+	type inputMedia struct {
+		Type    string `json:"type"`
+		Media   string `json:"media"`
+		Caption string `json:"caption,omitempty"`
+	}
+	items := make([]inputMedia, len(media))
+	var files []formFile
+	for i, m := range media {
+		items[i] = inputMedia{Type: m.Type, Media: m.FileID}
+		if m.FileID == "" {
+			name := fmt.Sprintf("file%d", i)
+			items[i].Media = "attach://" + name
+			files = append(files, formFile{name, name, m.File})
+		}
+	}
+	if len(items) > 0 {
+		items[0].Caption = caption
+	}
+	raw, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := url.Values{}
+	fields.Set("chat_id", fmt.Sprint(chatID))
+	fields.Set("media", string(raw))
+
+	var sent []sentMessage
+	if err := a.upload("sendMediaGroup", fields, files, &sent); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(sent))
+	for i, m := range sent {
+		ids[i] = m.fileID()
+	}
+	return ids, nil
+}
+
+// BroadcastVideo uploads the clip once to the first chat and then sends it to
+// every other chat by the returned file_id. The clip is streamed, never held
+// in memory as a whole. If Telegram did not hand back a file_id and r can be
+// rewound, the next chat gets a fresh upload instead.
 func (b *Bot) BroadcastVideo(r io.Reader, caption string) error {
-    buf, err := io.ReadAll(r)
-    if err != nil {
-        return err
-    }
-
-    b.mu.RLock()
-    defer b.mu.RUnlock()
-
-    for id := range b.chats {
-        if err := b.tg.SendVideo(id, buf, caption); err != nil {
-            return err
-        }
-    }
-    return nil
-}
\ No newline at end of file
+	return b.broadcastUpload(r,
+		func(id int64) (string, error) { return b.tg.SendVideo(id, r, caption) },
+		func(id int64, fid string) error { return b.tg.SendVideoFileID(id, fid, caption) })
+}
+
+// BroadcastDocument sends r as a plain file named name to every chat, for
+// clips Telegram would not play inline.
+func (b *Bot) BroadcastDocument(r io.Reader, name, caption string) error {
+	return b.broadcastUpload(r,
+		func(id int64) (string, error) { return b.tg.SendDocument(id, r, name, caption) },
+		func(id int64, fid string) error { return b.tg.SendDocumentFileID(id, fid, caption) })
+}
+
+// broadcastUpload runs upload for the first chat and resend with the returned
+// file_id for the rest, rewinding r for another upload when no file_id came
+// back.
+func (b *Bot) broadcastUpload(r io.Reader, upload func(int64) (string, error), resend func(int64, string) error) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var fileID string
+	uploaded := false
+	for id := range b.chats {
+		if fileID != "" {
+			err := resend(id, fileID)
+			countBroadcast(err)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if uploaded {
+			if err := rewind(r); err != nil {
+				return err
+			}
+		}
+		fid, err := upload(id)
+		countBroadcast(err)
+		if err != nil {
+			return err
+		}
+		fileID, uploaded = fid, true
+	}
+	return nil
+}
+
+// BroadcastPhotos sends one or more images to every chat: a single image as a
+// photo, several as albums of up to ten. Albums are balanced in size, since
+// Telegram rejects an album of one (11 photos go out as 5 and 6). Like
+// BroadcastVideo, the images are uploaded once and re-sent to the remaining
+// chats by file_id.
+func (b *Bot) BroadcastPhotos(photos []io.Reader, caption string) error {
+	if len(photos) == 0 {
+		return errors.New("no photos to send")
+	}
+	if len(photos) == 1 {
+		return b.broadcastPhoto(photos[0], caption)
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	albums := (len(photos) + maxMediaGroup - 1) / maxMediaGroup
+	for k, start := 0, 0; k < albums; k++ {
+		end := start + (len(photos)-start)/(albums-k)
+		batch := photos[start:end]
+		c := caption
+		if start > 0 {
+			c = "" // caption the first album only
+		}
+
+		var fileIDs []string
+		uploaded := false
+		for id := range b.chats {
+			media := make([]InputMedia, len(batch))
+			for i, p := range batch {
+				media[i] = InputMedia{Type: "photo", File: p}
+				if len(fileIDs) == len(batch) && fileIDs[i] != "" {
+					media[i] = InputMedia{Type: "photo", FileID: fileIDs[i]}
+				} else if uploaded {
+					if err := rewind(p); err != nil {
+						return err
+					}
+				}
+			}
+			ids, err := b.tg.SendMediaGroup(id, media, c)
+			countBroadcast(err)
+			if err != nil {
+				return err
+			}
+			if !uploaded {
+				fileIDs, uploaded = ids, true
+			}
+		}
+		start = end
+	}
+	return nil
+}
+
+// maxMediaGroup is the largest album Telegram accepts in one sendMediaGroup.
+const maxMediaGroup = 10
+
+func (b *Bot) broadcastPhoto(r io.Reader, caption string) error {
+	return b.broadcastUpload(r,
+		func(id int64) (string, error) { return b.tg.SendPhoto(id, r, caption) },
+		func(id int64, fid string) error { return b.tg.SendPhotoFileID(id, fid, caption) })
+}
+
+// rewind seeks r back to the start so it can be uploaded again.
+func rewind(r io.Reader) error {
+	rs, ok := r.(io.Seeker)
+	if !ok {
+		return errors.New("telegram returned no file_id and media cannot be re-read")
+	}
+	_, err := rs.Seek(0, io.SeekStart)
+	return err
+}
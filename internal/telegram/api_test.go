@@ -1,6 +1,7 @@
 package telegram
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/url"
@@ -58,7 +59,7 @@ func TestAPI_GetUpdates(t *testing.T) {
 	api := NewAPI("DUMMY")
 	api.client = &http.Client{Transport: rt}
 
-	upd, err := api.GetUpdates(0)
+	upd, err := api.GetUpdates(context.Background(), 0)
 	if err != nil {
 		t.Fatalf("GetUpdates: %v", err)
 	}
@@ -68,24 +69,79 @@ func TestAPI_GetUpdates(t *testing.T) {
 }
 
 func TestAPI_SendVideo(t *testing.T) {
-	// SendVideo uses http.DefaultClient, so we have to swap it.
-	orig := http.DefaultClient
-	defer func() { http.DefaultClient = orig }()
-
-	called := false
-	http.DefaultClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
-		called = true
+	calls := 0
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
 		if !strings.HasSuffix(r.URL.Path, "/sendVideo") {
 			t.Fatalf("wrong endpoint: %s", r.URL.Path)
 		}
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Errorf("%s sent without a deadline", r.Header.Get("Content-Type"))
+		}
 		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"ok":true}`))}, nil
 	})}
 
 	api := NewAPI("TOKEN")
-	if err := api.SendVideo(99, []byte("data"), "cap"); err != nil {
+	api.client = client
+	if _, err := api.SendVideo(99, strings.NewReader("data"), "cap"); err != nil {
 		t.Fatalf("SendVideo: %v", err)
 	}
-	if !called {
-		t.Fatal("SendVideo never hit stub transport")
+	if err := api.SendVideoFileID(99, "fid", "cap"); err != nil {
+		t.Fatalf("SendVideoFileID: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("stub transport hit %d times, want 2", calls)
+	}
+}
+
+func TestAPI_SendVideoStreamsBody(t *testing.T) {
+	var got string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm: %v", err)
+		}
+		f, _, err := r.FormFile("video")
+		if err != nil {
+			t.Fatalf("FormFile: %v", err)
+		}
+		raw, _ := io.ReadAll(f)
+		got = string(raw)
+		return jsonResp(`{"ok":true,"result":{"video":{"file_id":"abc"}}}`), nil
+	})}
+
+	api := NewAPI("TOKEN")
+	api.client = client
+	fid, err := api.SendVideo(1, strings.NewReader("clip-bytes"), "cap")
+	if err != nil {
+		t.Fatalf("SendVideo: %v", err)
+	}
+	if got != "clip-bytes" || fid != "abc" {
+		t.Fatalf("got body %q file_id %q", got, fid)
+	}
+}
+
+func TestAPI_SendDocument(t *testing.T) {
+	var gotName string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if !strings.HasSuffix(r.URL.Path, "/sendDocument") {
+			t.Fatalf("wrong endpoint: %s", r.URL.Path)
+		}
+		r.ParseMultipartForm(1 << 20)
+		_, fh, err := r.FormFile("document")
+		if err != nil {
+			t.Fatalf("FormFile: %v", err)
+		}
+		gotName = fh.Filename
+		return jsonResp(`{"ok":true,"result":{"document":{"file_id":"doc"}}}`), nil
+	})}
+
+	api := NewAPI("TOKEN")
+	api.client = client
+	fid, err := api.SendDocument(1, strings.NewReader("raw"), "clip.avi", "cap")
+	if err != nil {
+		t.Fatalf("SendDocument: %v", err)
+	}
+	if fid != "doc" || gotName != "clip.avi" {
+		t.Fatalf("file_id %q name %q", fid, gotName)
 	}
 }
@@ -1,6 +1,7 @@
 package telegram
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,8 +11,12 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	alarmPkg "home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/archive"
+	"home-alarm-bot/internal/monitor"
+	"home-alarm-bot/internal/sensors"
 	"home-alarm-bot/internal/state"
 )
 
@@ -82,16 +87,13 @@ type roundTripFunc func(*http.Request) (*http.Response, error)
 func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
 
 func TestAPI_SendVideoError(t *testing.T) {
-    // Swap default client
-    orig := http.DefaultClient
-    defer func() { http.DefaultClient = orig }()
-
-    http.DefaultClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+    client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
         return &http.Response{StatusCode: 500, Body: io.NopCloser(strings.NewReader("fail"))}, nil
     })}
 
     api := NewAPI("BADTOKEN")
-    if err := api.SendVideo(123, []byte("data"), "cap"); err == nil {
+    api.client = client
+    if _, err := api.SendVideo(123, strings.NewReader("data"), "cap"); err == nil {
         t.Fatal("expected error on 500 response, got nil")
     }
 }
@@ -109,12 +111,11 @@ func (c *countingRT) RoundTrip(r *http.Request) (*http.Response, error) {
 }
 
 func TestBroadcastVideo_MultiChats(t *testing.T) {
-    orig := http.DefaultClient
     ctr := &countingRT{}
-    http.DefaultClient = &http.Client{Transport: ctr}
-    defer func() { http.DefaultClient = orig }()
+    client := &http.Client{Transport: ctr}
 
     bot, _, _, _ := newInstrumentedBot(t)
+    bot.tg.client = client
     // add two more chats
     bot.mu.Lock()
     bot.chats[2], bot.chats[3] = struct{}{}, struct{}{}
@@ -158,3 +159,243 @@ func TestBot_HandleStatus(t *testing.T) {
         t.Fatalf("status reply should mention Armed, got %q", txt)
     }
 }
+
+// Only the first chat should receive the clip bytes; the rest get the
+// file_id returned by that first upload.
+func TestBroadcastVideo_ReusesFileID(t *testing.T) {
+    var uploads, byID int32
+    client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+        if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+            atomic.AddInt32(&uploads, 1)
+            return jsonResp(`{"ok":true,"result":{"video":{"file_id":"FID"}}}`), nil
+        }
+        r.ParseForm()
+        if got := r.PostForm.Get("video"); got != "FID" {
+            t.Errorf("video = %q, want FID", got)
+        }
+        atomic.AddInt32(&byID, 1)
+        return jsonResp(`{"ok":true}`), nil
+    })}
+
+    bot, _, _, _ := newInstrumentedBot(t)
+    bot.tg.client = client
+    bot.mu.Lock()
+    bot.chats[2], bot.chats[3] = struct{}{}, struct{}{}
+    bot.mu.Unlock()
+
+    if err := bot.BroadcastVideo(strings.NewReader("clip"), "cap"); err != nil {
+        t.Fatalf("BroadcastVideo error: %v", err)
+    }
+    if uploads != 1 || byID != 2 {
+        t.Fatalf("uploads=%d byID=%d, want 1 and 2", uploads, byID)
+    }
+}
+
+/* ------------------- Bot.BroadcastPhotos -------------------------------- */
+
+func TestBroadcastPhotos_AlbumReusesFileIDs(t *testing.T) {
+    var calls int32
+    var lastMedia string
+    client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+        if !strings.HasSuffix(r.URL.Path, "/sendMediaGroup") {
+            t.Fatalf("unexpected path %s", r.URL.Path)
+        }
+        r.ParseMultipartForm(1 << 20)
+        lastMedia = r.FormValue("media")
+        atomic.AddInt32(&calls, 1)
+        return jsonResp(`{"ok":true,"result":[{"photo":[{"file_id":"s"},{"file_id":"A"}]},{"photo":[{"file_id":"B"}]}]}`), nil
+    })}
+
+    bot, _, _, _ := newInstrumentedBot(t)
+    bot.tg.client = client
+    bot.mu.Lock()
+    bot.chats[2] = struct{}{}
+    bot.mu.Unlock()
+
+    photos := []io.Reader{strings.NewReader("one"), strings.NewReader("two")}
+    if err := bot.BroadcastPhotos(photos, "porch"); err != nil {
+        t.Fatalf("BroadcastPhotos: %v", err)
+    }
+    if calls != 2 {
+        t.Fatalf("expected 2 sendMediaGroup calls, got %d", calls)
+    }
+    if !strings.Contains(lastMedia, `"media":"A"`) || !strings.Contains(lastMedia, `"media":"B"`) {
+        t.Fatalf("second album should reuse file_ids, got %s", lastMedia)
+    }
+}
+
+func TestBroadcastPhotos_NoSinglePhotoAlbum(t *testing.T) {
+    var sizes []int
+    client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+        if !strings.HasSuffix(r.URL.Path, "/sendMediaGroup") {
+            t.Fatalf("unexpected path %s", r.URL.Path)
+        }
+        r.ParseMultipartForm(1 << 20)
+        var media []json.RawMessage
+        json.Unmarshal([]byte(r.FormValue("media")), &media)
+        sizes = append(sizes, len(media))
+        return jsonResp(`{"ok":true,"result":[]}`), nil
+    })}
+
+    bot, _, _, _ := newInstrumentedBot(t)
+    bot.tg.client = client
+    photos := make([]io.Reader, 11)
+    for i := range photos {
+        photos[i] = strings.NewReader(fmt.Sprint("photo ", i))
+    }
+    if err := bot.BroadcastPhotos(photos, "porch"); err != nil {
+        t.Fatalf("BroadcastPhotos: %v", err)
+    }
+    if len(sizes) != 2 || sizes[0]+sizes[1] != 11 || sizes[0] < 2 || sizes[1] < 2 {
+        t.Fatalf("album sizes = %v, want two albums of at least 2 covering 11 photos", sizes)
+    }
+}
+
+func TestBot_HandleHistory(t *testing.T) {
+    bot, rt, _, st := newInstrumentedBot(t)
+    st.Record(state.Event{Kind: "video", Text: "🚨 clip", Fields: map[string]string{"camera": "porch", "zone": "front"}})
+
+    bot.Handle(Update{Message: &Message{Text: "/history", Chat: Chat{ID: 1}}})
+
+    if len(rt.reqs) != 1 {
+        t.Fatalf("expected 1 Telegram call, got %d", len(rt.reqs))
+    }
+    raw, _ := io.ReadAll(rt.reqs[0].Body)
+    vals, _ := url.ParseQuery(string(raw))
+    if txt := vals.Get("text"); !strings.Contains(txt, "video · porch (front)") {
+        t.Fatalf("history reply = %q", txt)
+    }
+}
+
+/* ------------------- /clips and re-send --------------------------------- */
+
+func TestBot_ClipsListAndResend(t *testing.T) {
+    bot, rt, _, _ := newInstrumentedBot(t)
+    var resent int32
+    bot.tg.client = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+        if strings.HasSuffix(r.URL.Path, "/sendVideo") {
+            atomic.AddInt32(&resent, 1)
+            return jsonResp(`{"ok":true}`), nil
+        }
+        return rt.RoundTrip(r)
+    })}
+    a, err := archive.Open(t.TempDir(), 0, 0)
+    if err != nil {
+        t.Fatalf("archive.Open: %v", err)
+    }
+    clip, _ := a.Save(strings.NewReader("clip"), archive.Clip{Name: "c.mp4", Video: true, Fields: map[string]string{"camera": "porch"}})
+    bot.SetArchive(a)
+
+    bot.Handle(Update{Message: &Message{Text: "/clips", Chat: Chat{ID: 1}}})
+    if len(rt.reqs) != 1 {
+        t.Fatalf("expected 1 Telegram call, got %d", len(rt.reqs))
+    }
+    raw, _ := io.ReadAll(rt.reqs[0].Body)
+    vals, _ := url.ParseQuery(string(raw))
+    if !strings.Contains(vals.Get("reply_markup"), "clip:"+clip.ID) {
+        t.Fatalf("keyboard missing clip button: %s", vals.Get("reply_markup"))
+    }
+
+    bot.Handle(Update{CallbackQuery: &CallbackQuery{ID: "q", Data: "clip:" + clip.ID, Message: &Message{Chat: Chat{ID: 1}}}})
+    if resent != 1 {
+        t.Fatalf("expected clip to be re-sent once, got %d", resent)
+    }
+    // Clips over Telegram's limit are refused instead of uploaded.
+    bot.SetMaxUpload(3)
+    bot.Handle(Update{CallbackQuery: &CallbackQuery{ID: "q2", Data: "clip:" + clip.ID, Message: &Message{Chat: Chat{ID: 1}}}})
+    if resent != 1 {
+        t.Fatalf("oversized clip re-sent, %d sends", resent)
+    }
+    if txt := lastText(t, rt); !strings.Contains(txt, "too large") {
+        t.Fatalf("callback answer = %q", txt)
+    }
+}
+
+/* ------------------- /arm bypass and /sensors --------------------------- */
+
+func lastText(t *testing.T, rt *fakeRoundTripper) string {
+    t.Helper()
+    rt.mu.Lock()
+    defer rt.mu.Unlock()
+    if len(rt.reqs) == 0 {
+        t.Fatal("no Telegram calls")
+    }
+    raw, _ := io.ReadAll(rt.reqs[len(rt.reqs)-1].Body)
+    vals, _ := url.ParseQuery(string(raw))
+    return vals.Get("text")
+}
+
+func TestBot_ArmBypassAndSensors(t *testing.T) {
+    bot, rt, armCalls, st := newInstrumentedBot(t)
+    reg := sensors.NewRegistry([]sensors.Sensor{{ID: "pir", Zone: "garage"}}, false)
+    bot.SetRegistry(reg)
+
+    bot.Handle(Update{Message: &Message{Text: "/arm bypass=attic", Chat: Chat{ID: 1}}})
+    if *armCalls != 0 || st.Get() == state.Armed {
+        t.Fatalf("unknown zone must not arm")
+    }
+
+    bot.Handle(Update{Message: &Message{Text: "/arm bypass=garage", Chat: Chat{ID: 1}}})
+    if *armCalls != 1 || st.Get() != state.Armed || !reg.Bypassed("garage") {
+        t.Fatalf("arm with bypass failed: calls=%d state=%s", *armCalls, st.Get())
+    }
+    if txt := lastText(t, rt); !strings.Contains(txt, "bypassing garage") {
+        t.Fatalf("reply = %q", txt)
+    }
+
+    bot.Handle(Update{Message: &Message{Text: "/sensors", Chat: Chat{ID: 1}}})
+    if txt := lastText(t, rt); !strings.Contains(txt, "pir (garage, bypassed)") || !strings.Contains(txt, "never seen") {
+        t.Fatalf("/sensors = %q", txt)
+    }
+
+    bot.Handle(Update{Message: &Message{Text: "/disarm", Chat: Chat{ID: 1}}})
+    if reg.Bypassed("garage") {
+        t.Fatal("disarm should clear the bypass")
+    }
+}
+
+func TestBot_ArmModesWithSimulator(t *testing.T) {
+    bot, rt, _, st := newInstrumentedBot(t)
+    sim := alarmPkg.NewSimulator("1234", []string{"garage", "porch"})
+    bot.alarm = sim
+
+    bot.Handle(Update{Message: &Message{Text: "/arm night", Chat: Chat{ID: 1}}})
+    if sim.Mode() != alarmPkg.ArmNight || st.Get() != state.Armed {
+        t.Fatalf("mode = %q, state = %s", sim.Mode(), st.Get())
+    }
+    if txt := lastText(t, rt); txt != "🔒 System Armed (night)" {
+        t.Fatalf("reply = %q", txt)
+    }
+
+    bot.Handle(Update{Message: &Message{Text: "/arm bypass=garage home", Chat: Chat{ID: 1}}})
+    if txt := lastText(t, rt); !strings.HasPrefix(txt, "Usage:") {
+        t.Fatalf("mode after bypass accepted: %q", txt)
+    }
+
+    bot.Handle(Update{Message: &Message{Text: "/zones", Chat: Chat{ID: 1}}})
+    if txt := lastText(t, rt); txt != "🗺 Zones: garage, porch" {
+        t.Fatalf("/zones = %q", txt)
+    }
+}
+
+func TestBot_Health(t *testing.T) {
+    bot, rt, _, _ := newInstrumentedBot(t)
+    cfg, _ := sensors.ParseSpec("cam:porch:1s,door:hall")
+    reg := sensors.NewRegistry(cfg, false)
+    bot.SetRegistry(reg)
+    bot.SetMonitor(monitor.New(bot.alarm, bot.store, bot, time.Minute))
+
+    bot.Handle(Update{Message: &Message{Text: "/health", Chat: Chat{ID: 1}}})
+    if txt := lastText(t, rt); !strings.Contains(txt, "All 2 sensors healthy") || !strings.Contains(txt, "Alarm server reachable") {
+        t.Fatalf("/health = %q", txt)
+    }
+
+    reg.Check(time.Now().Add(time.Minute))
+    batt := 5
+    reg.Observe(&sensors.Event{Type: sensors.Heartbeat, SensorID: "door", Time: time.Now(), Battery: &batt})
+    bot.Handle(Update{Message: &Message{Text: "/health", Chat: Chat{ID: 1}}})
+    txt := lastText(t, rt)
+    if !strings.Contains(txt, "cam has not reported") || !strings.Contains(txt, "door battery 5%") {
+        t.Fatalf("/health = %q", txt)
+    }
+}
@@ -1,59 +1,137 @@
 package telegram
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	alarmPkg "home-alarm-bot/internal/alarm"
+	"home-alarm-bot/internal/archive"
+	"home-alarm-bot/internal/metrics"
+	"home-alarm-bot/internal/monitor"
+	"home-alarm-bot/internal/sensors"
 	"home-alarm-bot/internal/state"
 )
 
 type Bot struct {
     tg    *API
     store *state.Store
-    alarm *alarmPkg.Client
+    alarm alarmPkg.Panel
+
+    clips     *archive.Archive
+    sensors   *sensors.Registry
+    monitor   *monitor.Monitor
+    maxUpload int64 // largest file Telegram accepts from the bot
 
     mu    sync.RWMutex
     chats map[int64]struct{}
+    acl   map[int64]Role // empty: every chat is an Admin
+}
+
+// NewBot returns a Bot driving the given alarm panel.
+func NewBot(tg *API, store *state.Store, alarm alarmPkg.Panel) *Bot {
+    return &Bot{tg: tg, store: store, alarm: alarm, maxUpload: 50 << 20, chats: make(map[int64]struct{})}
+}
+
+// SetMaxUpload sets the largest file Telegram accepts from the bot; archived
+// clips above it are not re-sent. The default is the Bot API's 50 MB.
+func (b *Bot) SetMaxUpload(n int64) {
+    b.mu.Lock()
+    b.maxUpload = n
+    b.mu.Unlock()
 }
 
-func NewBot(tg *API, store *state.Store, alarm *alarmPkg.Client) *Bot {
-    return &Bot{tg: tg, store: store, alarm: alarm, chats: make(map[int64]struct{})}
+// SetArchive enables the /clips command backed by a.
+func (b *Bot) SetArchive(a *archive.Archive) { b.clips = a }
+
+// SetRegistry enables /sensors and zone bypass on /arm.
+func (b *Bot) SetRegistry(r *sensors.Registry) { b.sensors = r }
+
+// SetMonitor adds the alarm server's reachability to /health.
+func (b *Bot) SetMonitor(m *monitor.Monitor) { b.monitor = m }
+
+var (
+    updatesProcessed = metrics.NewCounter("telegram_updates_processed_total",
+        "Telegram updates handed to the bot.")
+    broadcasts = metrics.NewCounter("telegram_broadcasts_total",
+        "Broadcast deliveries to subscribed chats by result (sent or failed).", "result")
+)
+
+// countBroadcast records the outcome of delivering a broadcast to one chat.
+func countBroadcast(err error) {
+    if err != nil {
+        broadcasts.Inc("failed")
+    } else {
+        broadcasts.Inc("sent")
+    }
 }
 
+// alarmTimeout bounds the alarm server calls made for one command, retries
+// included.
+const alarmTimeout = 15 * time.Second
+
 func (b *Bot) Handle(u Update) {
+    updatesProcessed.Inc()
+    if u.CallbackQuery != nil {
+        b.handleCallback(u.CallbackQuery)
+        return
+    }
     if u.Message == nil {
         return
     }
     chatID := u.Message.Chat.ID
+    txt := strings.TrimSpace(u.Message.Text)
+    cmd := commandName(txt)
+
+    role, allowed := b.role(chatID)
+    if !allowed {
+        // no reply and no event, so strangers cannot flood either
+        log.Printf("telegram: ignored %q from chat %d, not on the allowlist", cmd, chatID)
+        return
+    }
 
     // remember chat
     b.mu.Lock()
     b.chats[chatID] = struct{}{}
     b.mu.Unlock()
 
-    txt := strings.TrimSpace(u.Message.Text)
+    if !role.allows(commandRole(cmd)) {
+        b.refuse(chatID, cmd)
+        return
+    }
+
+    // a slow alarm server must not hold up the update loop for long
+    ctx, cancel := context.WithTimeout(context.Background(), alarmTimeout)
+    defer cancel()
 
-    switch {
+    switch cmd {
     /* ----------- normal state commands ----------- */
-    case txt == "/arm":
-        if err := b.alarm.Arm(); err != nil {
-            _ = b.tg.SendMessage(chatID, "❌ "+err.Error())
-            return
-        }
-        b.store.Set(state.Armed)
-        _ = b.tg.SendMessage(chatID, "🔒 System Armed")
+    case "/arm":
+        b.arm(ctx, chatID, txt)
 
-    case txt == "/disarm":
-        if err := b.alarm.Disarm(); err != nil {
+    case "/disarm":
+        if err := b.Disarm(ctx, "telegram", chatActor(chatID)); err != nil {
             _ = b.tg.SendMessage(chatID, "❌ "+err.Error())
             return
         }
-        b.store.Set(state.Disarmed)
         _ = b.tg.SendMessage(chatID, "🔓 System Disarmed")
 
-    case txt == "/status":
-        st, err := b.alarm.Status()
+    case "/zones":
+        b.listZones(ctx, chatID)
+
+    case "/sensors":
+        _ = b.tg.SendMessage(chatID, b.formatSensors())
+
+    case "/health":
+        _ = b.tg.SendMessage(chatID, b.formatHealth())
+
+    case "/status":
+        st, err := b.alarm.Status(ctx)
         if err != nil {
             _ = b.tg.SendMessage(chatID, "❌ "+err.Error())
             return
@@ -64,15 +142,21 @@ func (b *Bot) Handle(u Update) {
             _ = b.tg.SendMessage(chatID, "📟 State: 💤 Disarmed")
         }
 
+    case "/clips":
+        b.listClips(chatID)
+
+    case "/history":
+        _ = b.tg.SendMessage(chatID, formatHistory(b.store.History(historyLines)))
+
     /* --------------- change pin ------------------ */
-    case strings.HasPrefix(txt, "/change_pin"):
-        parts := strings.Fields(txt) // "/change_pin 1234" -> [" /change_pin", "1234"]
+    case "/change_pin":
+        parts := strings.Fields(txt) // "/change_pin 1234" -> ["/change_pin", "1234"]
         if len(parts) != 2 {
             _ = b.tg.SendMessage(chatID, "Usage: /change_pin 1234")
             return
         }
         pin := parts[1]
-        if err := b.alarm.ChangePIN(pin); err != nil {
+        if err := b.alarm.ChangePIN(ctx, pin); err != nil {
             _ = b.tg.SendMessage(chatID, "❌ "+err.Error())
             return
         }
@@ -84,11 +168,302 @@ func (b *Bot) Handle(u Update) {
     }
 }
 
+// commandName returns the command txt starts with, without the @botname
+// suffix Telegram adds in groups: "/arm@home_bot night" -> "/arm".
+func commandName(txt string) string {
+    fields := strings.Fields(txt)
+    if len(fields) == 0 {
+        return ""
+    }
+    cmd, _, _ := strings.Cut(fields[0], "@")
+    return cmd
+}
+
 
 func (b *Bot) Broadcast(msg string) {
     b.mu.RLock()
     defer b.mu.RUnlock()
     for id := range b.chats {
-        _ = b.tg.SendMessage(id, msg)
+        countBroadcast(b.tg.SendMessage(id, msg))
+    }
+}
+
+// Chats returns the IDs of the chats that receive broadcasts, sorted.
+func (b *Bot) Chats() []int64 {
+    b.mu.RLock()
+    defer b.mu.RUnlock()
+    out := make([]int64, 0, len(b.chats))
+    for id := range b.chats {
+        out = append(out, id)
+    }
+    slices.Sort(out)
+    return out
+}
+
+// historyLines is how many events /history shows.
+const historyLines = 10
+
+// formatHistory renders events one per line, newest last, naming the camera
+// and zone when the event carried them.
+func formatHistory(events []state.Event) string {
+    if len(events) == 0 {
+        return "📜 No events yet"
+    }
+    var sb strings.Builder
+    sb.WriteString("📜 Recent events")
+    for _, ev := range events {
+        line, _, _ := strings.Cut(ev.Text, "\n")
+        if cam := ev.Fields["camera"]; cam != "" {
+            line = ev.Kind + " · " + cam
+            if zone := ev.Fields["zone"]; zone != "" {
+                line += " (" + zone + ")"
+            }
+        }
+        fmt.Fprintf(&sb, "\n%s %s", ev.Time.Format("01-02 15:04"), line)
+    }
+    return sb.String()
+}
+
+// clipsShown is how many clips /clips lists.
+const clipsShown = 5
+
+// clipPrefix marks callback data that asks for an archived clip.
+const clipPrefix = "clip:"
+
+// listClips replies with the most recent archived clips, each with a button
+// that re-sends it.
+func (b *Bot) listClips(chatID int64) {
+    if b.clips == nil {
+        _ = b.tg.SendMessage(chatID, "🎞 Clip archive is disabled")
+        return
+    }
+    clips := b.clips.Recent(clipsShown)
+    if len(clips) == 0 {
+        _ = b.tg.SendMessage(chatID, "🎞 No clips archived yet")
+        return
+    }
+    rows := make([][]InlineButton, len(clips))
+    for i, c := range clips {
+        label := c.Time.Format("01-02 15:04")
+        if cam := c.Fields["camera"]; cam != "" {
+            label += " · " + cam
+        }
+        label += fmt.Sprintf(" · %.1f MB", float64(c.Size)/(1<<20))
+        rows[i] = []InlineButton{{Text: label, CallbackData: clipPrefix + c.ID}}
+    }
+    _ = b.tg.SendMessageKeyboard(chatID, "🎞 Recent clips — tap one to re-send it", rows)
+}
+
+func (b *Bot) handleCallback(q *CallbackQuery) {
+    id, ok := strings.CutPrefix(q.Data, clipPrefix)
+    if !ok || q.Message == nil || b.clips == nil {
+        _ = b.tg.AnswerCallbackQuery(q.ID, "")
+        return
+    }
+    chatID := q.Message.Chat.ID
+    if _, allowed := b.role(chatID); !allowed {
+        _ = b.tg.AnswerCallbackQuery(q.ID, "⛔ Not allowed")
+        return
+    }
+
+    c, f, err := b.clips.Open(id)
+    if err != nil {
+        _ = b.tg.AnswerCallbackQuery(q.ID, "❌ "+err.Error())
+        return
+    }
+    defer f.Close()
+    b.mu.RLock()
+    limit := b.maxUpload
+    b.mu.RUnlock()
+    if c.Size > limit {
+        _ = b.tg.AnswerCallbackQuery(q.ID, fmt.Sprintf("❌ Clip too large for Telegram (%d MB)", c.Size>>20))
+        return
+    }
+    _ = b.tg.AnswerCallbackQuery(q.ID, "Sending…")
+
+    if c.Video {
+        _, err = b.tg.SendVideo(chatID, f, c.Caption)
+    } else {
+        _, err = b.tg.SendDocument(chatID, f, c.Name, c.Caption)
+    }
+    if err != nil {
+        _ = b.tg.SendMessage(chatID, "❌ "+err.Error())
+    }
+}
+
+// arm handles "/arm [away|home|night] [bypass=garage,porch]".
+func (b *Bot) arm(ctx context.Context, chatID int64, txt string) {
+    var zones []string
+    mode := alarmPkg.ArmAway
+    for i, arg := range strings.Fields(txt)[1:] {
+        list, ok := strings.CutPrefix(arg, "bypass=")
+        if !ok {
+            m, err := alarmPkg.ParseArmMode(arg)
+            if err != nil || i > 0 {
+                _ = b.tg.SendMessage(chatID, "Usage: /arm [away|home|night] [bypass=zone1,zone2]")
+                return
+            }
+            mode = m
+            continue
+        }
+        for _, z := range strings.Split(list, ",") {
+            if z = strings.TrimSpace(z); z != "" {
+                zones = append(zones, z)
+            }
+        }
+    }
+
+    if err := b.Arm(ctx, mode, zones, "telegram", chatActor(chatID)); err != nil {
+        _ = b.tg.SendMessage(chatID, "❌ "+err.Error())
+        return
+    }
+    msg := "🔒 System Armed"
+    if mode != alarmPkg.ArmAway {
+        msg += " (" + string(mode) + ")"
+    }
+    if len(zones) > 0 {
+        msg += " (bypassing " + strings.Join(zones, ", ") + ")"
+    }
+    _ = b.tg.SendMessage(chatID, msg)
+}
+
+// chatActor names a chat in the history.
+func chatActor(chatID int64) string { return fmt.Sprintf("chat %d", chatID) }
+
+// Arm arms the panel in mode with zones bypassed, then updates the store and
+// records who asked. It is shared by /arm and the bot's other front ends;
+// callers announce the result themselves.
+func (b *Bot) Arm(ctx context.Context, mode alarmPkg.ArmMode, zones []string, source, actor string) error {
+    if len(zones) > 0 {
+        if b.sensors == nil {
+            return errors.New("no zones are known, cannot bypass")
+        }
+        if err := b.sensors.SetBypass(zones); err != nil {
+            return err
+        }
+    }
+    if err := b.alarm.Arm(ctx, mode, zones); err != nil {
+        if b.sensors != nil {
+            _ = b.sensors.SetBypass(nil)
+        }
+        return err
+    }
+    b.store.Set(state.Armed)
+    f := map[string]string{"source": source, "actor": actor, "mode": string(mode)}
+    if len(zones) > 0 {
+        f["bypass"] = strings.Join(zones, ",")
+    }
+    b.store.Record(state.Event{Kind: "state", Text: string(state.Armed), Fields: f})
+    return nil
+}
+
+// Disarm disarms the panel, clears any bypass and records who asked.
+func (b *Bot) Disarm(ctx context.Context, source, actor string) error {
+    if err := b.alarm.Disarm(ctx); err != nil {
+        return err
+    }
+    b.store.Set(state.Disarmed)
+    if b.sensors != nil {
+        _ = b.sensors.SetBypass(nil)
+    }
+    b.store.Record(state.Event{Kind: "state", Text: string(state.Disarmed),
+        Fields: map[string]string{"source": source, "actor": actor}})
+    return nil
+}
+
+// listZones replies with the zones the panel reports.
+func (b *Bot) listZones(ctx context.Context, chatID int64) {
+    zones, err := b.alarm.Zones(ctx)
+    if err != nil {
+        _ = b.tg.SendMessage(chatID, "❌ "+err.Error())
+        return
+    }
+    if len(zones) == 0 {
+        _ = b.tg.SendMessage(chatID, "🗺 The panel reports no zones")
+        return
+    }
+    _ = b.tg.SendMessage(chatID, "🗺 Zones: "+strings.Join(zones, ", "))
+}
+
+// formatSensors renders the registry for /sensors.
+func (b *Bot) formatSensors() string {
+    if b.sensors == nil {
+        return "📡 Sensor registry is disabled"
+    }
+    list := b.sensors.List()
+    if len(list) == 0 {
+        return "📡 No sensors known yet"
+    }
+    var sb strings.Builder
+    sb.WriteString("📡 Sensors")
+    for _, s := range list {
+        fmt.Fprintf(&sb, "\n• %s", s.ID)
+        if s.Zone != "" {
+            fmt.Fprintf(&sb, " (%s", s.Zone)
+            if b.sensors.Bypassed(s.Zone) {
+                sb.WriteString(", bypassed")
+            }
+            sb.WriteString(")")
+        }
+        if s.State != "" {
+            fmt.Fprintf(&sb, " — %s", strings.ReplaceAll(string(s.State), "_", " "))
+        }
+        if s.Battery >= 0 {
+            fmt.Fprintf(&sb, " · 🔋 %d%%", s.Battery)
+        }
+        if s.Offline {
+            sb.WriteString(" · 📴 offline")
+        }
+        if s.LastSeen.IsZero() {
+            sb.WriteString(" · never seen")
+        } else {
+            fmt.Fprintf(&sb, " · %s ago", time.Since(s.LastSeen).Round(time.Second))
+        }
+    }
+    return sb.String()
+}
+
+// lowBattery is the charge below which /health flags a sensor.
+const lowBattery = 20
+
+// formatHealth summarises alarm server and sensor problems for /health.
+func (b *Bot) formatHealth() string {
+    var sb strings.Builder
+    sb.WriteString("🩺 Health")
+    if b.monitor != nil {
+        lastOK, lastErr, down := b.monitor.Health()
+        switch {
+        case down:
+            fmt.Fprintf(&sb, "\n🔌 Alarm server unreachable since %s (%v)", lastOK.Format("15:04:05"), lastErr)
+        case lastErr != nil:
+            fmt.Fprintf(&sb, "\n🔌 Alarm server flaky, last error: %v", lastErr)
+        default:
+            fmt.Fprintf(&sb, "\n🔌 Alarm server reachable (checked %s ago)", time.Since(lastOK).Round(time.Second))
+        }
+    }
+
+    if b.sensors == nil {
+        sb.WriteString("\n📡 Sensor registry is disabled")
+        return sb.String()
+    }
+    list := b.sensors.List()
+    var problems []string
+    for _, s := range list {
+        switch {
+        case s.Offline && s.LastSeen.IsZero():
+            problems = append(problems, fmt.Sprintf("📴 %s has not reported since startup", s.ID))
+        case s.Offline:
+            problems = append(problems, fmt.Sprintf("📴 %s offline for %s", s.ID, time.Since(s.LastSeen).Round(time.Minute)))
+        }
+        if s.Battery >= 0 && s.Battery < lowBattery {
+            problems = append(problems, fmt.Sprintf("🪫 %s battery %d%%", s.ID, s.Battery))
+        }
+    }
+    if len(problems) == 0 {
+        fmt.Fprintf(&sb, "\n📡 All %d sensors healthy", len(list))
+        return sb.String()
     }
+    fmt.Fprintf(&sb, "\n📡 %d sensors, %d problem(s)\n", len(list), len(problems))
+    sb.WriteString(strings.Join(problems, "\n"))
+    return sb.String()
 }
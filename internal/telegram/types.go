@@ -1,8 +1,24 @@
 package telegram
 
+import "io"
+
 type Update struct {
-	UpdateID int      `json:"update_id"`
-	Message  *Message `json:"message,omitempty"`
+	UpdateID      int            `json:"update_id"`
+	Message       *Message       `json:"message,omitempty"`
+	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+}
+
+// CallbackQuery is sent when a user presses an inline keyboard button.
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	Data    string   `json:"data"`
+	Message *Message `json:"message,omitempty"`
+}
+
+// InlineButton is one button of an inline keyboard.
+type InlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
 }
 
 type Message struct {
@@ -14,3 +30,46 @@ type Message struct {
 type Chat struct {
 	ID int64 `json:"id"`
 }
+
+// User is a Telegram account; GetMe returns the bot's own.
+type User struct {
+	ID       int64  `json:"id"`
+	IsBot    bool   `json:"is_bot"`
+	Username string `json:"username,omitempty"`
+}
+
+// sentMessage is the part of a sent Message we read back: the file_id
+// Telegram assigned to uploaded media.
+type sentMessage struct {
+	Video *struct {
+		FileID string `json:"file_id"`
+	} `json:"video,omitempty"`
+	Photo []struct {
+		FileID string `json:"file_id"`
+	} `json:"photo,omitempty"`
+	Document *struct {
+		FileID string `json:"file_id"`
+	} `json:"document,omitempty"`
+}
+
+// fileID returns the file_id of the video or document, or of the largest
+// photo size.
+func (m sentMessage) fileID() string {
+	switch {
+	case m.Video != nil:
+		return m.Video.FileID
+	case m.Document != nil:
+		return m.Document.FileID
+	case len(m.Photo) > 0:
+		return m.Photo[len(m.Photo)-1].FileID
+	}
+	return ""
+}
+
+// InputMedia is one item of a media group. Set FileID to re-send something
+// already uploaded; otherwise File is uploaded.
+type InputMedia struct {
+	Type   string // "photo" or "video"
+	FileID string
+	File   io.Reader
+}
@@ -0,0 +1,311 @@
+// Package webhook delivers history events to outside HTTP endpoints, signed
+// and retried, and keeps a log of every delivery attempt.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	mrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"home-alarm-bot/internal/state"
+)
+
+// DefaultKinds are the events sent to endpoints that do not choose.
+var DefaultKinds = []string{"state", "alarm", "incident", "success", "video"}
+
+// Endpoint is one webhook receiver.
+type Endpoint struct {
+	URL string
+	// Secret signs every delivery; see Dispatcher.
+	Secret string
+	// Kinds filters events by state.Event Kind; empty means DefaultKinds.
+	Kinds []string
+}
+
+// ParseEndpoints reads whitespace-separated endpoints of the form
+//
+//	https://pager.example/hook;secret=abc;events=alarm,incident
+//
+// where secret and events are optional.
+func ParseEndpoints(spec string) ([]Endpoint, error) {
+	var eps []Endpoint
+	for _, entry := range strings.Fields(spec) {
+		parts := strings.Split(entry, ";")
+		u, err := url.Parse(parts[0])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %q: want an http(s) URL", parts[0])
+		}
+		ep := Endpoint{URL: parts[0]}
+		for _, opt := range parts[1:] {
+			k, v, _ := strings.Cut(opt, "=")
+			switch k {
+			case "secret":
+				ep.Secret = v
+			case "events":
+				ep.Kinds = strings.Split(v, ",")
+			default:
+				return nil, fmt.Errorf("webhook %q: unknown option %q", parts[0], k)
+			}
+		}
+		eps = append(eps, ep)
+	}
+	return eps, nil
+}
+
+func (e Endpoint) wants(kind string) bool {
+	if len(e.Kinds) == 0 {
+		return slices.Contains(DefaultKinds, kind)
+	}
+	return slices.Contains(e.Kinds, kind)
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Event state.Event      `json:"event"`
+	State state.AlarmState `json:"state"`
+}
+
+// Delivery is one attempt in the delivery log.
+type Delivery struct {
+	ID       string        `json:"id"` // same for every attempt of one event
+	URL      string        `json:"url"`
+	EventID  int64         `json:"event_id"`
+	Kind     string        `json:"kind"`
+	Attempt  int           `json:"attempt"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration_ns"`
+	Status   int           `json:"status,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	OK       bool          `json:"ok"`
+}
+
+// Retry policy; variables so tests can shorten them.
+var (
+	maxAttempts = 6
+	firstDelay  = 2 * time.Second
+	maxDelay    = 5 * time.Minute
+)
+
+const (
+	// queueSize is how many events may wait per endpoint.
+	queueSize = 256
+	// logSize is how many delivery attempts are remembered.
+	logSize = 500
+	// requestTimeout bounds one attempt.
+	requestTimeout = 10 * time.Second
+)
+
+type job struct {
+	id      string
+	payload Payload
+	body    []byte
+}
+
+// Dispatcher sends store events to its endpoints. Each endpoint has its own
+// queue, so a slow receiver delays only itself and sees events in order.
+//
+// Every POST carries:
+//
+//	Content-Type:       application/json
+//	X-Webhook-Event:    the event Kind
+//	X-Webhook-Delivery: an ID shared by all attempts of one delivery
+//	X-Timestamp:        Unix seconds
+//	X-Signature:        hex HMAC-SHA256 over "<timestamp>\n<body>" (with a Secret)
+//
+// Any 2xx is success. Other answers and network errors are retried with
+// jittered exponential backoff, except 4xx other than 408 and 429.
+type Dispatcher struct {
+	store  *state.Store
+	client *http.Client
+	queues []chan job
+	eps    []Endpoint
+
+	mu   sync.Mutex
+	log  []Delivery
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New starts a Dispatcher for eps and hooks it into store.
+func New(store *state.Store, eps []Endpoint) *Dispatcher {
+	d := &Dispatcher{store: store, client: &http.Client{Timeout: requestTimeout}, eps: eps, stop: make(chan struct{})}
+	for _, ep := range eps {
+		q := make(chan job, queueSize)
+		d.queues = append(d.queues, q)
+		d.wg.Add(1)
+		go d.worker(ep, q)
+	}
+	store.OnRecord(d.enqueue)
+	return d
+}
+
+func (d *Dispatcher) enqueue(ev state.Event) {
+	p := Payload{Event: ev, State: d.store.Get()}
+	body, _ := json.Marshal(p)
+	for i, ep := range d.eps {
+		if !ep.wants(ev.Kind) {
+			continue
+		}
+		select {
+		case d.queues[i] <- job{id: newID(), payload: p, body: body}:
+		default:
+			log.Printf("webhook %s: queue full, dropping event %d", ep.URL, ev.ID)
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (d *Dispatcher) worker(ep Endpoint, q chan job) {
+	defer d.wg.Done()
+	for {
+		select {
+		case j := <-q:
+			d.deliver(ep, j)
+		case <-d.stop:
+			// Drain what is queued, one attempt each.
+			for {
+				select {
+				case j := <-q:
+					d.attempt(ep, j, 1)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver tries j until it succeeds, fails permanently, runs out of
+// attempts or the dispatcher is closed.
+func (d *Dispatcher) deliver(ep Endpoint, j job) {
+	delay := firstDelay
+	for attempt := 1; ; attempt++ {
+		done := d.attempt(ep, j, attempt)
+		if done || attempt == maxAttempts {
+			if !done {
+				log.Printf("webhook %s: giving up on event %d after %d attempts", ep.URL, j.payload.Event.ID, attempt)
+			}
+			return
+		}
+		select {
+		case <-d.stop:
+			return
+		case <-time.After(delay/2 + mrand.N(delay)):
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// attempt makes one POST and logs it. It reports whether j needs no retry.
+func (d *Dispatcher) attempt(ep Endpoint, j job, n int) bool {
+	rec := Delivery{ID: j.id, URL: ep.URL, EventID: j.payload.Event.ID, Kind: j.payload.Event.Kind, Attempt: n, Time: time.Now()}
+	final := false
+	defer func() {
+		rec.Duration = time.Since(rec.Time)
+		d.record(rec)
+	}()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, ep.URL, bytes.NewReader(j.body))
+	if err != nil {
+		rec.Error = err.Error()
+		return true
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", j.payload.Event.Kind)
+	req.Header.Set("X-Webhook-Delivery", j.id)
+	sign(req.Header, ep.Secret, j.body, time.Now())
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		rec.Error = err.Error()
+		return false
+	}
+	res.Body.Close()
+	rec.Status = res.StatusCode
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		rec.OK, final = true, true
+	case res.StatusCode >= 400 && res.StatusCode < 500 &&
+		res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests:
+		rec.Error, final = res.Status+" (not retried)", true
+	default:
+		rec.Error = res.Status
+	}
+	return final
+}
+
+// sign adds X-Timestamp and, with a secret, X-Signature.
+func sign(h http.Header, secret string, body []byte, now time.Time) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	h.Set("X-Timestamp", ts)
+	if secret == "" {
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n", ts)
+	mac.Write(body)
+	h.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (d *Dispatcher) record(rec Delivery) {
+	if !rec.OK {
+		log.Printf("webhook %s: event %d attempt %d: %s", rec.URL, rec.EventID, rec.Attempt, rec.Error)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, rec)
+	if len(d.log) > logSize {
+		d.log = d.log[len(d.log)-logSize:]
+	}
+}
+
+// Deliveries returns up to n of the latest delivery attempts, newest first.
+func (d *Dispatcher) Deliveries(n int) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if n <= 0 || n > len(d.log) {
+		n = len(d.log)
+	}
+	out := make([]Delivery, n)
+	for i := range out {
+		out[i] = d.log[len(d.log)-1-i]
+	}
+	return out
+}
+
+// Close stops retrying, makes one last attempt at every queued event and
+// waits for that to finish or ctx to end.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	select {
+	case <-d.stop:
+	default:
+		close(d.stop)
+	}
+	done := make(chan struct{})
+	go func() { d.wg.Wait(); close(done) }()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"home-alarm-bot/internal/state"
+	"home-alarm-bot/internal/testutil"
+)
+
+func fastRetries(t *testing.T) {
+	firstDelay = time.Millisecond
+	t.Cleanup(func() { firstDelay = 2 * time.Second })
+}
+
+func TestDispatcher_SignsAndRetries(t *testing.T) {
+	fastRetries(t)
+	var calls int32
+	got := make(chan Payload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("k"))
+		mac.Write([]byte(r.Header.Get("X-Timestamp") + "\n"))
+		mac.Write(body)
+		if r.Header.Get("X-Signature") != hex.EncodeToString(mac.Sum(nil)) || r.Header.Get("X-Webhook-Event") != "alarm" {
+			t.Errorf("bad headers: %v", r.Header)
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var p Payload
+		json.Unmarshal(body, &p)
+		got <- p
+	}))
+	defer srv.Close()
+
+	st := state.New()
+	d := New(st, []Endpoint{{URL: srv.URL, Secret: "k"}})
+	st.Set(state.Armed)
+	st.Record(state.Event{Kind: "sensor", Text: "ignored by default"})
+	st.Record(state.Event{Kind: "alarm", Text: "alarm triggered"})
+
+	select {
+	case p := <-got:
+		if p.Event.Kind != "alarm" || p.Event.ID != 2 || p.State != state.Armed {
+			t.Fatalf("payload = %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("not delivered")
+	}
+
+	testutil.WaitFor(t, "three deliveries", func() bool { return len(d.Deliveries(0)) == 3 })
+	log := d.Deliveries(0)
+	if !log[0].OK || log[0].Attempt != 3 || log[1].Status != http.StatusBadGateway || log[0].ID != log[2].ID {
+		t.Fatalf("log = %+v", log)
+	}
+}
+
+func TestDispatcher_PermanentFailureAndFilter(t *testing.T) {
+	fastRetries(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer srv.Close()
+
+	st := state.New()
+	d := New(st, []Endpoint{{URL: srv.URL, Kinds: []string{"sensor"}}})
+	st.Record(state.Event{Kind: "alarm"})
+	st.Record(state.Event{Kind: "sensor"})
+
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	log := d.Deliveries(0)
+	if len(log) != 1 || log[0].Kind != "sensor" || log[0].OK || calls != 1 {
+		t.Fatalf("log = %+v, calls = %d", log, calls)
+	}
+}
+
+func TestParseEndpoints(t *testing.T) {
+	eps, err := ParseEndpoints("https://a.example/h;secret=s;events=alarm,state\n http://b.example/x")
+	if err != nil || len(eps) != 2 || eps[0].Secret != "s" || len(eps[0].Kinds) != 2 || eps[1].URL != "http://b.example/x" {
+		t.Fatalf("ParseEndpoints = %+v, %v", eps, err)
+	}
+	for _, bad := range []string{"ftp://x", "https://x;colour=red"} {
+		if _, err := ParseEndpoints(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}